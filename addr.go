@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Parses an hexadecimal address, with or without the 0x prefix.
+func parseAddr(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// Hex digits of a symbol address without prefix and leading zeros, whose
+// length and then text order is the numeric one.
+const addrDigits = "ltrim(replace(lower(symbol_address), '0x', ''), '0')"
+
+// Returns the name of the symbol containing the address, that is the symbol
+// with the highest start address not above it. Symbols with no valid address
+// are ignored. Since the symbol sizes are not known, an address beyond the
+// last function resolves to the last function.
+func symbolByAddr(db navdb.Conn, addr uint64, instance int) (string, error) {
+	var name, symAddr string
+
+	query := "select symbol_name, symbol_address from symbols where symbol_instance_id_ref=$1 and symbol_address is not null and " +
+		addrDigits + " <> '' and (length(" + addrDigits + ") < length($2) or length(" + addrDigits + ") = length($2) and " + addrDigits + " <= $2) " +
+		"order by length(" + addrDigits + ") desc, " + addrDigits + " desc"
+	rows, err := db.Query(query, instance, strconv.FormatUint(addr, 16))
+	if err != nil {
+		return "", fmt.Errorf("symbolByAddr: %w", err)
+	}
+	defer rows.Close()
+
+	// Rows not holding an hex address sort anywhere, the first valid one is
+	// the closest.
+	for rows.Next() {
+		if err := rows.Scan(&name, &symAddr); err != nil {
+			return "", fmt.Errorf("symbolByAddr: %w", err)
+		}
+		if a, err := parseAddr(symAddr); err == nil && a != 0 && a <= addr {
+			logger.info("address resolved", "address", fmt.Sprintf("%#x", addr), "symbol", name, "offset", addr-a)
+			return name, nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return "", fmt.Errorf("symbolByAddr: %w", err)
+	}
+	return "", fmt.Errorf("no symbol contains address %#x in instance %d", addr, instance)
+}
+
+// Replaces the symbols with the one containing the address given by --addr.
+func resolveAddr(db navdb.Conn, conf *configuration) error {
+	if conf.addr == "" {
+		return nil
+	}
+	addr, err := parseAddr(conf.addr)
+	if err != nil {
+		return err
+	}
+	symbol, err := symbolByAddr(db, addr, conf.Instance)
+	if err != nil {
+		return err
+	}
+	conf.cliSymbols = []string{symbol}
+	conf.Symbol = symbol
+	return nil
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/graph"
+	"github.com/alessandrocarminati/nav/output"
+)
+
+const (
+	cmdSCC        = "scc"
+	cmdDominators = "dominators"
+	cmdPaths      = "paths"
+)
+
+// Explores the call tree of the symbols and returns it as function level graph.
+func exploreGraph(db navdb.Conn, conf *configuration, symbols []string) (*graph.Graph, error) {
+	c := *conf
+	c.Mode = printAll
+	c.Quiet = true
+	e, err := explore(navdb.Context(db), db, &c, newCache(), symbols, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newOutGraph(e, printAll), nil
+}
+
+// Implements the scc command.
+func cmdSCCs(db navdb.Conn, conf *configuration) (string, error) {
+	var res [][]string
+
+	g, err := exploreGraph(db, conf, conf.symbolList())
+	if err != nil {
+		return "", err
+	}
+	for _, comp := range g.SCC() {
+		res = append(res, g.Names(comp))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i][0] < res[j][0] })
+
+	if opt2num(conf.Jout) != graphOnly {
+		if res == nil {
+			res = [][]string{}
+		}
+		return jsonResult(cmdSCC, res)
+	}
+	var lines []string
+	for i, comp := range res {
+		lines = append(lines, fmt.Sprintf("scc %d: %s", i+1, strings.Join(comp, " ")))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Dominator tree edge.
+type domEdge struct {
+	Node string `json:"node"`
+	Idom string `json:"idom"`
+}
+
+// Implements the dominators command. Without args the immediate dominator of
+// every function is reported, given a sink function the chain of functions
+// every path from the symbol to the sink goes through.
+func cmdDominatorTree(db navdb.Conn, conf *configuration) (string, error) {
+	symbols := conf.symbolList()
+	if len(symbols) != 1 {
+		return "", errors.New("dominators needs a single symbol")
+	}
+	if len(conf.cmdArgs) > 1 {
+		return "", fmt.Errorf("command %s needs at most 1 arg", cmdDominators)
+	}
+	g, err := exploreGraph(db, conf, symbols)
+	if err != nil {
+		return "", err
+	}
+	idom := g.Dominators(0)
+
+	if len(conf.cmdArgs) == 0 {
+		var res []domEdge
+		for v, d := range idom {
+			if d >= 0 {
+				res = append(res, domEdge{g.Nodes[v].Name, g.Nodes[d].Name})
+			}
+		}
+		sort.Slice(res, func(i, j int) bool { return res[i].Node < res[j].Node })
+		if opt2num(conf.Jout) != graphOnly {
+			if res == nil {
+				res = []domEdge{}
+			}
+			return jsonResult(cmdDominators, res)
+		}
+		lines := []string{"node\tidom"}
+		for _, e := range res {
+			lines = append(lines, e.Node+"\t"+e.Idom)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	sink, ok := g.Index[conf.cmdArgs[0]]
+	if !ok || (sink != 0 && idom[sink] < 0) {
+		return "", fmt.Errorf("%s is not reachable from %s", conf.cmdArgs[0], symbols[0])
+	}
+	chain := []string{g.Nodes[sink].Name}
+	for v := idom[sink]; v >= 0; v = idom[v] {
+		chain = append([]string{g.Nodes[v].Name}, chain...)
+	}
+	if opt2num(conf.Jout) != graphOnly {
+		return jsonResult(cmdDominators, chain)
+	}
+	return strings.Join(chain, " -> "), nil
+}
+
+// Implements the paths command: lists the shortest call chains from the
+// symbol to the target, as many as requested with --paths. With a weights
+// file, the heaviest chains are listed instead.
+func cmdCallPaths(db navdb.Conn, conf *configuration) (string, error) {
+	var res [][]string
+	var w *weights
+
+	symbols := conf.symbolList()
+	if len(symbols) != 1 {
+		return "", errors.New("paths needs a single symbol")
+	}
+	if conf.Weights != "" {
+		var err error
+		if w, err = loadWeights(conf.Weights); err != nil {
+			return "", err
+		}
+	}
+	g, err := exploreGraph(db, conf, symbols)
+	if err != nil {
+		return "", err
+	}
+	target, ok := g.Index[conf.cmdArgs[0]]
+	if !ok {
+		return "", fmt.Errorf("%s is not reachable from %s", conf.cmdArgs[0], symbols[0])
+	}
+	var paths [][]int
+	if w != nil {
+		var truncated bool
+		if paths, truncated = g.HeaviestPaths(0, target, conf.Paths, w.stepWeight(g), weightedPathsLimit); truncated {
+			setTruncated(conf, fmt.Sprint("Call chains search budget reached, only the ", len(paths), " heaviest found are listed"))
+		}
+	} else {
+		paths = g.ShortestPaths(0, target, conf.Paths)
+	}
+	for _, p := range paths {
+		chain := make([]string, len(p))
+		for i, v := range p {
+			chain[i] = g.Nodes[v].Name
+		}
+		res = append(res, chain)
+	}
+
+	if w != nil {
+		ranked := w.rank(res, conf.Paths)
+		if opt2num(conf.Jout) == plantUMLOutput {
+			var chains [][]string
+			for _, p := range ranked {
+				chains = append(chains, p.Chain)
+			}
+			return chainsDiagram(g, chains, conf.Diagram), nil
+		}
+		if opt2num(conf.Jout) != graphOnly {
+			return jsonResult(cmdPaths, ranked)
+		}
+		var lines []string
+		for _, p := range ranked {
+			lines = append(lines, fmt.Sprintf("%g\t%s", p.Weight, strings.Join(p.Chain, " -> ")))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	if opt2num(conf.Jout) == plantUMLOutput {
+		return chainsDiagram(g, res, conf.Diagram), nil
+	}
+	if opt2num(conf.Jout) != graphOnly {
+		return jsonResult(cmdPaths, res)
+	}
+	var lines []string
+	for _, chain := range res {
+		lines = append(lines, strings.Join(chain, " -> "))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Renders call chains of the graph as a PlantUML diagram.
+func chainsDiagram(g *graph.Graph, chains [][]string, diagram string) string {
+	paths := make([][]int, len(chains))
+	for i, chain := range chains {
+		for _, name := range chain {
+			paths[i] = append(paths[i], g.Index[name])
+		}
+	}
+	return output.PlantUML(g.Subgraph(paths), 1, diagram)
+}
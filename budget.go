@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Functions whose calls were cut by the exploration budget.
+var fmtDotNodeTruncated = []string{
+	"",
+	"\"%s\" [color=orange penwidth=2 xlabel=\"truncated\"]\n",
+	"\\\"%s\\\" [color=orange penwidth=2 xlabel=\\\"truncated\\\"] \\\\\\n",
+	"\"%s\" [color=orange penwidth=2 xlabel=\"truncated\"]\n",
+	"\"%s\" [color=orange penwidth=2 xlabel=\"truncated\"]\n",
+}
+
+// Checks if adding the call to a function exceeds the budget: either the
+// calls are maxEdges, or the function is new and the functions are maxNodes.
+func (nc *navConf) overBudget(res *navResult, symbolId int) bool {
+	if nc.maxEdges > 0 && res.edges >= nc.maxEdges {
+		return true
+	}
+	return nc.maxNodes > 0 && !res.nodes[symbolId] && len(res.nodes) >= nc.maxNodes
+}
+
+// Records a function some calls of which are missing from the output.
+func (res *navResult) truncate(id int, symbol string) {
+	if res.truncatedKeys[symbol] {
+		return
+	}
+	logger.info("budget reached, truncated", "symbol", symbol)
+	res.truncatedKeys[symbol] = true
+	res.truncated = append(res.truncated, symbol)
+	res.truncatedIds = append(res.truncatedIds, id)
+}
+
+// Returns the DOT statements marking the truncated functions.
+func truncatedDotNodes(truncated []string, flavour int) string {
+	var res string
+
+	for _, name := range truncated {
+		res += fmt.Sprintf(fmtDotNodeTruncated[flavour], name)
+	}
+	return res
+}
+
+// Appends the truncated functions to an output, see appendSection.
+func appendTruncated(out string, truncated []string, jout string, w io.Writer) (string, error) {
+	var lines []string
+
+	for _, name := range truncated {
+		lines = append(lines, "truncated: "+name)
+	}
+	if truncated == nil {
+		truncated = []string{}
+	}
+	return appendSection(out, "truncated", truncated, lines, jout, w)
+}
+
+// Writes the truncated functions of a streamed exploration.
+func streamTruncated(enc *json.Encoder, truncated []string) error {
+	for _, name := range truncated {
+		if err := enc.Encode(ndjsonTruncated{"truncated", name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/output"
+)
+
+const cmdCompare = "compare"
+
+// Function level call edge, with the subsystems of its ends.
+type subsysEdge struct {
+	Caller       string `json:"caller"`
+	CallerSubsys string `json:"caller_subsystem"`
+	Callee       string `json:"callee"`
+	CalleeSubsys string `json:"callee_subsystem"`
+}
+
+// Differences between the baseline and the current call graph, Violations
+// are the added edges crossing the guarded subsystem boundaries.
+type compareResult struct {
+	Symbols      []string     `json:"symbols"`
+	Baseline     string       `json:"baseline"`
+	AddedEdges   []subsysEdge `json:"added_edges"`
+	RemovedEdges []subsysEdge `json:"removed_edges"`
+	Violations   []subsysEdge `json:"violations"`
+}
+
+// Subsystem boundary: calls from the subsystems matching From into the
+// ones matching To, nil matching any.
+type boundary struct {
+	from *regexp.Regexp
+	to   *regexp.Regexp
+}
+
+// Parses a boundary in the from->to form, both sides being regular
+// expressions matching the whole subsystem name, an empty one any.
+func parseBoundary(s string) (boundary, error) {
+	var b boundary
+
+	parts := strings.Split(s, "->")
+	if len(parts) != 2 {
+		return b, fmt.Errorf("invalid boundary %s, expected from->to", s)
+	}
+	for i, re := range []**regexp.Regexp{&b.from, &b.to} {
+		p := strings.TrimSpace(parts[i])
+		if p == "" {
+			continue
+		}
+		r, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return b, fmt.Errorf("invalid boundary %s: %w", s, err)
+		}
+		*re = r
+	}
+	return b, nil
+}
+
+// Returns true if the call crosses the boundary.
+func (b boundary) crossed(e subsysEdge) bool {
+	return e.CallerSubsys != e.CalleeSubsys &&
+		(b.from == nil || b.from.MatchString(e.CallerSubsys)) && (b.to == nil || b.to.MatchString(e.CalleeSubsys))
+}
+
+// Reads an edge list written by the csv output, or by the tsv one if the file
+// has the .tsv extension.
+func loadEdgeList(fn string) ([]subsysEdge, error) {
+	var res []subsysEdge
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	if strings.HasSuffix(fn, ".tsv") {
+		r.Comma = '\t'
+	}
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(output.EdgeListHeader, ",") {
+		return nil, fmt.Errorf("%s: not an edge list, write the baseline with -m 1 -j csv", fn)
+	}
+	for _, rec := range records[1:] {
+		res = append(res, subsysEdge{rec[0], rec[2], rec[1], rec[3]})
+	}
+	return res, nil
+}
+
+// Compares the edges of the baseline and the current graph. Edges are
+// matched by caller and callee, the subsystems may differ.
+func compareEdges(baseline []subsysEdge, current []subsysEdge, boundaries []boundary) compareResult {
+	res := compareResult{AddedEdges: []subsysEdge{}, RemovedEdges: []subsysEdge{}, Violations: []subsysEdge{}}
+	key := func(e subsysEdge) callEdge { return callEdge{e.Caller, e.Callee} }
+
+	old := map[callEdge]bool{}
+	for _, e := range baseline {
+		old[key(e)] = true
+	}
+	cur := map[callEdge]bool{}
+	for _, e := range current {
+		cur[key(e)] = true
+		if old[key(e)] {
+			continue
+		}
+		res.AddedEdges = append(res.AddedEdges, e)
+		for _, b := range boundaries {
+			if b.crossed(e) {
+				res.Violations = append(res.Violations, e)
+				break
+			}
+		}
+	}
+	for _, e := range baseline {
+		if !cur[key(e)] {
+			res.RemovedEdges = append(res.RemovedEdges, e)
+		}
+	}
+	for _, list := range [][]subsysEdge{res.AddedEdges, res.RemovedEdges, res.Violations} {
+		sortSubsysEdges(list)
+	}
+	return res
+}
+
+// Sorts edges by caller and then callee.
+func sortSubsysEdges(edges []subsysEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Caller != edges[j].Caller {
+			return edges[i].Caller < edges[j].Caller
+		}
+		return edges[i].Callee < edges[j].Callee
+	})
+}
+
+// Renders the comparison in a unified diff like text format, the violations
+// marked with !.
+func (r compareResult) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", r.Baseline, strings.Join(r.Symbols, ","))
+	for _, e := range r.RemovedEdges {
+		fmt.Fprintf(&b, "- edge %s -> %s (%s -> %s)\n", e.Caller, e.Callee, e.CallerSubsys, e.CalleeSubsys)
+	}
+	for _, e := range r.AddedEdges {
+		fmt.Fprintf(&b, "+ edge %s -> %s (%s -> %s)\n", e.Caller, e.Callee, e.CallerSubsys, e.CalleeSubsys)
+	}
+	for _, e := range r.Violations {
+		fmt.Fprintf(&b, "! edge %s -> %s (%s -> %s)\n", e.Caller, e.Callee, e.CallerSubsys, e.CalleeSubsys)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Returns the boundaries of the configuration, any subsystem change if none
+// is given.
+func (conf *configuration) boundaries() ([]boundary, error) {
+	var res []boundary
+
+	for _, s := range conf.Boundaries {
+		b, err := parseBoundary(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	if len(res) == 0 {
+		res = append(res, boundary{})
+	}
+	return res, nil
+}
+
+// Implements the compare command: the output is written anyway, the exit
+// code tells if new calls cross the boundaries.
+func cmdCompareBaseline(db navdb.Conn, conf *configuration) (string, error) {
+	var current []subsysEdge
+
+	boundaries, err := conf.boundaries()
+	if err != nil {
+		return "", err
+	}
+	baseline, err := loadEdgeList(conf.cmdArgs[0])
+	if err != nil {
+		return "", err
+	}
+	g, err := exploreGraph(db, conf, conf.symbolList())
+	if err != nil {
+		return "", err
+	}
+	for _, e := range g.Edges {
+		from, to := g.Nodes[e.From], g.Nodes[e.To]
+		current = append(current, subsysEdge{from.Name, from.Subsys, to.Name, to.Subsys})
+	}
+
+	res := compareEdges(baseline, current, boundaries)
+	res.Symbols = conf.symbolList()
+	res.Baseline = conf.cmdArgs[0]
+	if len(res.Violations) > 0 {
+		conf.violation = exitError{exitBoundaryCrossed, fmt.Errorf("new calls crossing the subsystem boundaries: %d", len(res.Violations))}
+	}
+	if opt2num(conf.Jout) == graphOnly {
+		return res.String(), nil
+	}
+	return jsonResult(cmdCompare, res)
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/output"
+)
+
+const cmdCompletion = "completion"
+
+// Environment variables passing the words of the command line being
+// completed, newline separated, and the index of the word at the cursor.
+const (
+	compWordsEnv = "NAV_COMP_WORDS"
+	compCwordEnv = "NAV_COMP_CWORD"
+)
+
+// Kinds of names looked up in the database.
+const (
+	completeSymbols   = "symbols"
+	completeInstances = "instances"
+)
+
+// Switches telling the database to query, applied to the words typed so far.
+var completionSwitches = map[string]bool{
+	"-f": true, "-i": true, "-u": true, "-p": true, "-d": true, "-b": true, "--sqlite": true,
+	"--sslmode": true, "--sslrootcert": true, "--sslcert": true, "--sslkey": true, "--no-cache": true, "--cache-dir": true,
+}
+
+// Values of the switches taking one of a fixed set.
+var switchChoices = map[string][]string{
+	"-j":           {"graphOnly", "jsonOutputPlain", "jsonOutputB64", "jsonOutputGZB64", "mermaid", "graphml", "csv", "tsv", "ndjson", "tree", "html", "cypher", "plantuml"},
+	"-b":           {navdb.Postgres, navdb.Sqlite},
+	"--strategy":   {strategyDFS, strategyBFS, strategyIDDFS},
+	"--diagram":    {output.SequenceDiagram, output.ActivityDiagram},
+	"--log-format": {logFormatText, logFormatJSON},
+	"--errors":     {errorsText, errorsJSON},
+	"--sslmode":    navdb.SSLModes,
+}
+
+// Completion scripts, delegating to the completion command the candidates
+// of the word at the cursor. Filenames are completed when there is none.
+var completionScripts = map[string]string{
+	"bash": `# nav bash completion, load with: source <(nav completion bash)
+_nav() {
+	local IFS=$'\n'
+	COMPREPLY=($(NAV_COMP_CWORD="$COMP_CWORD" NAV_COMP_WORDS="$(printf '%s\n' "${COMP_WORDS[@]}")" "${COMP_WORDS[0]}" completion complete 2>/dev/null))
+}
+complete -o default -F _nav nav`,
+	"zsh": `#compdef nav
+# nav zsh completion, load with: source <(nav completion zsh), or install as _nav in $fpath
+_nav() {
+	local -a candidates
+	candidates=(${(f)"$(NAV_COMP_CWORD=$((CURRENT - 1)) NAV_COMP_WORDS=${(F)words} ${words[1]} completion complete 2>/dev/null)"})
+	if (( ${#candidates} )); then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+if [ "$funcstack[1]" = "_nav" ]; then
+	_nav "$@"
+else
+	compdef _nav nav
+fi`,
+	"fish": `# nav fish completion, load with: nav completion fish | source
+function __nav_complete
+	set -l words (commandline -opc) (commandline -ct)
+	set -l candidates (env NAV_COMP_CWORD=(math (count $words) - 1) NAV_COMP_WORDS=(string join \n -- $words) $words[1] completion complete 2>/dev/null)
+	if test (count $candidates) -gt 0
+		printf '%s\n' $candidates
+	else
+		__fish_complete_path (commandline -ct)
+	end
+end
+complete -c nav -f -a '(__nav_complete)'`,
+}
+
+// Returns the configuration of the words typed so far, applying only the
+// switches selecting the database and ignoring their errors: the others may
+// be incomplete, or read files.
+func completionConf(words []string) configuration {
+	conf := defaultConfig
+	words, _ = splitLongArgs(words)
+	words, _ = profileSwitch(&conf, words)
+	lines := cmdLineItemInit()
+	for i := 0; i < len(words); i++ {
+		next := i
+		for _, item := range lines {
+			switch {
+			case item.switchStr != words[i]:
+			case item.hasArg && i+1 < len(words):
+				next = i + 1
+				if completionSwitches[words[i]] {
+					item.function(&conf, words[i+1:i+2])
+				}
+			case !item.hasArg && completionSwitches[words[i]]:
+				item.function(&conf, []string{})
+			}
+		}
+		i = next
+	}
+	return conf
+}
+
+// Returns the candidates of the nth argument of a subcommand, from its
+// description: symbols, instances or the listed alternatives.
+func argCandidates(argStr string, n int, lookup func(kind string) []string) []string {
+	args := strings.Fields(argStr)
+	if len(args) == 0 {
+		return nil
+	}
+	if n >= len(args) {
+		n = len(args) - 1
+	}
+	arg := strings.Trim(args[n], "<>[]")
+	switch {
+	case strings.Contains(arg, "|"):
+		return strings.Split(arg, "|")
+	case arg == "symbol" || arg == "target" || arg == "sink":
+		return lookup(completeSymbols)
+	case arg == "instance":
+		return lookup(completeInstances)
+	}
+	return nil
+}
+
+// Returns the candidates for the word at index cword of the command line,
+// the program name first. Names of symbols and instances come from lookup,
+// the candidates of the switches values keep the --switch= prefix if typed.
+func completeWords(words []string, cword int, profiles []string, lookup func(kind string) []string) []string {
+	var candidates []string
+	var prev, cur, prefix string
+
+	if cword < len(words) {
+		cur = words[cword]
+	}
+	if cword > 1 {
+		prev = words[cword-1]
+	}
+	if i := strings.Index(cur, "="); strings.HasPrefix(cur, "--") && i > 0 {
+		prev, prefix, cur = cur[:i], cur[:i+1], cur[i+1:]
+	}
+
+	lines := cmdLineItemInit()
+	hasArg := map[string]bool{}
+	for _, item := range lines {
+		hasArg[item.switchStr] = item.hasArg
+	}
+	switch {
+	case prev == "-s":
+		// Symbols lists are comma separated, the last one is completed.
+		if i := strings.LastIndex(cur, ","); i >= 0 {
+			prefix, cur = prefix+cur[:i+1], cur[i+1:]
+		}
+		candidates = lookup(completeSymbols)
+	case prev == "-i":
+		candidates = lookup(completeInstances)
+	case prev == "--profile":
+		candidates = profiles
+	case hasArg[prev]:
+		candidates = switchChoices[prev]
+	case strings.HasPrefix(cur, "-"):
+		seen := map[string]bool{}
+		for _, item := range lines {
+			if !seen[item.switchStr] {
+				seen[item.switchStr] = true
+				candidates = append(candidates, item.switchStr)
+			}
+		}
+	default:
+		var positional []string
+		for i := 1; i < cword && i < len(words); i++ {
+			if strings.HasPrefix(words[i], "-") {
+				if hasArg[words[i]] {
+					i++
+				}
+				continue
+			}
+			positional = append(positional, words[i])
+		}
+		if len(positional) == 0 {
+			for _, c := range subCmdItemInit() {
+				candidates = append(candidates, c.name)
+			}
+			break
+		}
+		if c, ok := findSubCmd(positional[0]); ok {
+			candidates = argCandidates(c.argStr, len(positional)-1, lookup)
+		}
+	}
+
+	var res []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, cur) {
+			res = append(res, prefix+c)
+		}
+	}
+	return res
+}
+
+// Returns the names of a kind, from the completion cache if fresh or from
+// query, caching them. Entries expire after the configured TTL.
+func cachedNames(conf *configuration, kind string, query func() ([]string, error)) ([]string, error) {
+	var names []string
+
+	dir, err := cacheDir(conf)
+	if conf.NoCache || err != nil {
+		return query()
+	}
+	key, _ := json.Marshal(struct {
+		DB       [5]string
+		DBPort   int
+		Instance int
+		Kind     string
+	}{[5]string{conf.DBDriver, conf.DBUrl, conf.DBUser, conf.DBTargetDB, conf.DBFile}, conf.DBPort, conf.Instance, kind})
+	sum := sha256.Sum256(key)
+	fn := filepath.Join(dir, "complete-"+hex.EncodeToString(sum[:])+".json")
+
+	if st, err := os.Stat(fn); err == nil && (conf.CacheTTL <= 0 || time.Since(st.ModTime()) < time.Duration(conf.CacheTTL)*time.Second) {
+		if b, err := os.ReadFile(fn); err == nil && json.Unmarshal(b, &names) == nil {
+			return names, nil
+		}
+	}
+	names, err = query()
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(names)
+	if err == nil && os.MkdirAll(dir, 0755) == nil {
+		tmp := fn + ".tmp"
+		if os.WriteFile(tmp, b, 0644) == nil {
+			os.Rename(tmp, fn)
+		}
+	}
+	return names, nil
+}
+
+// Returns the names of the symbols of the instance or of the instances.
+func queryNames(db navdb.Conn, conf *configuration, kind string) ([]string, error) {
+	if kind == completeSymbols {
+		return queryColumn(db, "select distinct symbol_name from symbols where symbol_instance_id_ref=$1 order by symbol_name", conf.Instance)
+	}
+	return queryColumn(db, "select instance_id from instances order by instance_id")
+}
+
+// Completes the command line passed in the environment. Failures, e.g. of
+// the database connection, yield no candidates rather than errors, which
+// the shell would show as such.
+func completeEnv() string {
+	words := strings.Split(strings.TrimSuffix(os.Getenv(compWordsEnv), "\n"), "\n")
+	cword, err := strconv.Atoi(os.Getenv(compCwordEnv))
+	if err != nil || cword < 1 {
+		return ""
+	}
+	for len(words) <= cword {
+		words = append(words, "")
+	}
+	// Bash splits --switch=value in three words.
+	for i := 1; i < len(words) && i < cword; i++ {
+		if words[i] == "=" && strings.HasPrefix(words[i-1], "--") {
+			words = append(words[:i:i], words[i+1:]...)
+			cword--
+		}
+	}
+
+	conf := completionConf(words[1:cword])
+	conf.DBRetries = 0
+	var profiles []string
+	for p := range conf.Profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Strings(profiles)
+
+	var db navdb.Conn
+	lookup := func(kind string) []string {
+		names, _ := cachedNames(&conf, kind, func() ([]string, error) {
+			if db == nil {
+				if db, err = connectConf(context.Background(), &conf); err != nil {
+					return nil, err
+				}
+			}
+			return queryNames(db, &conf, kind)
+		})
+		return names
+	}
+	res := completeWords(words, cword, profiles, lookup)
+	if db != nil {
+		db.Close()
+	}
+	return strings.Join(res, "\n")
+}
+
+// Implements the completion command: prints the completion script of a
+// shell, or the candidates of the command line passed by the script.
+func cmdShellCompletion(_ navdb.Conn, conf *configuration) (string, error) {
+	if conf.cmdArgs[0] == "complete" {
+		return completeEnv(), nil
+	}
+	script, ok := completionScripts[conf.cmdArgs[0]]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %s, expected bash, zsh or fish", conf.cmdArgs[0])
+	}
+	return script, nil
+}
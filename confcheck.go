@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdConfig = "config"
+
+// Sources of the configuration values.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceProfile = "profile"
+	sourceCmdLine = "command line"
+)
+
+// Effective value of a configuration key, with where it comes from.
+type configValue struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Returns the exported fields of the configuration, the keys of the file.
+func configKeys() []reflect.StructField {
+	var res []reflect.StructField
+
+	t := reflect.TypeOf(configuration{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			res = append(res, t.Field(i))
+		}
+	}
+	return res
+}
+
+// Returns the edit distance between two strings.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+// Returns the field a key of the configuration file sets, matched ignoring
+// case as the decoder does, or the closest field if none.
+func configKeyName(k string) (string, string) {
+	hint := ""
+	best := 3
+	for _, f := range configKeys() {
+		if strings.EqualFold(f.Name, k) {
+			return f.Name, ""
+		}
+		if d := editDistance(strings.ToLower(f.Name), strings.ToLower(k)); d < best {
+			best, hint = d, f.Name
+		}
+	}
+	return "", hint
+}
+
+// Checks the keys of a configuration file, or of one of its profiles, and
+// returns the fields they set along with the unknown ones.
+func checkConfigKeys(raw map[string]interface{}, where string) (map[string]bool, []string) {
+	var problems []string
+
+	keys := map[string]bool{}
+	var names []string
+	for k := range raw {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		name, hint := configKeyName(k)
+		if name == "" {
+			if hint != "" {
+				hint = fmt.Sprintf(", did you mean %s?", hint)
+			}
+			problems = append(problems, fmt.Sprintf("unknown key %s%s%s", k, where, hint))
+			continue
+		}
+		keys[name] = true
+	}
+	return keys, problems
+}
+
+// Reads the keys of a configuration file and of the ones it includes, and
+// reports the unknown ones, also in the profiles, along with the closest
+// known key. Values of the wrong type already failed the parsing.
+func readConfigKeys(fn string) (map[string]bool, []string, error) {
+	raw, err := loadConfigFile(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, problems := checkConfigKeys(raw, "")
+	for k, v := range raw {
+		if name, _ := configKeyName(k); name != "Profiles" {
+			continue
+		}
+		profiles, _ := v.(map[string]interface{})
+		var names []string
+		for p := range profiles {
+			names = append(names, p)
+		}
+		sort.Strings(names)
+		for _, p := range names {
+			if profile, ok := profiles[p].(map[string]interface{}); ok {
+				_, unknown := checkConfigKeys(profile, " in profile "+p)
+				problems = append(problems, unknown...)
+			}
+		}
+	}
+	return keys, problems, nil
+}
+
+// Checks the configuration file and the resulting configuration.
+func checkConfig(conf *configuration) error {
+	var problems []string
+
+	if conf.configFile != "" {
+		var err error
+		if _, problems, err = readConfigKeys(conf.configFile); err != nil {
+			return err
+		}
+	}
+	c := *conf
+	if err := c.validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// Returns the effective configuration with the source of each value: a value
+// differing from the one of the file and profile, or of the default if they
+// do not set it, comes from the command line.
+func effectiveConfig(conf *configuration) ([]configValue, error) {
+	var res []configValue
+
+	fileConf := defaultConfig
+	keys := map[string]bool{}
+	if conf.configFile != "" {
+		raw, err := loadConfigFile(conf.configFile)
+		if err != nil {
+			return nil, err
+		}
+		if keys, _, err = readConfigKeys(conf.configFile); err != nil {
+			return nil, err
+		}
+		if err := applyConfigKeys(&fileConf, raw); err != nil {
+			return nil, err
+		}
+	}
+	profileKeys := map[string]bool{}
+	if conf.Profile != "" {
+		for k := range conf.Profiles[conf.Profile] {
+			name, _ := configKeyName(k)
+			profileKeys[name] = true
+		}
+		fileConf.Profile = conf.Profile
+		if err := fileConf.applyProfile(); err != nil {
+			return nil, err
+		}
+	}
+	v, fv := reflect.ValueOf(*conf), reflect.ValueOf(fileConf)
+	for _, f := range configKeys() {
+		source := sourceDefault
+		switch {
+		case profileKeys[f.Name]:
+			source = sourceProfile
+		case keys[f.Name]:
+			source = sourceFile
+		}
+		value := v.FieldByName(f.Name).Interface()
+		if !reflect.DeepEqual(value, fv.FieldByName(f.Name).Interface()) || (f.Name == "Profile" && conf.cliProfile != "") {
+			source = sourceCmdLine
+		}
+		if f.Name == "DBPassword" && value != defaultConfig.DBPassword {
+			value = "<redacted>"
+		}
+		res = append(res, configValue{f.Name, value, source})
+	}
+	return res, nil
+}
+
+// Implements the config command: check validates the configuration file and
+// options, show prints the effective configuration.
+func cmdConfiguration(_ navdb.Conn, conf *configuration) (string, error) {
+	switch conf.cmdArgs[0] {
+	case "check":
+		if err := checkConfig(conf); err != nil {
+			return "", err
+		}
+		if opt2num(conf.Jout) != graphOnly {
+			return jsonResult(cmdConfig, "ok")
+		}
+		return "configuration ok", nil
+	case "show":
+		values, err := effectiveConfig(conf)
+		if err != nil {
+			return "", err
+		}
+		if opt2num(conf.Jout) != graphOnly {
+			return jsonResult(cmdConfig, values)
+		}
+		lines := []string{"key\tvalue\tsource"}
+		for _, v := range values {
+			b, _ := json.Marshal(v.Value)
+			lines = append(lines, fmt.Sprintf("%s\t%s\t%s", v.Key, b, v.Source))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	return "", fmt.Errorf("unknown config action %s, expected check or show", conf.cmdArgs[0])
+}
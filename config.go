@@ -6,12 +6,18 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/output"
 )
 
 const (
@@ -23,6 +29,8 @@ const DBPortNumber = 5432
 
 type argFunc func(*configuration, []string) error
 
+type cmdFunc func(navdb.Conn, *configuration) (string, error)
+
 // Command line switch elements.
 type cmdLineItems struct {
 	function  argFunc
@@ -33,20 +41,96 @@ type cmdLineItems struct {
 	needed    bool
 }
 
+// Subcommand elements.
+type subCmdItems struct {
+	function cmdFunc
+	name     string
+	argStr   string
+	helpStr  string
+	needs    []string
+	nargs    int
+	needsDB  bool
+}
+
 // Represents the application configuration.
 type configuration struct {
 	cmdlineNeeds   map[string]bool
+	cliSymbols     []string
+	command        string
+	cmdArgs        []string
+	addr           string
+	configFile     string
+	truncated      error
+	violation      error
+	resume         *resumeToken
+	resumeArg      string
+	startIds       map[string]int
+	cliProfile     string
+	Profile        string
+	Profiles       map[string]map[string]interface{}
 	DBTargetDB     string
 	DBUrl          string
 	DBUser         string
 	DBPassword     string
+	DBDriver       string
+	DBFile         string
+	DBRetryDelay   string
+	DBSSLMode      string
+	DBSSLRootCert  string
+	DBSSLCert      string
+	DBSSLKey       string
+	DBRetries      int
+	DBPoolSize     int
+	DBQueryTimeout string
 	Symbol         string
+	Symbols        []string
+	SplitDir       string
+	OutFile        string
+	Compress       bool
+	CacheDir       string
+	NoCache        bool
+	CacheTTL       int
+	ThinDepth      int
+	Parallel       int
+	RecursiveQuery bool
+	Timeout        string
+	LogFormat      string
+	Errors         string
+	LogFile        string
+	LogLevel       int
+	Quiet          bool
+	Match          string
+	ExploreMatches bool
 	Jout           string
 	ExcludedBefore []string
 	ExcludedAfter  []string
+	IncludeOnly    []string
+	Kconfig        map[string]string
+	FollowIndirect bool
+	Visibility     string
+	Namespace      string
+	Module         string
+	Overlay        string
+	Coverage       string
+	Maintainers    string
+	Template       string
+	SrcTree        string
+	SrcURL         string
+	Snippet        bool
 	TargetSubsys   []string
+	Boundaries     []string
+	ReportCycles   bool
+	Top            int
+	Paths          int
+	Weights        string
 	Instance       int
 	MaxDepth       int
+	MaxNodes       int
+	MaxEdges       int
+	Strategy       string
+	Diagram        string
+	Dedup          bool
+	Resumable      bool
 	Mode           outMode
 	DBPort         int
 }
@@ -58,13 +142,66 @@ var defaultConfig = configuration{
 	DBUser:         "alessandro",
 	DBPassword:     "<password>",
 	DBTargetDB:     "kernel_bin",
+	DBDriver:       navdb.Postgres,
+	DBFile:         "",
+	DBRetries:      3,
+	DBRetryDelay:   "500ms",
+	DBPoolSize:     0,
+	DBQueryTimeout: "",
+	DBSSLMode:      "disable",
+	DBSSLRootCert:  "",
+	DBSSLCert:      "",
+	DBSSLKey:       "",
+	Profile:        "",
 	Symbol:         "",
+	Symbols:        []string{},
+	SplitDir:       "",
+	OutFile:        "",
+	Compress:       false,
+	CacheDir:       "",
+	NoCache:        false,
+	CacheTTL:       defaultCacheTTL,
+	ThinDepth:      0,
+	Parallel:       1,
+	RecursiveQuery: false,
+	Timeout:        "",
+	LogFormat:      logFormatText,
+	Errors:         errorsText,
+	LogFile:        "",
+	LogLevel:       logQuiet,
+	Quiet:          false,
+	Match:          "",
+	ExploreMatches: false,
 	Instance:       0,
 	Mode:           printSubsys,
 	ExcludedBefore: []string{},
 	ExcludedAfter:  []string{},
+	IncludeOnly:    []string{},
+	Kconfig:        map[string]string{},
+	FollowIndirect: false,
+	Visibility:     "",
+	Namespace:      "",
+	Module:         "",
+	Overlay:        "",
+	Coverage:       "",
+	Maintainers:    "",
+	Template:       "",
+	SrcTree:        "",
+	SrcURL:         "",
+	Snippet:        false,
 	TargetSubsys:   []string{},
+	Boundaries:     []string{},
+	ReportCycles:   false,
+	Top:            10,
+	Paths:          1,
+	Weights:        "",
 	MaxDepth:       0, //0: no limit
+	MaxNodes:       0,
+	MaxEdges:       0,
+	Strategy:       strategyDFS,
+	Diagram:        output.SequenceDiagram,
+	Dedup:          false,
+	Resumable:      false,
 	Jout:           "graphOnly",
 	cmdlineNeeds:   map[string]bool{},
 }
@@ -85,20 +222,126 @@ func cmdLineItemInit() []cmdLineItems {
 	var res []cmdLineItems
 
 	pushCmdLineItem("-j", "Force Json output with subsystems data", true, false, funcOutType, &res)
-	pushCmdLineItem("-s", "Specifies symbol", true, true, funcSymbol, &res)
+	pushCmdLineItem("-s", "Specifies symbol, can be repeated or comma separated", true, true, funcSymbol, &res)
+	pushCmdLineItem("--addr", "Starts from the symbol containing the specified address, e.g. 0xffffffff81234567", true, false, funcAddr, &res)
+	pushCmdLineItem("-S", "Reads symbols list from file, - for stdin", true, false, funcSymbolFile, &res)
+	pushCmdLineItem("--split-dir", "Writes one output file per symbol in the specified directory", true, false, funcSplitDir, &res)
+	pushCmdLineItem("--regex", "Treats symbols as regular expressions and lists the matches", false, false, funcRegex, &res)
+	pushCmdLineItem("--glob", "Treats symbols as glob patterns and lists the matches", false, false, funcGlob, &res)
+	pushCmdLineItem("--explore-matches", "Explores the symbols matching a regex or glob instead of listing them", false, false, funcExploreMatches, &res)
 	pushCmdLineItem("-i", "Specifies instance", true, true, funcInstance, &res)
-	pushCmdLineItem("-f", "Specifies config file", true, false, funcJconf, &res)
+	pushCmdLineItem("-f", "Specifies config file, JSON, YAML or TOML by extension", true, false, funcJconf, &res)
+	pushCmdLineItem("--profile", "Applies the named profile of the config file, switches override it", true, false, funcProfile, &res)
 	pushCmdLineItem("-u", "Forces use specified database userid", true, false, funcDBUser, &res)
 	pushCmdLineItem("-p", "Forces use specified password", true, false, funcDBPass, &res)
 	pushCmdLineItem("-d", "Forces use specified DBHost", true, false, funcDBHost, &res)
 	pushCmdLineItem("-p", "Forces use specified DBPort", true, false, funcDBPort, &res)
-	pushCmdLineItem("-m", "Sets display mode 2=subsystems,1=all", true, false, funcMode, &res)
+	pushCmdLineItem("-b", "Specifies database backend postgres or sqlite", true, false, funcDBDriver, &res)
+	pushCmdLineItem("--sqlite", "Uses the specified SQLite database file", true, false, funcDBFile, &res)
+	pushCmdLineItem("--sslmode", "Specifies postgres sslmode: disable, require, verify-ca, verify-full", true, false, funcSSLMode, &res)
+	pushCmdLineItem("--sslrootcert", "Specifies the CA certificate used to verify the server", true, false, funcSSLRootCert, &res)
+	pushCmdLineItem("--sslcert", "Specifies the client certificate", true, false, funcSSLCert, &res)
+	pushCmdLineItem("--sslkey", "Specifies the client certificate key", true, false, funcSSLKey, &res)
+	pushCmdLineItem("--retries", "Number of retries of queries failing for transient errors", true, false, funcDBRetries, &res)
+	pushCmdLineItem("--retry-delay", "Delay before the first retry, doubled at each attempt, e.g. 500ms", true, false, funcDBRetryDelay, &res)
+	pushCmdLineItem("--pool-size", "Max number of database connections open at the same time, 0 for no limit", true, false, funcDBPoolSize, &res)
+	pushCmdLineItem("--query-timeout", "Cancels the postgres queries running longer than the specified duration, e.g. 30s", true, false, funcDBQueryTimeout, &res)
+	pushCmdLineItem("-m", "Sets display mode 2=subsystems,1=all,5=subsystems aggregated", true, false, funcMode, &res)
 	pushCmdLineItem("-x", "Specify Max depth in call flow exploration", true, false, funcDepth, &res)
+	pushCmdLineItem("--max-nodes", "Stops adding functions to the graph once they are the specified number, 0 no limit", true, false, funcMaxNodes, &res)
+	pushCmdLineItem("--max-edges", "Stops adding calls to the graph once they are the specified number, 0 no limit", true, false, funcMaxEdges, &res)
+	pushCmdLineItem("--resumable", "Appends to the output a token resuming the exploration from the functions cut by the depth limit or the budget", false, false, funcResumable, &res)
+	pushCmdLineItem("--resume", "Continues the exploration of a resume token, read from a file if @file or stdin if -, from its frontier or the frontier functions given with -s", true, false, funcResume, &res)
+	pushCmdLineItem("--dedup", "Expands shared subtrees once in the tree output, referring to them afterwards", false, false, funcDedup, &res)
+	pushCmdLineItem("--strategy", "Specifies traversal strategy: dfs, bfs or iddfs", true, false, funcStrategy, &res)
+	pushCmdLineItem("--diagram", "Specifies the PlantUML diagram of -j plantuml: sequence or activity", true, false, funcDiagram, &res)
+	pushCmdLineItem("-o", "Writes the output in the specified file, .svg and .png files get the rendered graph", true, false, funcOutFile, &res)
+	pushCmdLineItem("--compress", "Compresses the output with gzip", false, false, funcCompress, &res)
+	pushCmdLineItem("--thin-depth", "Draws thinner edges beyond the specified depth in rendered graphs", true, false, funcThinDepth, &res)
+	pushCmdLineItem("--parallel", "Number of concurrent database lookups during the exploration", true, false, funcParallel, &res)
+	pushCmdLineItem("--recursive-query", "Fetches the calls reachable within the max depth with a single recursive query", false, false, funcRecursiveQuery, &res)
+	pushCmdLineItem("--timeout", "Stops the exploration after the specified duration, e.g. 90s, and prints the partial output", true, false, funcTimeout, &res)
+	pushCmdLineItem("--no-cache", "Does not use the on disk results cache", false, false, funcNoCache, &res)
+	pushCmdLineItem("--cache-dir", "Specifies the results cache directory", true, false, funcCacheDir, &res)
+	pushCmdLineItem("-l", "Lists the available instances, same as the instances command", false, false, funcListInstances, &res)
+	pushCmdLineItem("--exclude-before", "Adds a regex of symbols not to be displayed nor explored, can be repeated", true, false, funcExcludeBefore, &res)
+	pushCmdLineItem("--exclude-after", "Adds a regex of symbols displayed but not explored, can be repeated", true, false, funcExcludeAfter, &res)
+	pushCmdLineItem("--include-only", "Adds a regex of symbols or subsystems to be exclusively displayed, can be repeated", true, false, funcIncludeOnly, &res)
+	pushCmdLineItem("--boundary", "Adds a subsystem boundary the compare command guards, from->to regexes of the caller and callee subsystems, can be repeated", true, false, funcBoundary, &res)
+	pushCmdLineItem("--report-cycles", "Lists the recursions met during the exploration", false, false, funcReportCycles, &res)
+	pushCmdLineItem("--top", "Number of symbols reported by the stats command for a subsystem, 0 for all", true, false, funcTop, &res)
+	pushCmdLineItem("--paths", "Number of call chains reported by the paths command", true, false, funcPaths, &res)
+	pushCmdLineItem("--weights", "Ranks the paths command call chains by the function and call weights of the specified file", true, false, funcWeights, &res)
+	pushCmdLineItem("--follow-indirect", "Follows the indirect calls resolved by the extractor, e.g. through ops structures", false, false, funcFollowIndirect, &res)
+	pushCmdLineItem("--overlay", "Colors the functions and calls seen in an ftrace function_graph or perf script capture", true, false, funcOverlay, &res)
+	pushCmdLineItem("--coverage", "Marks the functions as covered or not by an lcov .info report and lists the uncovered ones", true, false, funcCoverageReport, &res)
+	pushCmdLineItem("--maintainers", "Specifies the MAINTAINERS file the subsys command maps subsystems to", true, false, funcMaintainers, &res)
+	pushCmdLineItem("--src", "Specifies the kernel source tree, or the base URL of its web browser, e.g. elixir, linking the functions to their definition; can be given once of each", true, false, funcSrc, &res)
+	pushCmdLineItem("--snippet", "Shows the source of the function in the info and tui commands, read from the --src tree", false, false, funcSnippet, &res)
+	pushCmdLineItem("--schema", "Prints the JSON Schema of the JSON outputs", false, false, funcSchema, &res)
+	pushCmdLineItem("--template", "Formats the output with the specified Go text/template file", true, false, funcTemplate, &res)
+	pushCmdLineItem("--config", "Sets a kernel option state, e.g. CONFIG_FOO=off drops the code built only with it, can be repeated", true, false, funcKconfig, &res)
+	pushCmdLineItem("--visibility", "Displays only the functions exported, exported GPL only or static: exported, gpl or static", true, false, funcVisibility, &res)
+	pushCmdLineItem("--namespace", "Displays only the functions exported in the specified module namespace", true, false, funcNamespace, &res)
+	pushCmdLineItem("--module", "Restricts the exploration to the functions of the specified kernel module, vmlinux for the built in ones", true, false, funcModule, &res)
+	pushCmdLineItem("-v", "Logs visited nodes and filter decisions", false, false, funcVerbose, &res)
+	pushCmdLineItem("-vv", "Logs also queries and fetched rows", false, false, funcVeryVerbose, &res)
+	pushCmdLineItem("--log-format", "Specifies log format: text or json", true, false, funcLogFormat, &res)
+	pushCmdLineItem("--errors", "Specifies errors format: text, or json printing a JSON object on stderr", true, false, funcErrors, &res)
+	pushCmdLineItem("--log-file", "Writes the log to the specified file instead of stderr", true, false, funcLogFile, &res)
+	pushCmdLineItem("--quiet", "Does not show the exploration progress", false, false, funcQuiet, &res)
 	pushCmdLineItem("-h", "This help", false, false, funcHelp, &res)
 
 	return res
 }
 
+// Inserts a subcommand, which is composed by:
+// * the command name and the description of its positional arguments
+// * the command description
+// * the switches the command requires
+// * the number of positional arguments, -1 for any
+// * if the command needs the database connection
+// * a pointer to the function that implements the command.
+func pushSubCmdItem(name string, argStr string, helpStr string, needs []string, nargs int, needsDB bool, function cmdFunc, cmds *[]subCmdItems) {
+	*cmds = append(*cmds, subCmdItems{name: name, argStr: argStr, helpStr: helpStr, needs: needs, nargs: nargs, needsDB: needsDB, function: function})
+}
+
+// Inserts all the subcommands supported by the application.
+// With no subcommand, the call graph is generated.
+func subCmdItemInit() []subCmdItems {
+	var res []subCmdItems
+
+	pushSubCmdItem(cmdInstances, "", "Lists the available instances and their metadata", nil, 0, true, cmdListInstances, &res)
+	pushSubCmdItem(cmdDiff, "<instance> <instance>", "Compares the call graph of the symbol between two instances", []string{"-s"}, 2, true, cmdInstanceDiff, &res)
+	pushSubCmdItem(cmdInfo, "<symbol>", "Prints everything the database knows about a symbol", nil, 1, true, cmdSymbolInfo, &res)
+	pushSubCmdItem(cmdTrace, "[file]", "Annotates an oops or warning stack trace read from file or stdin", nil, -1, true, cmdTraceAnnotate, &res)
+	pushSubCmdItem(cmdStats, "[subsystem]", "Reports fan-in, fan-out, reachable set, depth and subsystems spread of the symbol or of the top symbols of a subsystem", nil, -1, true, cmdSymbolStats, &res)
+	pushSubCmdItem(cmdSearch, "", "Lists the instances defining the symbol, with their metadata", []string{"-s"}, 0, true, cmdSearchInstances, &res)
+	pushSubCmdItem(cmdSCC, "", "Lists the strongly connected components of the call tree of the symbol", []string{"-s"}, 0, true, cmdSCCs, &res)
+	pushSubCmdItem(cmdSchema, "", "Prints the JSON Schema of the JSON outputs", nil, 0, false, cmdPrintSchema, &res)
+	pushSubCmdItem(cmdSets, "<union|intersection|difference>", "Combines the call graphs of the symbols, tagging each function with the symbols reaching it", []string{"-s"}, 1, true, cmdGraphSets, &res)
+	pushSubCmdItem(cmdModules, "", "Lists the calls of the call tree of the symbol crossing kernel module boundaries", []string{"-s"}, 0, true, cmdModuleEdges, &res)
+	pushSubCmdItem(cmdSubsys, "<subsystem>", "Lists the symbols of the subsystem, with its MAINTAINERS entry if --maintainers is given", nil, 1, true, cmdSubsysContents, &res)
+	pushSubCmdItem(cmdPaths, "<target>", "Lists the shortest call chains from the symbol to the target", []string{"-s"}, 1, true, cmdCallPaths, &res)
+	pushSubCmdItem(cmdConfig, "<check|show>", "Validates the configuration file and options, or prints the effective configuration with the source of each value", nil, 1, false, cmdConfiguration, &res)
+	pushSubCmdItem(cmdCompletion, "<bash|zsh|fish>", "Prints the shell completion script, which also completes symbols and instances from the database", nil, 1, false, cmdShellCompletion, &res)
+	pushSubCmdItem(cmdCompare, "<baseline>", "Compares the call graph of the symbol with a baseline edge list, failing if new calls cross the subsystem boundaries", []string{"-s"}, 1, true, cmdCompareBaseline, &res)
+	pushSubCmdItem(cmdTui, "", "Explores the call tree of the symbol in a full screen terminal interface", []string{"-s"}, 0, true, cmdExploreTui, &res)
+	pushSubCmdItem(cmdDominators, "[sink]", "Prints the dominator tree of the call tree of the symbol, or the dominators of the sink", []string{"-s"}, -1, true, cmdDominatorTree, &res)
+
+	return res
+}
+
+// Returns the subcommand with the given name.
+func findSubCmd(name string) (subCmdItems, bool) {
+	for _, c := range subCmdItemInit() {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return subCmdItems{}, false
+}
+
 func funcHelp(conf *configuration, fn []string) error {
 	return errors.New("command help")
 }
@@ -109,30 +352,440 @@ func funcOutType(conf *configuration, jout []string) error {
 }
 
 func funcJconf(conf *configuration, fn []string) error {
-	jsonFile, err := os.Open(fn[0])
+	keys, err := loadConfigFile(fn[0])
 	if err != nil {
 		return err
 	}
-	defer func() {
-		closeErr := jsonFile.Close()
-		if err == nil {
-			err = closeErr
+	// Reuses the decoder of the JSON files, so that all formats match the
+	// keys and check the types alike.
+	if err := applyConfigKeys(conf, keys); err != nil {
+		return fmt.Errorf("%s: %w", fn[0], err)
+	}
+	conf.configFile = fn[0]
+	// The profile on the command line wins over the one of the file.
+	if conf.cliProfile != "" {
+		conf.Profile = conf.cliProfile
+	}
+	return conf.applyProfile()
+}
+
+func funcProfile(conf *configuration, name []string) error {
+	conf.cliProfile = name[0]
+	conf.Profile = name[0]
+	return nil
+}
+
+// Applies the selected profile, if any, over the configuration file. An
+// unknown profile is left to the validation, another file may define it.
+func (conf *configuration) applyProfile() error {
+	keys, ok := conf.Profiles[conf.Profile]
+	if conf.Profile == "" || !ok {
+		return nil
+	}
+	for k := range keys {
+		if strings.EqualFold(k, "Profile") || strings.EqualFold(k, "Profiles") {
+			return fmt.Errorf("profile %s can't select profiles", conf.Profile)
 		}
-	}()
+	}
+	if err := applyConfigKeys(conf, keys); err != nil {
+		return fmt.Errorf("profile %s: %w", conf.Profile, err)
+	}
+	return nil
+}
+
+// Applies the profile switch and returns the other arguments. The profile
+// applies along with the configuration file, wherever the switch appears.
+func profileSwitch(conf *configuration, args []string) ([]string, error) {
+	var res []string
+
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--profile" || i+1 == len(args) {
+			res = append(res, args[i])
+			continue
+		}
+		if err := funcProfile(conf, args[i+1:i+2]); err != nil {
+			return nil, err
+		}
+		i++
+	}
+	return res, nil
+}
+
+// Splits a comma separated symbols list. Commas within brackets, braces or
+// parentheses belong to the patterns, e.g. the regex foo_{1,3} or [a,b].
+func splitSymbols(s string) []string {
+	var res []string
+
+	depth, start := 0, 0
+	for i, c := range s {
+		switch {
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case (c == ')' || c == ']' || c == '}') && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, s[start:])
+}
+
+func funcSymbol(conf *configuration, fn []string) error {
+	for _, symbol := range splitSymbols(fn[0]) {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			conf.cliSymbols = append(conf.cliSymbols, symbol)
+		}
+	}
+	if len(conf.cliSymbols) == 0 {
+		return errors.New("empty symbol")
+	}
+	conf.Symbol = conf.cliSymbols[0]
+	return nil
+}
 
-	byteValue, _ := io.ReadAll(jsonFile)
-	err = json.Unmarshal(byteValue, conf)
+// Reads a symbol list, one per line. Empty lines and lines starting with # are ignored.
+func funcSymbolFile(conf *configuration, fn []string) error {
+	var in io.Reader = os.Stdin
+
+	if fn[0] != "-" {
+		f, err := os.Open(fn[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		conf.cliSymbols = append(conf.cliSymbols, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(conf.cliSymbols) == 0 {
+		return errors.New("empty symbol list")
+	}
+	conf.Symbol = conf.cliSymbols[0]
+	conf.cmdlineNeeds["-s"] = true
+	return nil
+}
+
+func funcResumable(conf *configuration, _ []string) error {
+	conf.Resumable = true
+	return nil
+}
+
+// Reads a resume token given as is, from a file if prefixed by @, or from
+// stdin if -, as the tokens of large explorations exceed the argument size
+// limit.
+func funcResume(conf *configuration, arg []string) error {
+	token := arg[0]
+	if token == "-" || strings.HasPrefix(token, "@") {
+		var b []byte
+		var err error
+		if token == "-" {
+			b, err = io.ReadAll(os.Stdin)
+		} else {
+			b, err = os.ReadFile(strings.TrimPrefix(token, "@"))
+		}
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	t, err := parseResumeToken(token)
 	if err != nil {
 		return err
 	}
+	conf.resume = t
+	conf.resumeArg = token
+	conf.cmdlineNeeds["-s"] = true
 	return nil
 }
 
-func funcSymbol(conf *configuration, fn []string) error {
-	conf.Symbol = fn[0]
+func funcAddr(conf *configuration, addr []string) error {
+	if _, err := parseAddr(addr[0]); err != nil {
+		return fmt.Errorf("invalid address %s", addr[0])
+	}
+	conf.addr = addr[0]
+	conf.cmdlineNeeds["-s"] = true
+	return nil
+}
+
+func funcRegex(conf *configuration, _ []string) error {
+	conf.Match = matchRegex
+	return nil
+}
+
+func funcGlob(conf *configuration, _ []string) error {
+	conf.Match = matchGlob
+	return nil
+}
+
+func funcExploreMatches(conf *configuration, _ []string) error {
+	conf.ExploreMatches = true
+	return nil
+}
+
+func funcListInstances(conf *configuration, _ []string) error {
+	conf.command = cmdInstances
+	return nil
+}
+
+func funcExcludeBefore(conf *configuration, re []string) error {
+	conf.ExcludedBefore = append(conf.ExcludedBefore, re[0])
+	return nil
+}
+
+func funcExcludeAfter(conf *configuration, re []string) error {
+	conf.ExcludedAfter = append(conf.ExcludedAfter, re[0])
+	return nil
+}
+
+func funcIncludeOnly(conf *configuration, re []string) error {
+	conf.IncludeOnly = append(conf.IncludeOnly, re[0])
+	return nil
+}
+
+func funcFollowIndirect(conf *configuration, _ []string) error {
+	conf.FollowIndirect = true
 	return nil
 }
 
+func funcOverlay(conf *configuration, fn []string) error {
+	conf.Overlay = fn[0]
+	return nil
+}
+
+func funcMaintainers(conf *configuration, fn []string) error {
+	conf.Maintainers = fn[0]
+	return nil
+}
+
+func funcCoverageReport(conf *configuration, fn []string) error {
+	conf.Coverage = fn[0]
+	return nil
+}
+
+func funcSchema(conf *configuration, _ []string) error {
+	conf.command = cmdSchema
+	return nil
+}
+
+func funcTemplate(conf *configuration, fn []string) error {
+	conf.Template = fn[0]
+	return nil
+}
+
+func funcSrc(conf *configuration, src []string) error {
+	if strings.HasPrefix(src[0], "http://") || strings.HasPrefix(src[0], "https://") {
+		conf.SrcURL = src[0]
+		return nil
+	}
+	conf.SrcTree = src[0]
+	return nil
+}
+
+func funcSnippet(conf *configuration, _ []string) error {
+	conf.Snippet = true
+	return nil
+}
+
+func funcKconfig(conf *configuration, opt []string) error {
+	name, value, err := parseKconfig(opt[0])
+	if err != nil {
+		return err
+	}
+	kconfig := map[string]string{name: value}
+	for k, v := range conf.Kconfig {
+		if k != name {
+			kconfig[k] = v
+		}
+	}
+	conf.Kconfig = kconfig
+	return nil
+}
+
+// Checks all the filter regular expressions compile, and the config filters
+// are valid, normalizing their values.
+func (conf *configuration) validateFilters() error {
+	for _, list := range [][]string{conf.ExcludedBefore, conf.ExcludedAfter, conf.IncludeOnly} {
+		for _, re := range list {
+			if _, err := regexp.Compile(re); err != nil {
+				return fmt.Errorf("invalid filter %s: %w", re, err)
+			}
+		}
+	}
+	kconfig := map[string]string{}
+	for k, v := range conf.Kconfig {
+		name, value, err := parseKconfig(k + "=" + v)
+		if err != nil {
+			return err
+		}
+		kconfig[name] = value
+	}
+	conf.Kconfig = kconfig
+	return nil
+}
+
+func funcOutFile(conf *configuration, fn []string) error {
+	conf.OutFile = fn[0]
+	return nil
+}
+
+func funcCompress(conf *configuration, _ []string) error {
+	conf.Compress = true
+	return nil
+}
+
+func funcThinDepth(conf *configuration, depth []string) error {
+	s, err := strconv.Atoi(depth[0])
+	if err != nil {
+		return err
+	}
+	if s < 0 {
+		return errors.New("thin depth must be >= 0")
+	}
+	conf.ThinDepth = s
+	return nil
+}
+
+func funcParallel(conf *configuration, n []string) error {
+	s, err := strconv.Atoi(n[0])
+	if err != nil {
+		return err
+	}
+	if s < 1 {
+		return errors.New("parallel must be >= 1")
+	}
+	conf.Parallel = s
+	return nil
+}
+
+func funcRecursiveQuery(conf *configuration, _ []string) error {
+	conf.RecursiveQuery = true
+	return nil
+}
+
+func funcTimeout(conf *configuration, timeout []string) error {
+	conf.Timeout = timeout[0]
+	return nil
+}
+
+func funcNoCache(conf *configuration, _ []string) error {
+	conf.NoCache = true
+	return nil
+}
+
+func funcCacheDir(conf *configuration, dir []string) error {
+	conf.CacheDir = dir[0]
+	return nil
+}
+
+func funcBoundary(conf *configuration, b []string) error {
+	conf.Boundaries = append(conf.Boundaries, b[0])
+	return nil
+}
+
+func funcReportCycles(conf *configuration, _ []string) error {
+	conf.ReportCycles = true
+	return nil
+}
+
+func funcTop(conf *configuration, n []string) error {
+	s, err := strconv.Atoi(n[0])
+	if err != nil {
+		return err
+	}
+	if s < 0 {
+		return errors.New("top must be >= 0")
+	}
+	conf.Top = s
+	return nil
+}
+
+func funcPaths(conf *configuration, n []string) error {
+	s, err := strconv.Atoi(n[0])
+	if err != nil {
+		return err
+	}
+	if s < 1 {
+		return errors.New("paths must be >= 1")
+	}
+	conf.Paths = s
+	return nil
+}
+
+func funcWeights(conf *configuration, fn []string) error {
+	conf.Weights = fn[0]
+	return nil
+}
+
+func funcVerbose(conf *configuration, _ []string) error {
+	if conf.LogLevel < logInfo {
+		conf.LogLevel = logInfo
+	}
+	return nil
+}
+
+func funcVeryVerbose(conf *configuration, _ []string) error {
+	conf.LogLevel = logDebug
+	return nil
+}
+
+func funcLogFormat(conf *configuration, format []string) error {
+	if format[0] != logFormatText && format[0] != logFormatJSON {
+		return errors.New("unsupported log format")
+	}
+	conf.LogFormat = format[0]
+	return nil
+}
+
+func funcErrors(conf *configuration, format []string) error {
+	if format[0] != errorsText && format[0] != errorsJSON {
+		return errors.New("unsupported errors format")
+	}
+	conf.Errors = format[0]
+	return nil
+}
+
+func funcLogFile(conf *configuration, fn []string) error {
+	conf.LogFile = fn[0]
+	return nil
+}
+
+func funcQuiet(conf *configuration, _ []string) error {
+	conf.Quiet = true
+	return nil
+}
+
+func funcSplitDir(conf *configuration, dir []string) error {
+	conf.SplitDir = dir[0]
+	return nil
+}
+
+// Returns the symbols to explore: the command line ones take precedence
+// over the resume token frontier, then the config file list, which in turn
+// takes precedence over the single symbol.
+func (conf *configuration) symbolList() []string {
+	if len(conf.cliSymbols) > 0 {
+		return conf.cliSymbols
+	}
+	if conf.resume != nil {
+		return conf.resume.symbols()
+	}
+	if len(conf.Symbols) > 0 {
+		return conf.Symbols
+	}
+	return []string{conf.Symbol}
+}
+
 func funcDBUser(conf *configuration, user []string) error {
 	conf.DBUser = user[0]
 	return nil
@@ -157,6 +810,85 @@ func funcDBPort(conf *configuration, port []string) error {
 	return nil
 }
 
+func funcDBDriver(conf *configuration, driver []string) error {
+	if err := navdb.ValidBackend(driver[0]); err != nil {
+		return err
+	}
+	conf.DBDriver = driver[0]
+	return nil
+}
+
+func funcDBFile(conf *configuration, fn []string) error {
+	conf.DBDriver = navdb.Sqlite
+	conf.DBFile = fn[0]
+	return nil
+}
+
+func funcSSLMode(conf *configuration, mode []string) error {
+	conf.DBSSLMode = mode[0]
+	return nil
+}
+
+func funcSSLRootCert(conf *configuration, fn []string) error {
+	conf.DBSSLRootCert = fn[0]
+	return nil
+}
+
+func funcSSLCert(conf *configuration, fn []string) error {
+	conf.DBSSLCert = fn[0]
+	return nil
+}
+
+func funcSSLKey(conf *configuration, fn []string) error {
+	conf.DBSSLKey = fn[0]
+	return nil
+}
+
+// Checks the TLS options are consistent.
+func (conf *configuration) validateSSL() error {
+	if notInStr(navdb.SSLModes, conf.DBSSLMode) {
+		return fmt.Errorf("unsupported sslmode %s", conf.DBSSLMode)
+	}
+	if (conf.DBSSLCert == "") != (conf.DBSSLKey == "") {
+		return errors.New("client certificate and key must be specified together")
+	}
+	return nil
+}
+
+func funcDBRetries(conf *configuration, retries []string) error {
+	s, err := strconv.Atoi(retries[0])
+	if err != nil {
+		return err
+	}
+	if s < 0 {
+		return errors.New("retries must be >= 0")
+	}
+	conf.DBRetries = s
+	return nil
+}
+
+func funcDBRetryDelay(conf *configuration, delay []string) error {
+	conf.DBRetryDelay = delay[0]
+	return nil
+}
+
+func funcDBPoolSize(conf *configuration, n []string) error {
+	s, err := strconv.Atoi(n[0])
+	if err != nil {
+		return err
+	}
+	if s < 0 {
+		return errors.New("pool size must be >= 0")
+	}
+	conf.DBPoolSize = s
+	return nil
+}
+
+func funcDBQueryTimeout(conf *configuration, timeout []string) error {
+	conf.DBQueryTimeout = timeout[0]
+	return nil
+}
+
 func funcDepth(conf *configuration, depth []string) error {
 	s, err := strconv.Atoi(depth[0])
 	if err != nil {
@@ -169,6 +901,82 @@ func funcDepth(conf *configuration, depth []string) error {
 	return nil
 }
 
+func funcMaxNodes(conf *configuration, n []string) error {
+	s, err := strconv.Atoi(n[0])
+	if err != nil {
+		return err
+	}
+	if s < 0 {
+		return errors.New("max nodes must be >= 0")
+	}
+	conf.MaxNodes = s
+	return nil
+}
+
+func funcMaxEdges(conf *configuration, n []string) error {
+	s, err := strconv.Atoi(n[0])
+	if err != nil {
+		return err
+	}
+	if s < 0 {
+		return errors.New("max edges must be >= 0")
+	}
+	conf.MaxEdges = s
+	return nil
+}
+
+func funcVisibility(conf *configuration, v []string) error {
+	if err := validVisibility(v[0]); err != nil {
+		return err
+	}
+	conf.Visibility = v[0]
+	return nil
+}
+
+func funcNamespace(conf *configuration, ns []string) error {
+	conf.Namespace = ns[0]
+	return nil
+}
+
+func funcModule(conf *configuration, m []string) error {
+	conf.Module = m[0]
+	return nil
+}
+
+func funcDedup(conf *configuration, _ []string) error {
+	conf.Dedup = true
+	return nil
+}
+
+func funcStrategy(conf *configuration, s []string) error {
+	if err := validStrategy(s[0]); err != nil {
+		return err
+	}
+	conf.Strategy = s[0]
+	return nil
+}
+
+// Checks the PlantUML diagram is supported.
+func validDiagram(d string) error {
+	if d != output.SequenceDiagram && d != output.ActivityDiagram {
+		return fmt.Errorf("unsupported diagram %s", d)
+	}
+	return nil
+}
+
+func funcDiagram(conf *configuration, d []string) error {
+	if err := validDiagram(d[0]); err != nil {
+		return err
+	}
+	conf.Diagram = d[0]
+	return nil
+}
+
+// Checks if the exploration has a nodes or edges budget.
+func (conf *configuration) budget() bool {
+	return conf.MaxNodes > 0 || conf.MaxEdges > 0
+}
+
 func funcInstance(conf *configuration, instance []string) error {
 	s, err := strconv.Atoi(instance[0])
 	if err != nil {
@@ -208,6 +1016,10 @@ func printHelp(lines []cmdLineItems) {
 			item.helpStr,
 		)
 	}
+	fmt.Println("Commands:")
+	for _, item := range subCmdItemInit() {
+		fmt.Printf("\t%s %s\t%s\n", item.name, item.argStr, item.helpStr)
+	}
 }
 
 // Used to parse the command line and generate the command line.
@@ -222,10 +1034,20 @@ func argsParse(lines []cmdLineItems) (configuration, error) {
 		}
 	}
 
-	for _, osArg := range os.Args[1:] {
+	args, err := splitLongArgs(os.Args[1:])
+	if err != nil {
+		return defaultConfig, err
+	}
+	args, err = profileSwitch(&conf, args)
+	if err != nil {
+		return defaultConfig, err
+	}
+	for _, osArg := range args {
 		if !extra {
+			matched := false
 			for _, arg := range lines {
 				if arg.switchStr == osArg {
+					matched = true
 					if arg.needed {
 						conf.cmdlineNeeds[arg.switchStr] = true
 					}
@@ -240,6 +1062,9 @@ func argsParse(lines []cmdLineItems) (configuration, error) {
 					}
 				}
 			}
+			if !matched && !strings.HasPrefix(osArg, "-") {
+				conf.cmdArgs = append(conf.cmdArgs, osArg)
+			}
 			continue
 		}
 		if extra {
@@ -255,6 +1080,18 @@ func argsParse(lines []cmdLineItems) (configuration, error) {
 		return defaultConfig, errors.New("missing switch arg")
 	}
 
+	if err := conf.validate(); err != nil {
+		return defaultConfig, err
+	}
+
+	if len(conf.cmdArgs) > 0 {
+		conf.command = conf.cmdArgs[0]
+		conf.cmdArgs = conf.cmdArgs[1:]
+	}
+	if conf.command != "" {
+		return subCmdCheck(conf)
+	}
+
 	res := true
 	for _, element := range conf.cmdlineNeeds {
 		res = res && element
@@ -264,3 +1101,110 @@ func argsParse(lines []cmdLineItems) (configuration, error) {
 	}
 	return defaultConfig, errors.New("missing needed arg")
 }
+
+// Checks the configuration values are valid and consistent.
+func (conf *configuration) validate() error {
+	if conf.Errors != errorsText && conf.Errors != errorsJSON {
+		return errors.New("unsupported errors format")
+	}
+	if _, ok := conf.Profiles[conf.Profile]; conf.Profile != "" && !ok {
+		return fmt.Errorf("unknown profile %s", conf.Profile)
+	}
+	if _, err := conf.symbolPatterns(); err != nil {
+		return err
+	}
+	if err := conf.validateFilters(); err != nil {
+		return err
+	}
+	if _, err := conf.boundaries(); err != nil {
+		return err
+	}
+	if err := validStrategy(conf.Strategy); err != nil {
+		return err
+	}
+	if err := validDiagram(conf.Diagram); err != nil {
+		return err
+	}
+	if err := validVisibility(conf.Visibility); err != nil {
+		return err
+	}
+	if opt2num(conf.Jout) == dummyOutput {
+		return fmt.Errorf("unknown output type %s", conf.Jout)
+	}
+	if conf.resume != nil && conf.resume.Instance != conf.Instance {
+		return fmt.Errorf("resume token of instance %d, not %d", conf.resume.Instance, conf.Instance)
+	}
+	if conf.Snippet && conf.SrcTree == "" {
+		return errors.New("snippets need the source tree given with --src")
+	}
+	if conf.Strategy == strategyIDDFS && opt2num(conf.Jout) == ndjsonOutput {
+		return errors.New("the iddfs strategy can't stream the output")
+	}
+	if err := conf.validateSSL(); err != nil {
+		return err
+	}
+	if d, err := time.ParseDuration(conf.DBRetryDelay); err != nil || d < 0 {
+		return errors.New("invalid retry delay")
+	}
+	// Every parallel lookup holds one connection at a time, the rows are
+	// read before the callees are looked up.
+	if conf.DBPoolSize > 0 && conf.DBPoolSize < conf.Parallel {
+		return errors.New("pool size must be at least the parallel lookups")
+	}
+	if conf.DBQueryTimeout != "" {
+		if d, err := time.ParseDuration(conf.DBQueryTimeout); err != nil || d <= 0 {
+			return errors.New("invalid query timeout")
+		}
+	}
+	if conf.Timeout != "" {
+		if d, err := time.ParseDuration(conf.Timeout); err != nil || d <= 0 {
+			return errors.New("invalid timeout")
+		}
+	}
+	return nil
+}
+
+// Splits the long switches in the --switch=value form into switch and value.
+// Switches without value take true, as if given, or false, as if not given;
+// other values are left in place and reported.
+func splitLongArgs(args []string) ([]string, error) {
+	var res []string
+	var err error
+
+	flags := map[string]bool{}
+	for _, item := range cmdLineItemInit() {
+		flags[item.switchStr] = !item.hasArg
+	}
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		switch {
+		case !strings.HasPrefix(arg, "--") || i <= 0:
+			res = append(res, arg)
+		case !flags[arg[:i]]:
+			res = append(res, arg[:i], arg[i+1:])
+		case arg[i+1:] == "true":
+			res = append(res, arg[:i])
+		case arg[i+1:] != "false":
+			res = append(res, arg)
+			err = fmt.Errorf("switch %s takes true or false, not %s", arg[:i], arg[i+1:])
+		}
+	}
+	return res, err
+}
+
+// Validates the subcommand arguments and switches.
+func subCmdCheck(conf configuration) (configuration, error) {
+	c, ok := findSubCmd(conf.command)
+	if !ok {
+		return defaultConfig, fmt.Errorf("unknown command %s", conf.command)
+	}
+	if c.nargs >= 0 && len(conf.cmdArgs) != c.nargs {
+		return defaultConfig, fmt.Errorf("command %s needs %d args", c.name, c.nargs)
+	}
+	for _, sw := range c.needs {
+		if !conf.cmdlineNeeds[sw] {
+			return defaultConfig, errors.New("missing needed arg")
+		}
+	}
+	return conf, nil
+}
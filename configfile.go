@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Key of the configuration files listing the files they are layered on.
+const includeKey = "include"
+
+// Reads a configuration file in JSON, YAML or TOML, chosen by extension, into
+// a map of keys to values. The files it includes are read first, relative to
+// its directory, and its own keys override theirs.
+func loadConfigFile(fn string) (map[string]interface{}, error) {
+	return loadConfigLayers(fn, map[string]bool{})
+}
+
+func loadConfigLayers(fn string, visiting map[string]bool) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, err
+	}
+	if visiting[abs] {
+		return nil, fmt.Errorf("%s: include cycle", fn)
+	}
+	visiting[abs] = true
+	defer delete(visiting, abs)
+
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]interface{}
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &keys)
+	case ".toml":
+		err = toml.Unmarshal(b, &keys)
+	default:
+		err = json.Unmarshal(b, &keys)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	res := map[string]interface{}{}
+	var includes []string
+	for k, v := range keys {
+		if !strings.EqualFold(k, includeKey) {
+			continue
+		}
+		delete(keys, k)
+		switch inc := v.(type) {
+		case string:
+			includes = append(includes, inc)
+		case []interface{}:
+			for _, i := range inc {
+				s, ok := i.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: include expects file names", fn)
+				}
+				includes = append(includes, s)
+			}
+		default:
+			return nil, fmt.Errorf("%s: include expects file names", fn)
+		}
+	}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(fn), inc)
+		}
+		base, err := loadConfigLayers(inc, visiting)
+		if err != nil {
+			return nil, err
+		}
+		mergeConfigKeys(res, base)
+	}
+	mergeConfigKeys(res, keys)
+	return res, nil
+}
+
+// Overrides the keys of dst with the ones of src. Keys are matched ignoring
+// case, as the decoder does, and mappings, e.g. the profiles, are merged.
+func mergeConfigKeys(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		for old, prev := range dst {
+			if !strings.EqualFold(old, k) {
+				continue
+			}
+			delete(dst, old)
+			m, ok := v.(map[string]interface{})
+			if prevMap, prevOk := prev.(map[string]interface{}); ok && prevOk {
+				merged := map[string]interface{}{}
+				mergeConfigKeys(merged, prevMap)
+				mergeConfigKeys(merged, m)
+				v = merged
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// Sets the keys of a configuration, decoding them as a JSON file.
+func applyConfigKeys(conf *configuration, keys map[string]interface{}) error {
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	// The decoder adds to the maps, which may be shared with the defaults.
+	kconfig := map[string]string{}
+	for k, v := range conf.Kconfig {
+		kconfig[k] = v
+	}
+	conf.Kconfig = kconfig
+	return json.Unmarshal(b, conf)
+}
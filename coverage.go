@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Functions of the coverage report, filled green if covered and red if not.
+var fmtDotNodeCoverage = []string{
+	"",
+	"\"%s\" [style=filled fillcolor=\"%s\" xlabel=\"%d%%\"]\n",
+	"\\\"%s\\\" [style=filled fillcolor=\\\"%s\\\" xlabel=\\\"%d%%\\\"] \\\\\\n",
+	"\"%s\" [style=filled fillcolor=\"%s\" xlabel=\"%d%%\"]\n",
+	"\"%s\" [style=filled fillcolor=\"%s\" xlabel=\"%d%%\"]\n",
+}
+
+var (
+	coveredColor   = color.RGBA{0xb2, 0xdf, 0x8a, 0xff}
+	uncoveredColor = color.RGBA{0xfb, 0x9a, 0x99, 0xff}
+)
+
+// Coverage of a function: the times it was called and its instrumented and
+// executed lines.
+type funcCoverage struct {
+	hits    int
+	lines   int
+	covered int
+}
+
+// Coverage of the functions of an lcov report, by name.
+type coverage map[string]*funcCoverage
+
+// Function record of an lcov source file section.
+type lcovFunc struct {
+	name  string
+	start int
+	end   int
+}
+
+// Accounts the lines of a source file to its functions. A function spans
+// from its first line to its end line, if the report has it, or to the line
+// before the next function.
+func (c coverage) addFile(funcs []lcovFunc, hits map[string]int, lines map[int]int) {
+	sort.SliceStable(funcs, func(i, j int) bool { return funcs[i].start < funcs[j].start })
+	for i, f := range funcs {
+		end := f.end
+		if end == 0 && i+1 < len(funcs) {
+			end = funcs[i+1].start - 1
+		}
+		fc, ok := c[f.name]
+		if !ok {
+			fc = &funcCoverage{}
+			c[f.name] = fc
+		}
+		fc.hits += hits[f.name]
+		for l, n := range lines {
+			if l >= f.start && (end == 0 || l <= end) {
+				fc.lines++
+				if n > 0 {
+					fc.covered++
+				}
+			}
+		}
+	}
+}
+
+// Parses an lcov tracefile, as produced by lcov or gcovr from gcov data.
+// Static functions sharing the name in different files are merged.
+func parseLcov(in io.Reader) (coverage, error) {
+	var funcs []lcovFunc
+	c := coverage{}
+	hits := map[string]int{}
+	lines := map[int]int{}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		fields := strings.Split(value, ",")
+		switch key {
+		case "FN":
+			// FN:<start>,<name> or FN:<start>,<end>,<name>
+			f := lcovFunc{name: fields[len(fields)-1]}
+			f.start, _ = strconv.Atoi(fields[0])
+			if len(fields) == 3 {
+				f.end, _ = strconv.Atoi(fields[1])
+			}
+			funcs = append(funcs, f)
+		case "FNDA":
+			if len(fields) == 2 {
+				n, _ := strconv.Atoi(fields[0])
+				hits[fields[1]] += n
+			}
+		case "DA":
+			if len(fields) >= 2 {
+				l, _ := strconv.Atoi(fields[0])
+				n, _ := strconv.Atoi(fields[1])
+				lines[l] += n
+			}
+		case "end_of_record":
+			c.addFile(funcs, hits, lines)
+			funcs, hits, lines = nil, map[string]int{}, map[int]int{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(c) == 0 {
+		return nil, errors.New("no function found in the coverage report")
+	}
+	return c, nil
+}
+
+// Loads an lcov .info file.
+func loadCoverage(fn string) (coverage, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := parseLcov(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	logger.info("coverage loaded", "file", fn, "functions", len(c))
+	return c, nil
+}
+
+// Returns the line coverage percentage of a function, a function with no
+// instrumented lines is as covered as it was called.
+func (fc *funcCoverage) percent() int {
+	if fc.lines == 0 {
+		if fc.hits > 0 {
+			return 100
+		}
+		return 0
+	}
+	return 100 * fc.covered / fc.lines
+}
+
+// Returns the fill color of a function in the report.
+func (fc *funcCoverage) color() color.RGBA {
+	if fc.hits > 0 {
+		return coveredColor
+	}
+	return uncoveredColor
+}
+
+// Returns the DOT statements marking the functions of the graph in the report.
+func (c coverage) dotNodes(names []string, flavour int) string {
+	var res string
+
+	for _, name := range names {
+		if fc, ok := c[name]; ok {
+			col := fc.color()
+			res += fmt.Sprintf(fmtDotNodeCoverage[flavour], name, fmt.Sprintf("#%02x%02x%02x", col.R, col.G, col.B), fc.percent())
+		}
+	}
+	return res
+}
+
+// Returns the functions of the graph the test suite never called, sorted.
+// Functions missing from the report, i.e. not instrumented, are not listed.
+func (c coverage) uncovered(names []string) []string {
+	res := []string{}
+
+	for _, name := range names {
+		if fc, ok := c[name]; ok && fc.hits == 0 {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Returns the function names of an exploration, in order of appearance.
+func (e *exploration) functions() []string {
+	var res []string
+	seen := map[string]bool{}
+
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+	for _, n := range e.starts {
+		add(n.symbol)
+	}
+	for _, c := range e.res.calls {
+		add(c.l.symbol)
+		add(c.r.symbol)
+	}
+	return res
+}
+
+// Appends the summary of the uncovered functions to an output, see appendSection.
+func appendUncovered(out string, e *exploration, jout string, w io.Writer) (string, error) {
+	names := e.functions()
+	uncovered := e.coverage.uncovered(names)
+	lines := []string{fmt.Sprintf("uncovered: %d of %d functions", len(uncovered), len(names))}
+	for _, name := range uncovered {
+		lines = append(lines, "uncovered: "+name)
+	}
+	return appendSection(out, "uncovered", uncovered, lines, jout, w)
+}
+
+// Writes the uncovered functions among the streamed ones.
+func streamUncovered(enc *json.Encoder, c coverage, names []string) error {
+	for _, name := range c.uncovered(names) {
+		if err := enc.Encode(ndjsonUncovered{"uncovered", name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Records a cycle if the callee is on the current exploration path.
+// The cycle is stored starting from its smallest symbol, so that the same
+// recursion reached from different entry points is reported once.
+func (res *navResult) addCycle(calleeId int) {
+	start := -1
+	for i, id := range res.path {
+		if id == calleeId {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+
+	ring := append([]string{}, res.pathNames[start:]...)
+	first := 0
+	for i, s := range ring {
+		if s < ring[first] {
+			first = i
+		}
+	}
+	cycle := append(append([]string{}, ring[first:]...), ring[:first]...)
+	cycle = append(cycle, cycle[0])
+	key := strings.Join(cycle, " -> ")
+	if res.cycleKeys[key] {
+		return
+	}
+	logger.info("cycle", "path", key)
+	res.cycleKeys[key] = true
+	res.cycles = append(res.cycles, cycle)
+}
+
+// Appends a report to an output, in a form that keeps it valid: comments for
+// DOT, Cypher, Mermaid, PlantUML, GraphML and HTML, a field holding value for the JSON outputs.
+// Edge lists have no room for it, and the lines go to w.
+func appendSection(out string, field string, value interface{}, lines []string, jout string, w io.Writer) (string, error) {
+	var prefix, suffix string
+
+	switch opt2num(jout) {
+	case graphOnly, cypherOutput:
+		prefix = "// "
+	case mermaidOutput:
+		prefix = "%% "
+	case plantUMLOutput:
+		prefix = "' "
+	case graphMLOutput, htmlOutput:
+		prefix, suffix = "<!-- ", " -->"
+	case jsonOutputPlain, jsonOutputB64, jsonOutputGZB64:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(out, "}") + ",\"" + field + "\": " + string(b) + "}", nil
+	default:
+		for _, l := range lines {
+			fmt.Fprintln(w, l)
+		}
+		return out, nil
+	}
+	for _, l := range lines {
+		out += "\n" + prefix + l + suffix
+	}
+	return out, nil
+}
+
+// Appends the cycles to an output, see appendSection.
+func appendCycles(out string, cycles [][]string, jout string, w io.Writer) (string, error) {
+	var lines []string
+
+	for _, c := range cycles {
+		lines = append(lines, "cycle: "+strings.Join(c, " -> "))
+	}
+	if cycles == nil {
+		cycles = [][]string{}
+	}
+	return appendSection(out, "cycles", cycles, lines, jout, w)
+}
+
+// Writes the cycles found during a streamed exploration.
+func streamCycles(enc *json.Encoder, cycles [][]string) error {
+	for _, c := range cycles {
+		if err := enc.Encode(ndjsonCycle{"cycle", c}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prints the cycles, one per line.
+func printCycles(w io.Writer, cycles [][]string) {
+	for _, c := range cycles {
+		fmt.Fprintln(w, "cycle:", strings.Join(c, " -> "))
+	}
+}
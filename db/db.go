@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+// Package db connects the symbol databases produced by the extractor, either
+// postgres servers or self contained sqlite files.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Supported database backends.
+const (
+	Postgres = "postgres"
+	Sqlite   = "sqlite"
+)
+
+// Query interface shared by all the database backends.
+// Queries are written using the postgres dialect, backends that differ
+// are expected to translate them before execution.
+type Conn interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	PingContext(ctx context.Context) error
+	Close() error
+}
+
+// Connection configuration. For sqlite, DBName is the database file.
+// PoolSize bounds the connections open at the same time, 0 for no limit,
+// StatementTimeout the duration of every postgres query, 0 for none.
+type Token struct {
+	Host             string
+	Port             int
+	User             string
+	Pass             string
+	DBName           string
+	Backend          string
+	SSL              SSLOptions
+	PoolSize         int
+	StatementTimeout time.Duration
+}
+
+// Postgres TLS connection options.
+type SSLOptions struct {
+	Mode     string
+	RootCert string
+	Cert     string
+	Key      string
+}
+
+// Postgres sslmode values supported by lib/pq, which rejects allow and prefer.
+var SSLModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// Connection whose queries are bound to a context, so that the functions
+// taking a Conn are cancelled along with it.
+type ctxConn struct {
+	Conn
+	ctx context.Context
+}
+
+// Returns a connection running all the queries within the given context.
+func WithContext(ctx context.Context, db Conn) Conn {
+	return ctxConn{db, ctx}
+}
+
+// Returns the context the queries of a connection run within, the
+// background one if not bound to any.
+func Context(db Conn) context.Context {
+	if c, ok := db.(ctxConn); ok {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+func (db ctxConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.Conn.QueryContext(db.ctx, query, args...)
+}
+
+// Connects the target db using the backend selected in the token.
+func Connect(t *Token) (Conn, error) {
+	switch t.Backend {
+	case Postgres, "":
+		return connectPsql(t)
+	case Sqlite:
+		return connectSqlite(t)
+	default:
+		return nil, fmt.Errorf("unsupported database backend %s", t.Backend)
+	}
+}
+
+// Checks the backend name is one of the supported ones.
+func ValidBackend(name string) error {
+	if name != Postgres && name != Sqlite {
+		return errors.New("unsupported database backend")
+	}
+	return nil
+}
+
+// Quotes a connection string value.
+func dsnQuote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// Returns the postgres connection string. Sessions are read only.
+func (t *Token) DSN() string {
+	mode := t.SSL.Mode
+	if mode == "" {
+		mode = "disable"
+	}
+	psqlconn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", dsnQuote(t.Host), t.Port, dsnQuote(t.User), dsnQuote(t.Pass), dsnQuote(t.DBName), mode)
+	for _, opt := range [][2]string{{"sslrootcert", t.SSL.RootCert}, {"sslcert", t.SSL.Cert}, {"sslkey", t.SSL.Key}} {
+		if opt[1] != "" {
+			psqlconn += fmt.Sprintf(" %s=%s", opt[0], dsnQuote(opt[1]))
+		}
+	}
+	psqlconn += " default_transaction_read_only=on"
+	if t.StatementTimeout > 0 {
+		psqlconn += fmt.Sprintf(" statement_timeout=%d", t.StatementTimeout.Milliseconds())
+	}
+	return psqlconn
+}
+
+// Connects the target postgres db and returns the handle.
+func connectPsql(t *Token) (Conn, error) {
+	db, err := sql.Open("postgres", t.DSN())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(t.PoolSize)
+	return db, nil
+}
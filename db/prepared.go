@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Backends able to prepare statements.
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Connection running every query as prepared statement, prepared on first
+// use and reused afterwards, so that the explorations repeating the same few
+// queries for every function are parsed and planned once. It is safe for
+// concurrent use.
+type preparedConn struct {
+	Conn
+	prep  preparer
+	mu    *sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// Returns a connection preparing its queries, the connection itself if the
+// backend does not support prepared statements.
+func Prepare(db Conn) Conn {
+	p, ok := db.(preparer)
+	if !ok {
+		return db
+	}
+	return preparedConn{db, p, &sync.Mutex{}, map[string]*sql.Stmt{}}
+}
+
+// Returns the prepared statement of a query, preparing it if needed.
+func (db preparedConn) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if s, ok := db.stmts[query]; ok {
+		return s, nil
+	}
+	s, err := db.prep.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	db.stmts[query] = s
+	return s, nil
+}
+
+func (db preparedConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	s, err := db.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return s.QueryContext(ctx, args...)
+}
+
+func (db preparedConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// Closes the prepared statements and the connection.
+func (db preparedConn) Close() error {
+	db.mu.Lock()
+	for q, s := range db.stmts {
+		s.Close()
+		delete(db.stmts, q)
+	}
+	db.mu.Unlock()
+	return db.Conn.Close()
+}
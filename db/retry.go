@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Upper bound for the delay between two attempts.
+const maxRetryDelay = 10 * time.Second
+
+// Connection retrying the queries failing for transient errors, waiting an
+// exponentially growing delay, starting from Delay, between attempts.
+type RetryConn struct {
+	Conn
+	Retries int
+	Delay   time.Duration
+}
+
+// Returns true for the errors that are worth a retry: lost or refused
+// connections and postgres serialization or availability failures.
+func IsTransient(err error) bool {
+	var pqErr *pq.Error
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &pqErr):
+		switch pqErr.Code {
+		case "40001", "40P01", "53300", "57P01", "57P02", "57P03":
+			return true
+		}
+		return pqErr.Code.Class() == "08"
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// Returns the delay before the given retry attempt, starting from 0.
+func (db RetryConn) backoff(attempt int) time.Duration {
+	d := db.Delay << attempt
+	if d > maxRetryDelay || d <= 0 {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// Runs f until it succeeds, fails for a permanent error or the retries are
+// exhausted, waiting the backoff between attempts. The wait ends early when
+// the context is done.
+func (db RetryConn) retry(ctx context.Context, f func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= db.Retries || !IsTransient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(db.backoff(attempt)):
+		}
+	}
+}
+
+// Runs a query together with the scan of its rows, all again on transient
+// failures when the connection retries them: lib/pq streams the rows, so a
+// connection lost while they are read fails the scan, not the query. f gets
+// the connection without the retries, the whole unit is retried instead.
+func retry(db Conn, f func(db Conn) error) error {
+	ctx := Context(db)
+	inner := db
+	for c, ok := inner.(ctxConn); ok; c, ok = inner.(ctxConn) {
+		inner = c.Conn
+	}
+	r, ok := inner.(RetryConn)
+	if !ok {
+		return f(db)
+	}
+	return r.retry(ctx, func() error { return f(WithContext(ctx, r.Conn)) })
+}
+
+func (db RetryConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+
+	err := db.retry(ctx, func() error {
+		var err error
+		rows, err = db.Conn.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (db RetryConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// Checks the database described by the token is reachable, retrying transient
+// failures within the context, and returns an error describing the likely
+// cause.
+func (db RetryConn) HealthCheck(ctx context.Context, t *Token) error {
+	var pqErr *pq.Error
+
+	err := db.retry(ctx, func() error { return db.PingContext(ctx) })
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	where := fmt.Sprintf("postgres at %s:%d, database %s, user %s", t.Host, t.Port, t.DBName, t.User)
+	if t.Backend == Sqlite {
+		where = fmt.Sprintf("sqlite file %s", t.DBName)
+	}
+	hint := "check the database settings"
+	switch {
+	case errors.As(err, &pqErr) && pqErr.Code == "28P01", errors.As(err, &pqErr) && pqErr.Code.Class() == "28":
+		hint = "authentication failed, check user and password"
+	case errors.As(err, &pqErr) && pqErr.Code == "3D000":
+		hint = "the database does not exist, check DBTargetDB"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		hint = "connection refused, check host and port"
+	case IsTransient(err), strings.Contains(err.Error(), "no such host"):
+		hint = "server unreachable, check host name and network connectivity (VPN)"
+	}
+	return fmt.Errorf("can't reach %s: %s: %w", where, hint, err)
+}
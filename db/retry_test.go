@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Connection failing the first queries with the given error.
+type flakyConn struct {
+	Conn
+	err   error
+	fails *int
+}
+
+func (db flakyConn) QueryContext(_ context.Context, _ string, _ ...interface{}) (*sql.Rows, error) {
+	if *db.fails > 0 {
+		*db.fails--
+		return nil, db.err
+	}
+	return nil, nil
+}
+
+// Tests transient errors classification and queries retry.
+func TestRetry(t *testing.T) {
+
+	if !IsTransient(driver.ErrBadConn) || !IsTransient(&pq.Error{Code: "40001"}) || !IsTransient(&pq.Error{Code: "08006"}) {
+		t.Error("Transient error not detected")
+	}
+	if IsTransient(errors.New("syntax error")) || IsTransient(&pq.Error{Code: "42601"}) {
+		t.Error("Permanent error considered transient")
+	}
+
+	fails := 2
+	db := RetryConn{flakyConn{err: driver.ErrBadConn, fails: &fails}, 3, time.Millisecond}
+	if _, err := db.Query("select 1"); err != nil || fails != 0 {
+		t.Error("Transient failures not retried", err, fails)
+	}
+
+	fails = 5
+	if _, err := db.Query("select 1"); err == nil || fails != 1 {
+		t.Error("Retries not bounded", err, fails)
+	}
+
+	fails = 1
+	db.Conn = flakyConn{err: errors.New("syntax error"), fails: &fails}
+	if _, err := db.Query("select 1"); err == nil {
+		t.Error("Permanent failure retried")
+	}
+}
+
+// Connection failing the first pings with the given error.
+type flakyPing struct {
+	Conn
+	err   error
+	fails *int
+}
+
+func (db flakyPing) PingContext(_ context.Context) error {
+	if *db.fails > 0 {
+		*db.fails--
+		return db.err
+	}
+	return nil
+}
+
+// Tests the query and scan units are retried as a whole, without the retries
+// of the single queries, and the startup check stops with the context.
+func TestRetryUnit(t *testing.T) {
+
+	attempts := 0
+	db := RetryConn{flakyConn{err: driver.ErrBadConn, fails: new(int)}, 3, time.Millisecond}
+	err := retry(WithContext(context.Background(), db), func(c Conn) error {
+		attempts++
+		if _, ok := c.(ctxConn).Conn.(RetryConn); ok {
+			t.Error("Query retried within the unit")
+		}
+		if attempts < 3 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Error("Unit not retried", err, attempts)
+	}
+
+	attempts = 0
+	if err := retry(db.Conn, func(Conn) error { attempts++; return driver.ErrBadConn }); err == nil || attempts != 1 {
+		t.Error("Unit retried without a retrying connection", err, attempts)
+	}
+
+	fails := 100
+	db = RetryConn{flakyPing{err: driver.ErrBadConn, fails: &fails}, 100, time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := db.HealthCheck(ctx, &Token{Backend: Sqlite}); !errors.Is(err, context.Canceled) {
+		t.Error("Cancelled health check not stopped", err)
+	}
+}
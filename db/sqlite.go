@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Matches postgres style positional parameters.
+var psqlPlaceholder = regexp.MustCompile(`\$([0-9]+)`)
+
+// SQLite connection, translates postgres dialect queries.
+type sqliteDB struct {
+	*sql.DB
+}
+
+// Opens a self contained symbol database file in read only mode.
+func connectSqlite(t *Token) (Conn, error) {
+	if _, err := os.Stat(t.DBName); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", t.DBName))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(t.PoolSize)
+	return sqliteDB{db}, nil
+}
+
+// SQLite binds "$N" as named parameters numbered by appearance,
+// "?N" is needed to keep the positional semantic.
+func sqliteRebind(query string) string {
+	return psqlPlaceholder.ReplaceAllString(query, "?$1")
+}
+
+func (db sqliteDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(sqliteRebind(query), args...)
+}
+
+func (db sqliteDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, sqliteRebind(query), args...)
+}
+
+func (db sqliteDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return db.DB.PrepareContext(ctx, sqliteRebind(query))
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// Tests the postgres placeholders translation and the sqlite file checks.
+func TestSqlite(t *testing.T) {
+
+	if q := sqliteRebind("select * from t where a=$2 and b=$1 and c=$2"); q != "select * from t where a=?2 and b=?1 and c=?2" {
+		t.Error("Unexpected query translation", q)
+	}
+
+	_, err := Connect(&Token{DBName: filepath.Join(t.TempDir(), "missing.db"), Backend: Sqlite})
+	if err == nil {
+		t.Error("Missing database file not detected")
+	}
+}
+
+// Tests the queries are prepared once.
+func TestPrepared(t *testing.T) {
+
+	fn := filepath.Join(t.TempDir(), "test.db")
+	raw, err := sql.Open("sqlite3", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec("create table t (a integer, b text); insert into t values (1, 'x'), (2, 'y')"); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	conn, err := Connect(&Token{DBName: fn, Backend: Sqlite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := Prepare(conn)
+	defer db.Close()
+	for _, a := range []int{1, 2} {
+		var b string
+		rows, err := db.Query("select b from t where a=$1", a)
+		if err != nil {
+			t.Fatal("Unexpected query error", err)
+		}
+		for rows.Next() {
+			rows.Scan(&b)
+		}
+		rows.Close()
+		if b != map[int]string{1: "x", 2: "y"}[a] {
+			t.Error("Unexpected prepared query result", a, b)
+		}
+	}
+	if p, ok := db.(preparedConn); !ok || len(p.stmts) != 1 {
+		t.Error("Unexpected prepared statements", db)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+)
+
+// Error of a symbol missing from an instance.
+var ErrSymbolNotFound = errors.New("symbol not found")
+
+// Function of an instance, with the file defining it and the subsystems the
+// file belongs to.
+type Symbol struct {
+	Id     int
+	Name   string
+	File   string
+	Subsys []string
+}
+
+// Call between two functions, by id, with its call site. Indirect calls are
+// the ones resolved by the extractor, Confidence is 1 for the direct calls.
+type Call struct {
+	Caller     int
+	Callee     int
+	SourceRef  string
+	AddressRef string
+	Indirect   bool
+	Confidence float64
+}
+
+// Returns the function with the given id, the zero Symbol if the instance
+// has none.
+func SymbolById(db Conn, id int, instance int) (Symbol, error) {
+	var res Symbol
+	var s sql.NullString
+
+	query := "select symbol_id, symbol_name, subsys_name, file_name from " +
+		"(select * from symbols, files where symbols.symbol_file_ref_id=files.file_id and symbols.symbol_instance_id_ref=$2) as dummy " +
+		"left outer join tags on dummy.symbol_file_ref_id=tags.tag_file_ref_id where symbol_id=$1 and symbol_instance_id_ref=$2"
+	err := retry(db, func(db Conn) error {
+		res = Symbol{}
+		rows, err := db.Query(query, id, instance)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := rows.Scan(&res.Id, &res.Name, &s, &res.File); err != nil {
+				return err
+			}
+			if s.Valid {
+				res.Subsys = append(res.Subsys, s.String)
+			}
+		}
+		return rows.Err()
+	})
+	return res, err
+}
+
+// Returns the id of the function with the given name. ErrSymbolNotFound
+// reports a missing one, names shared by several functions are an error.
+func SymbolId(db Conn, name string, instance int) (int, error) {
+	var res, cnt int
+
+	err := retry(db, func(db Conn) error {
+		cnt = 0
+		rows, err := db.Query("select symbol_id from symbols where symbols.symbol_name=$1 and symbols.symbol_instance_id_ref=$2", name, instance)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			cnt++
+			if err := rows.Scan(&res); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+	switch {
+	case err != nil:
+		return 0, err
+	case cnt == 0:
+		return 0, ErrSymbolNotFound
+	case cnt != 1:
+		return res, errors.New("duplicate ID in the DB")
+	}
+	return res, nil
+}
+
+// Returns the calls made by a function.
+func Calls(db Conn, caller int, instance int) ([]Call, error) {
+	var res []Call
+
+	err := retry(db, func(db Conn) error {
+		res = nil
+		rows, err := db.Query("select caller, callee, source_line, ref_addr from xrefs where caller =$1 and xref_instance_id_ref=$2", caller, instance)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			c := Call{Confidence: 1}
+			if err := rows.Scan(&c.Caller, &c.Callee, &c.SourceRef, &c.AddressRef); err != nil {
+				return err
+			}
+			res = append(res, c)
+		}
+		return rows.Err()
+	})
+	return res, err
+}
+
+// Returns the possible targets of the indirect calls made by a function, as
+// resolved by the extractor from ops structures and callbacks assignments,
+// each with the confidence of the resolution.
+func IndirectCalls(db Conn, caller int, instance int) ([]Call, error) {
+	var res []Call
+
+	err := retry(db, func(db Conn) error {
+		res = nil
+		rows, err := db.Query("select caller, callee, source_line, ref_addr, confidence from indirect_xrefs where caller=$1 and xref_instance_id_ref=$2", caller, instance)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			c := Call{Indirect: true}
+			if err := rows.Scan(&c.Caller, &c.Callee, &c.SourceRef, &c.AddressRef, &c.Confidence); err != nil {
+				return err
+			}
+			res = append(res, c)
+		}
+		return rows.Err()
+	})
+	return res, err
+}
+
+// Returns the largest of the subsystems a function belongs to, indirect for
+// the indirect call placeholders, empty if none.
+func SymbolSubsys(db Conn, name string, instance int) (string, error) {
+	var ty, sub sql.NullString
+
+	query := "select (select symbol_type from symbols where symbol_name=$1 and symbol_instance_id_ref=$2) as type, subsys_name from " +
+		"(select count(*) as cnt, subsys_name from tags where subsys_name in (select subsys_name from symbols, " +
+		"tags where symbols.symbol_file_ref_id=tags.tag_file_ref_id and symbols.symbol_name=$1 and symbols.symbol_instance_id_ref=$2) " +
+		"group by subsys_name order by cnt desc) as tbl;"
+	err := retry(db, func(db Conn) error {
+		ty, sub = sql.NullString{}, sql.NullString{}
+		rows, err := db.Query(query, name, instance)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := rows.Scan(&ty, &sub); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return "", err
+	}
+	if ty.String == "indirect" {
+		return ty.String, nil
+	}
+	return sub.String, nil
+}
+
+// Returns the names of the functions of an instance matching a regular
+// expression, in order.
+func SymbolsMatching(db Conn, re *regexp.Regexp, instance int) ([]string, error) {
+	var res []string
+	var name string
+
+	err := retry(db, func(db Conn) error {
+		res = nil
+		rows, err := db.Query("select distinct symbol_name from symbols where symbol_instance_id_ref=$1 order by symbol_name", instance)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			if re.MatchString(name) {
+				res = append(res, name)
+			}
+		}
+		return rows.Err()
+	})
+	return res, err
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdDiff = "diff"
+
+// Function level call edge.
+type callEdge struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+}
+
+// Call graph reduced to its sets of nodes and edges, used for comparisons,
+// and the calls found, whose ends tell apart same named functions.
+type callGraph struct {
+	nodes map[string]bool
+	edges map[callEdge]bool
+	calls []adjM
+}
+
+// Differences between two call graphs.
+type graphDiff struct {
+	Symbols      []string   `json:"symbols"`
+	Instances    [2]int     `json:"instances"`
+	AddedNodes   []string   `json:"added_nodes"`
+	RemovedNodes []string   `json:"removed_nodes"`
+	AddedEdges   []callEdge `json:"added_edges"`
+	RemovedEdges []callEdge `json:"removed_edges"`
+}
+
+// Explores the call tree of the given symbols in an instance, honoring depth
+// and exclusions, and returns it as a function level call graph.
+func exploreCallGraph(db navdb.Conn, conf *configuration, instance int, symbols []string) (callGraph, error) {
+	g := callGraph{nodes: map[string]bool{}, edges: map[callEdge]bool{}}
+	res := newNavResult()
+	nc := navConf{
+		ctx:            navdb.Context(db),
+		db:             db,
+		cache:          newCache(),
+		excludedAfter:  conf.ExcludedAfter,
+		excludedBefore: conf.ExcludedBefore,
+		includeOnly:    conf.IncludeOnly,
+		dotFmt:         fmtDot[graphOnly],
+		instance:       instance,
+		maxdepth:       conf.MaxDepth,
+		mode:           printAll,
+		followIndirect: conf.FollowIndirect,
+		dotFmtIndirect: fmtDotIndirect[graphOnly],
+	}
+	if conf.FollowIndirect {
+		if err := checkIndirect(db, instance); err != nil {
+			return g, err
+		}
+	}
+	out, err := compiledOut(db, conf, instance)
+	if err != nil {
+		return g, err
+	}
+	nc.compiledOut = out
+	if nc.module, err = moduleFilter(db, conf, instance); err != nil {
+		return g, err
+	}
+	if nc.visibility, err = visibilityAllowed(db, conf, instance); err != nil {
+		return g, err
+	}
+
+	for _, symbol := range symbols {
+		start, err := sym2num(db, symbol, instance)
+		if err != nil {
+			return g, err
+		}
+		g.nodes[symbol] = true
+		if !res.seen[start] {
+			navigate(&nc, &res, start, node{symbol: symbol}, 0)
+		}
+	}
+	for _, c := range res.calls {
+		g.nodes[c.r.symbol] = true
+		g.edges[callEdge{c.l.symbol, c.r.symbol}] = true
+	}
+	g.calls = res.calls
+	return g, nil
+}
+
+// Computes what changes going from the call graph a to b.
+func diffCallGraphs(a callGraph, b callGraph) graphDiff {
+	var d graphDiff
+
+	for n := range b.nodes {
+		if !a.nodes[n] {
+			d.AddedNodes = append(d.AddedNodes, n)
+		}
+	}
+	for n := range a.nodes {
+		if !b.nodes[n] {
+			d.RemovedNodes = append(d.RemovedNodes, n)
+		}
+	}
+	for e := range b.edges {
+		if !a.edges[e] {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for e := range a.edges {
+		if !b.edges[e] {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+	sort.Strings(d.AddedNodes)
+	sort.Strings(d.RemovedNodes)
+	sortEdges(d.AddedEdges)
+	sortEdges(d.RemovedEdges)
+	return d
+}
+
+// Sorts edges by caller and then callee.
+func sortEdges(edges []callEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Caller != edges[j].Caller {
+			return edges[i].Caller < edges[j].Caller
+		}
+		return edges[i].Callee < edges[j].Callee
+	})
+}
+
+// Renders the diff in a unified diff like text format.
+func (d graphDiff) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "--- instance %d\n+++ instance %d\n", d.Instances[0], d.Instances[1])
+	for _, n := range d.RemovedNodes {
+		fmt.Fprintf(&b, "- node %s\n", n)
+	}
+	for _, n := range d.AddedNodes {
+		fmt.Fprintf(&b, "+ node %s\n", n)
+	}
+	for _, e := range d.RemovedEdges {
+		fmt.Fprintf(&b, "- edge %s -> %s\n", e.Caller, e.Callee)
+	}
+	for _, e := range d.AddedEdges {
+		fmt.Fprintf(&b, "+ edge %s -> %s\n", e.Caller, e.Callee)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Implements the diff command.
+func cmdInstanceDiff(db navdb.Conn, conf *configuration) (string, error) {
+	var graphs [2]callGraph
+	var instances [2]int
+
+	for i, arg := range conf.cmdArgs {
+		instance, err := strconv.Atoi(arg)
+		if err != nil {
+			return "", err
+		}
+		instances[i] = instance
+		graphs[i], err = exploreCallGraph(db, conf, instance, conf.symbolList())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	d := diffCallGraphs(graphs[0], graphs[1])
+	d.Symbols = conf.symbolList()
+	d.Instances = instances
+	if opt2num(conf.Jout) == graphOnly {
+		return d.String(), nil
+	}
+	return jsonResult(cmdDiff, d)
+}
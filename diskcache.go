@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/output"
+)
+
+// Default lifetime of the cached results, in seconds.
+const defaultCacheTTL = 24 * 60 * 60
+
+// On disk cached result.
+type cacheEntry struct {
+	Created   time.Time `json:"created"`
+	Instance  string    `json:"instance"`
+	Output    string    `json:"output"`
+	Truncated string    `json:"truncated,omitempty"`
+}
+
+// Returns the directory holding cached results.
+func cacheDir(conf *configuration) (string, error) {
+	if conf.CacheDir != "" {
+		return conf.CacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "nav"), nil
+}
+
+// Computes the cache key from everything that affects the output: the
+// database identity and the query parameters.
+func cacheKey(conf *configuration) string {
+	key := struct {
+		DB             [5]string
+		DBPort         int
+		Instance       int
+		Symbols        []string
+		Match          string
+		ExploreMatches bool
+		Mode           outMode
+		MaxDepth       int
+		MaxNodes       int
+		MaxEdges       int
+		Strategy       string
+		Diagram        string
+		Dedup          bool
+		Jout           string
+		ExcludedBefore []string
+		ExcludedAfter  []string
+		IncludeOnly    []string
+		TargetSubsys   []string
+		ReportCycles   bool
+		Kconfig        map[string]string
+		FollowIndirect bool
+		Visibility     string
+		Namespace      string
+		Module         string
+		Src            [2]string
+		Resumable      bool
+		Resume         string
+	}{
+		[5]string{conf.DBDriver, conf.DBUrl, conf.DBUser, conf.DBTargetDB, conf.DBFile}, conf.DBPort, conf.Instance,
+		conf.symbolList(), conf.Match, conf.ExploreMatches, conf.Mode, conf.MaxDepth, conf.MaxNodes, conf.MaxEdges, conf.Strategy, conf.Diagram, conf.Dedup, conf.Jout,
+		conf.ExcludedBefore, conf.ExcludedAfter, conf.IncludeOnly, conf.TargetSubsys, conf.ReportCycles, conf.Kconfig, conf.FollowIndirect,
+		conf.Visibility, conf.Namespace, conf.Module, [2]string{conf.SrcTree, conf.SrcURL},
+		conf.Resumable, conf.resumeArg,
+	}
+	b, _ := json.Marshal(key)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the output for the configuration, serving it from the on disk cache
+// when a fresh entry exists. Entries expire after the configured TTL or when
+// the instance metadata changes, e.g. because the instance was reloaded.
+// Interrupted, hence partial, outputs are not stored, neither are the ones
+// with a runtime or coverage overlay or a template, since the files may change
+// under the same name.
+func cachedOutput(ctx context.Context, db navdb.Conn, conf *configuration, generate func() (string, error)) (string, error) {
+	var entry cacheEntry
+
+	if conf.NoCache || conf.Overlay != "" || conf.Coverage != "" || conf.Template != "" {
+		return generate()
+	}
+	dir, err := cacheDir(conf)
+	if err != nil {
+		return generate()
+	}
+	meta, _ := getInstanceMeta(db, conf.Instance)
+	fn := filepath.Join(dir, cacheKey(conf)+".json")
+
+	if b, err := os.ReadFile(fn); err == nil && json.Unmarshal(b, &entry) == nil {
+		fresh := conf.CacheTTL <= 0 || time.Since(entry.Created) < time.Duration(conf.CacheTTL)*time.Second
+		if fresh && entry.Instance == meta {
+			if entry.Truncated != "" {
+				setTruncated(conf, entry.Truncated)
+			}
+			return entry.Output, nil
+		}
+	}
+
+	out, err := generate()
+	if err != nil {
+		return "", err
+	}
+	if ctx.Err() != nil {
+		return out, nil
+	}
+	var truncated string
+	if conf.truncated != nil {
+		truncated = conf.truncated.Error()
+	}
+	// Jobs sharing the cache may store the same key at the same time, every
+	// one writes its own temporary file renamed in place.
+	b, err := json.Marshal(cacheEntry{time.Now(), meta, out, truncated})
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = output.Write(fn, false, b)
+	}
+	if err != nil {
+		logger.info("cache not stored", "file", fn, "error", err)
+	}
+	return out, nil
+}
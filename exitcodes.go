@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Exit codes, telling apart the failures scripts act upon. Bad arguments
+// and internal errors keep the historical -1 and -3.
+const (
+	exitSymbolNotFound   = 2
+	exitInstanceNotFound = 3
+	exitDBUnreachable    = 4
+	exitTruncated        = 5
+	exitBoundaryCrossed  = 6
+	exitInternal         = 253
+	exitBadArgs          = 255
+)
+
+// Names of the exit codes in the JSON errors.
+var exitNames = map[int]string{
+	exitSymbolNotFound:   "symbol_not_found",
+	exitInstanceNotFound: "instance_not_found",
+	exitDBUnreachable:    "db_unreachable",
+	exitTruncated:        "truncated",
+	exitBoundaryCrossed:  "boundary_crossed",
+	exitInternal:         "internal",
+	exitBadArgs:          "bad_arguments",
+}
+
+// Errors formats.
+const (
+	errorsText = "text"
+	errorsJSON = "json"
+)
+
+// Error with the exit code of its kind.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// JSON error report.
+type errorDoc struct {
+	SchemaVersion int    `json:"schema_version"`
+	Error         string `json:"error"`
+	ExitCode      int    `json:"exit_code"`
+	Message       string `json:"message"`
+}
+
+// Returns the exit code of an error, internal if it has no specific kind.
+func exitCode(err error) int {
+	var e exitError
+
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitInternal
+}
+
+// Returns the errors format selected by the arguments, looked up directly
+// since the errors of the arguments themselves are reported in it.
+func errorsFormat(args []string) string {
+	res := errorsText
+	for i, arg := range args {
+		if arg == "--errors" && i+1 < len(args) {
+			res = args[i+1]
+		}
+	}
+	return res
+}
+
+// Reports an error and exits with the code of its kind. The report is a line
+// on stdout prefixed by the failed step or, with the JSON errors format, a
+// JSON object on stderr.
+func fail(conf *configuration, step string, err error) {
+	code := exitCode(err)
+	if conf.Errors != errorsJSON {
+		fmt.Println(strings.TrimSpace(step + " " + err.Error()))
+		os.Exit(code)
+	}
+	b, _ := json.Marshal(errorDoc{schemaVersion, exitNames[code], code, err.Error()})
+	fmt.Fprintln(os.Stderr, string(b))
+	os.Exit(code)
+}
+
+// Records that the output is truncated, by the budget or an interruption,
+// reporting it on stderr with the text errors format.
+func setTruncated(conf *configuration, msg string) {
+	conf.truncated = exitError{exitTruncated, errors.New(msg)}
+	if conf.Errors != errorsJSON {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// Exits with the boundary crossed code, once the output is written, if the
+// compare command found new calls crossing the subsystem boundaries.
+func exitIfViolated(conf *configuration) {
+	if conf.violation != nil {
+		fail(conf, "", conf.violation)
+	}
+}
+
+// Exits with the truncated output code, once the output is written, if the
+// exploration was cut.
+func exitIfTruncated(conf *configuration) {
+	if conf.truncated == nil {
+		return
+	}
+	if conf.Errors == errorsJSON {
+		fail(conf, "", conf.truncated)
+	}
+	os.Exit(exitTruncated)
+}
@@ -1,7 +1,11 @@
-module nav
+module github.com/alessandrocarminati/nav
 
 go 1.18
 
 require (
-	github.com/lib/pq v1.10.6 // indirect
+	github.com/BurntSushi/toml v1.3.2
+	github.com/lib/pq v1.10.6
+	github.com/mattn/go-sqlite3 v1.14.17
+	golang.org/x/image v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Builds the graph from an exploration. Nodes are functions in printAll mode,
+// subsystems otherwise; their depth is the distance from the nearest start symbol.
+func newOutGraph(e *exploration, mode outMode) *graph.Graph {
+	g := graph.New()
+	seen := map[[2]int]bool{}
+
+	addEdge := func(l, r node, name func(node) string) {
+		from := g.AddNode(name(l), l.subsys)
+		to := g.AddNode(name(r), r.subsys)
+		if !seen[[2]int{from, to}] {
+			seen[[2]int{from, to}] = true
+			g.Edges = append(g.Edges, graph.Edge{SourceRef: r.sourceRef, AddressRef: r.addressRef, From: from, To: to, Indirect: r.indirect, Confidence: edgeConfidence(r)})
+		}
+	}
+
+	if mode == printAll {
+		symbol := func(n node) string { return n.symbol }
+		for _, n := range e.starts {
+			g.AddNode(n.symbol, n.subsys)
+		}
+		for _, c := range e.res.calls {
+			addEdge(c.l, c.r, symbol)
+		}
+	} else {
+		subsys := func(n node) string { return n.subsys }
+		for _, n := range e.starts {
+			g.AddNode(n.subsys, n.subsys)
+		}
+		for _, a := range e.res.adjm {
+			if mode != printTargeted || intargets(e.targets, a.l.subsys, a.r.subsys) {
+				addEdge(a.l, a.r, subsys)
+			}
+		}
+	}
+	g.ComputeDepth(len(e.starts))
+	if e.sources != nil && mode == printAll {
+		e.sources.annotate(g)
+	}
+	return g
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package graph
+
+import (
+	"sort"
+)
+
+// Returns the strongly connected components of the graph with Tarjan's
+// algorithm. Only the components that are cycles are returned, that is
+// the ones with more than one node or a node calling itself.
+func (g *Graph) SCC() [][]int {
+	var res [][]int
+	var stack []int
+	var visit func(v int)
+
+	succ := g.Successors()
+	index := make([]int, len(g.Nodes))
+	low := make([]int, len(g.Nodes))
+	onStack := make([]bool, len(g.Nodes))
+	for i := range index {
+		index[i] = -1
+	}
+	next := 0
+
+	visit = func(v int) {
+		index[v], low[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range succ[v] {
+			if index[w] < 0 {
+				visit(w)
+				if low[w] < low[v] {
+					low[v] = low[w]
+				}
+			} else if onStack[w] && index[w] < low[v] {
+				low[v] = index[w]
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var comp []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			comp = append(comp, w)
+			if w == v {
+				break
+			}
+		}
+		if len(comp) > 1 || calls(succ[v], v) {
+			res = append(res, comp)
+		}
+	}
+
+	for v := range g.Nodes {
+		if index[v] < 0 {
+			visit(v)
+		}
+	}
+	return res
+}
+
+// Checks if a node is among the successors.
+func calls(succ []int, v int) bool {
+	for _, w := range succ {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the graph has an edge between two nodes.
+func (g *Graph) HasEdge(from int, to int) bool {
+	for _, e := range g.Edges {
+		if e.From == from && e.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the immediate dominator of every node reachable from the root, -1
+// for the root and the unreachable ones, with the Cooper, Harvey and Kennedy
+// iterative algorithm.
+func (g *Graph) Dominators(root int) []int {
+	var order []int
+	var dfs func(v int)
+
+	succ := g.Successors()
+	pred := make([][]int, len(g.Nodes))
+	for _, e := range g.Edges {
+		pred[e.To] = append(pred[e.To], e.From)
+	}
+
+	// Reverse postorder numbering of the reachable nodes.
+	rpo := make([]int, len(g.Nodes))
+	for i := range rpo {
+		rpo[i] = -1
+	}
+	seen := make([]bool, len(g.Nodes))
+	dfs = func(v int) {
+		seen[v] = true
+		for _, w := range succ[v] {
+			if !seen[w] {
+				dfs(w)
+			}
+		}
+		order = append(order, v)
+	}
+	dfs(root)
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	for i, v := range order {
+		rpo[v] = i
+	}
+
+	idom := make([]int, len(g.Nodes))
+	for i := range idom {
+		idom[i] = -1
+	}
+	idom[root] = root
+	intersect := func(a, b int) int {
+		for a != b {
+			for rpo[a] > rpo[b] {
+				a = idom[a]
+			}
+			for rpo[b] > rpo[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, v := range order[1:] {
+			newIdom := -1
+			for _, p := range pred[v] {
+				if rpo[p] < 0 || idom[p] < 0 {
+					continue
+				}
+				if newIdom < 0 {
+					newIdom = p
+				} else {
+					newIdom = intersect(p, newIdom)
+				}
+			}
+			if newIdom != idom[v] {
+				idom[v] = newIdom
+				changed = true
+			}
+		}
+	}
+	idom[root] = -1
+	return idom
+}
+
+// Returns the names of the nodes, sorted.
+func (g *Graph) Names(nodes []int) []string {
+	res := make([]string, len(nodes))
+	for i, n := range nodes {
+		res[i] = g.Nodes[n].Name
+	}
+	sort.Strings(res)
+	return res
+}
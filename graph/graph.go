@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+// Package graph holds the call graphs explored by nav, with nodes being
+// functions or subsystems, and the algorithms analyzing them.
+package graph
+
+// Node of a call graph, either a function or a subsystem. Depth is the
+// distance from the nearest start node, Source links the function definition
+// when the kernel sources are given.
+type Node struct {
+	Name   string
+	Subsys string
+	Depth  int
+	Source string
+}
+
+// Call between two nodes, From and To are node indexes. Indirect calls are
+// the resolved ones, Confidence is 1 for the direct calls.
+type Edge struct {
+	SourceRef  string
+	AddressRef string
+	From       int
+	To         int
+	Indirect   bool
+	Confidence float64
+}
+
+// Edge kinds reported by the machine readable outputs.
+const (
+	Direct   = "direct"
+	Indirect = "indirect"
+)
+
+// Returns the kind of the edge.
+func (e Edge) Kind() string {
+	if e.Indirect {
+		return Indirect
+	}
+	return Direct
+}
+
+// Deduplicated call graph, nodes are indexed by name.
+type Graph struct {
+	Index map[string]int
+	Nodes []Node
+	Edges []Edge
+}
+
+// Returns an empty graph.
+func New() *Graph {
+	return &Graph{Index: map[string]int{}}
+}
+
+// Returns the index of the node, adding it if needed.
+func (g *Graph) AddNode(name string, subsys string) int {
+	if i, ok := g.Index[name]; ok {
+		return i
+	}
+	g.Index[name] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, Node{Name: name, Subsys: subsys, Depth: -1})
+	return len(g.Nodes) - 1
+}
+
+// Computes the nodes depth with a breadth first visit from the first n
+// nodes, which are the start ones. Unreachable nodes get depth 0.
+func (g *Graph) ComputeDepth(n int) {
+	var queue []int
+
+	succ := g.Successors()
+	for i := 0; i < n && i < len(g.Nodes); i++ {
+		g.Nodes[i].Depth = 0
+		queue = append(queue, i)
+	}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		for _, next := range succ[curr] {
+			if g.Nodes[next].Depth < 0 {
+				g.Nodes[next].Depth = g.Nodes[curr].Depth + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	for i := range g.Nodes {
+		if g.Nodes[i].Depth < 0 {
+			g.Nodes[i].Depth = 0
+		}
+	}
+}
+
+// Returns the adjacency lists of the graph.
+func (g *Graph) Successors() [][]int {
+	succ := make([][]int, len(g.Nodes))
+	for _, e := range g.Edges {
+		succ[e.From] = append(succ[e.From], e.To)
+	}
+	return succ
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Builds a graph from name pairs, the first node is the start one.
+func fromCalls(calls [][2]string) *Graph {
+	g := New()
+	for _, c := range calls {
+		from, to := g.AddNode(c[0], ""), g.AddNode(c[1], "")
+		g.Edges = append(g.Edges, Edge{From: from, To: to, Confidence: 1})
+	}
+	g.ComputeDepth(1)
+	return g
+}
+
+// Tests depth, components and dominators on a small graph.
+func TestGraph(t *testing.T) {
+	g := fromCalls([][2]string{{"start", "a"}, {"start", "b"}, {"a", "c"}, {"b", "c"}, {"c", "d"}, {"d", "c"}, {"d", "d"}})
+
+	if g.AddNode("a", "") != 1 || len(g.Nodes) != 5 {
+		t.Error("Duplicate node added", g.Nodes)
+	}
+	var depth []int
+	for _, n := range g.Nodes {
+		depth = append(depth, n.Depth)
+	}
+	if !reflect.DeepEqual(depth, []int{0, 1, 1, 2, 3}) {
+		t.Error("Unexpected depth", depth)
+	}
+
+	var comps [][]string
+	for _, c := range g.SCC() {
+		comps = append(comps, g.Names(c))
+	}
+	if !reflect.DeepEqual(comps, [][]string{{"c", "d"}}) {
+		t.Error("Unexpected components", comps)
+	}
+
+	if idom := g.Dominators(0); !reflect.DeepEqual(idom, []int{-1, 0, 0, 0, 3}) {
+		t.Error("Unexpected dominators", idom)
+	}
+	if g.Edges[0].Kind() != Direct || (Edge{Indirect: true}).Kind() != Indirect {
+		t.Error("Unexpected edge kinds")
+	}
+}
+
+// Tests the k shortest paths.
+func TestShortestPaths(t *testing.T) {
+	g := fromCalls([][2]string{{"start", "a"}, {"start", "b"}, {"a", "c"}, {"b", "c"}, {"c", "d"}, {"start", "d"}, {"b", "a"}})
+
+	var paths [][]string
+	for _, p := range g.ShortestPaths(0, g.Index["d"], 10) {
+		var names []string
+		for _, v := range p {
+			names = append(names, g.Nodes[v].Name)
+		}
+		paths = append(paths, names)
+	}
+	expected := [][]string{{"start", "d"}, {"start", "a", "c", "d"}, {"start", "b", "c", "d"}, {"start", "b", "a", "c", "d"}}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Error("Unexpected paths", paths)
+	}
+	if p := g.ShortestPaths(g.Index["d"], 0, 1); p != nil {
+		t.Error("Unexpected path to an unreachable node", p)
+	}
+}
+
+// Tests the heaviest paths search, its order and its limit.
+func TestHeaviestPaths(t *testing.T) {
+	g := fromCalls([][2]string{{"start", "a"}, {"start", "b"}, {"a", "c"}, {"b", "c"}, {"c", "a"}, {"c", "d"}, {"start", "d"}})
+	funcs := map[string]float64{"a": 1, "b": 2, "d": -1}
+	weight := func(u int, v int) float64 {
+		res := funcs[g.Nodes[v].Name]
+		if u == 0 && g.Nodes[v].Name == "a" {
+			res += 3
+		}
+		return res
+	}
+
+	paths, truncated := g.HeaviestPaths(0, g.Index["d"], 10, weight, 100)
+	if truncated || !reflect.DeepEqual(paths, [][]int{{0, 1, 3, 4}, {0, 2, 3, 4}, {0, 4}}) {
+		t.Error("Unexpected heaviest paths", paths, truncated)
+	}
+	paths, truncated = g.HeaviestPaths(0, g.Index["d"], 10, func(int, int) float64 { return 0 }, 100)
+	if truncated || len(paths) != 3 || !reflect.DeepEqual(paths[0], []int{0, 4}) {
+		t.Error("Unexpected shortest first paths of equal weight", paths, truncated)
+	}
+	if paths, truncated = g.HeaviestPaths(0, g.Index["d"], 10, weight, 2); !truncated || len(paths) > 1 {
+		t.Error("Unexpected limited paths", paths, truncated)
+	}
+	if paths, _ = g.HeaviestPaths(g.Index["d"], 0, 1, weight, 100); paths != nil {
+		t.Error("Unexpected path to an unreachable node", paths)
+	}
+}
+
+// Tests the subgraph of paths keeps only their nodes and edges.
+func TestSubgraph(t *testing.T) {
+	g := fromCalls([][2]string{{"start", "a"}, {"start", "b"}, {"a", "c"}, {"b", "c"}, {"c", "d"}})
+
+	s := g.Subgraph([][]int{{0, 2, 3}})
+	if !reflect.DeepEqual(s.Names([]int{0, 1, 2}), []string{"b", "c", "start"}) || s.Index["b"] != 1 || len(s.Nodes) != 3 {
+		t.Error("Unexpected subgraph nodes", s.Nodes)
+	}
+	if len(s.Edges) != 2 || !s.HasEdge(0, 1) || !s.HasEdge(1, 2) || s.Nodes[2].Depth != 2 {
+		t.Error("Unexpected subgraph edges", s.Edges)
+	}
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package graph
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Returns the shortest path between two nodes avoiding the blocked nodes and
+// edges with a breadth first visit, nil if there is none.
+func shortestPath(succ [][]int, from int, to int, nodes map[int]bool, edges map[[2]int]bool) []int {
+	prev := map[int]int{from: -1}
+	queue := []int{from}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		if v == to {
+			var path []int
+			for ; v >= 0; v = prev[v] {
+				path = append([]int{v}, path...)
+			}
+			return path
+		}
+		for _, w := range succ[v] {
+			if _, ok := prev[w]; ok || nodes[w] || edges[[2]int{v, w}] {
+				continue
+			}
+			prev[w] = v
+			queue = append(queue, w)
+		}
+	}
+	return nil
+}
+
+// Checks if two paths are the same.
+func samePath(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns up to k shortest simple paths between two nodes, ordered by
+// length, with Yen's algorithm.
+func (g *Graph) ShortestPaths(from int, to int, k int) [][]int {
+	var res, candidates [][]int
+
+	succ := g.Successors()
+	path := shortestPath(succ, from, to, nil, nil)
+	if path == nil || k <= 0 {
+		return nil
+	}
+	res = append(res, path)
+	for len(res) < k {
+		last := res[len(res)-1]
+		for i := 0; i < len(last)-1; i++ {
+			root := last[:i+1]
+			nodes := map[int]bool{}
+			for _, v := range root[:i] {
+				nodes[v] = true
+			}
+			edges := map[[2]int]bool{}
+			for _, p := range res {
+				if len(p) > i+1 && samePath(p[:i+1], root) {
+					edges[[2]int{p[i], p[i+1]}] = true
+				}
+			}
+			spur := shortestPath(succ, last[i], to, nodes, edges)
+			if spur == nil {
+				continue
+			}
+			candidate := append(append([]int{}, root[:i]...), spur...)
+			known := false
+			for _, p := range candidates {
+				known = known || samePath(p, candidate)
+			}
+			if !known {
+				candidates = append(candidates, candidate)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return len(candidates[i]) < len(candidates[j]) })
+		res = append(res, candidates[0])
+		candidates = candidates[1:]
+	}
+	return res
+}
+
+// Partial path of the heaviest paths search, with its weight and the bound
+// of the weight of its completions.
+type partialPath struct {
+	path   []int
+	weight float64
+	bound  float64
+}
+
+// Queue of the partial paths, highest bound and then shortest first.
+type pathQueue []partialPath
+
+func (q pathQueue) Len() int { return len(q) }
+
+func (q pathQueue) Less(i, j int) bool {
+	if q[i].bound != q[j].bound {
+		return q[i].bound > q[j].bound
+	}
+	return len(q[i].path) < len(q[j].path)
+}
+
+func (q pathQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(partialPath)) }
+
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	p := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return p
+}
+
+// Returns, for every node, a bound of the weight a simple path gains from it
+// to a node: the heaviest chain of the strongly connected components on the
+// way, each weighing the positive weights of its nodes reached by their
+// heaviest call. Nodes not reaching the target are not set.
+func (g *Graph) weightBounds(to int, weight func(u int, v int) float64) map[int]float64 {
+	succ := g.Successors()
+	pred := make([][]int, len(g.Nodes))
+	for v, ws := range succ {
+		for _, w := range ws {
+			pred[w] = append(pred[w], v)
+		}
+	}
+	reach := map[int]bool{to: true}
+	queue := []int{to}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, u := range pred[v] {
+			if !reach[u] {
+				reach[u] = true
+				queue = append(queue, u)
+			}
+		}
+	}
+
+	comp := make([]int, len(g.Nodes))
+	for i := range comp {
+		comp[i] = -1
+	}
+	comps := g.SCC()
+	for c, nodes := range comps {
+		for _, v := range nodes {
+			comp[v] = c
+		}
+	}
+	for v := range comp {
+		if comp[v] < 0 {
+			comp[v] = len(comps)
+			comps = append(comps, []int{v})
+		}
+	}
+
+	compWeight := make([]float64, len(comps))
+	for v := range reach {
+		var max float64
+		for _, u := range pred[v] {
+			if w := weight(u, v); w > max {
+				max = w
+			}
+		}
+		compWeight[comp[v]] += max
+	}
+	memo := make([]float64, len(comps))
+	done := make([]bool, len(comps))
+	var bound func(c int) float64
+	bound = func(c int) float64 {
+		if done[c] {
+			return memo[c]
+		}
+		var max float64
+		for _, v := range comps[c] {
+			for _, w := range succ[v] {
+				if reach[w] && comp[w] != c {
+					if b := bound(comp[w]); b > max {
+						max = b
+					}
+				}
+			}
+		}
+		memo[c], done[c] = compWeight[c]+max, true
+		return memo[c]
+	}
+	res := map[int]float64{}
+	for v := range reach {
+		res[v] = bound(comp[v])
+	}
+	return res
+}
+
+// Returns up to k simple paths between two nodes with the largest weights,
+// heaviest and then shortest first. The weight of a path is the sum of the
+// weights of its steps, given by weight(u, v) for the call from u to v and
+// weight(-1, from) for the start. The search is best first on the bound of
+// the weight of the path completions, so the paths found are the heaviest
+// ones; it stops after expanding limit paths, the second value reporting
+// whether it did.
+func (g *Graph) HeaviestPaths(from int, to int, k int, weight func(u int, v int) float64, limit int) ([][]int, bool) {
+	var res [][]int
+
+	bounds := g.weightBounds(to, weight)
+	if _, ok := bounds[from]; !ok || k <= 0 {
+		return nil, false
+	}
+	succ := g.Successors()
+	w := weight(-1, from)
+	q := &pathQueue{{[]int{from}, w, w + bounds[from]}}
+	for steps := 0; q.Len() > 0; steps++ {
+		if steps == limit {
+			return res, true
+		}
+		p := heap.Pop(q).(partialPath)
+		v := p.path[len(p.path)-1]
+		if v == to {
+			if res = append(res, p.path); len(res) == k {
+				break
+			}
+			continue
+		}
+		for _, n := range succ[v] {
+			b, ok := bounds[n]
+			if !ok || onPath(p.path, n) {
+				continue
+			}
+			w := p.weight + weight(v, n)
+			if n == to {
+				b = 0
+			}
+			heap.Push(q, partialPath{append(append([]int{}, p.path...), n), w, w + b})
+		}
+	}
+	return res, false
+}
+
+// Checks if a node is on a path.
+func onPath(path []int, v int) bool {
+	for _, w := range path {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the subgraph made of the paths, nodes in order of appearance so
+// that the start of the first path comes first.
+func (g *Graph) Subgraph(paths [][]int) *Graph {
+	res := New()
+	onPaths := map[[2]int]bool{}
+
+	for _, p := range paths {
+		for i, v := range p {
+			n := res.AddNode(g.Nodes[v].Name, g.Nodes[v].Subsys)
+			res.Nodes[n].Source = g.Nodes[v].Source
+			if i > 0 {
+				onPaths[[2]int{p[i-1], v}] = true
+			}
+		}
+	}
+	for _, e := range g.Edges {
+		if onPaths[[2]int{e.From, e.To}] {
+			e.From, e.To = res.Index[g.Nodes[e.From].Name], res.Index[g.Nodes[e.To].Name]
+			res.Edges = append(res.Edges, e)
+		}
+	}
+	res.ComputeDepth(1)
+	return res
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Indirect call edges, dashed and labeled with their confidence.
+var fmtDotIndirect = []string{
+	"",
+	"\"%s\"->\"%s\" [style=dashed label=\"%.2f\"]\n",
+	"\\\"%s\\\"->\\\"%s\\\" [style=dashed label=\\\"%.2f\\\"] \\\\\\n",
+	"\"%s\"->\"%s\" [style=dashed label=\"%.2f\"]\n",
+	"\"%s\"->\"%s\" [style=dashed label=\"%.2f\"]\n",
+}
+
+// Returns the kind of the edge leading to a node.
+func edgeKind(n node) string {
+	if n.indirect {
+		return graph.Indirect
+	}
+	return graph.Direct
+}
+
+// Returns the confidence of the edge leading to a node, direct calls are certain.
+func edgeConfidence(n node) float64 {
+	if n.indirect {
+		return n.confidence
+	}
+	return 1
+}
+
+// Checks the database has the indirect calls table.
+func checkIndirect(db navdb.Conn, instance int) error {
+	if _, err := queryCount(db, "select count(*) from indirect_xrefs where xref_instance_id_ref=$1", instance); err != nil {
+		return fmt.Errorf("the database has no indirect call data: %w", err)
+	}
+	return nil
+}
+
+// Returns the possible targets of the indirect calls made by a function, as
+// resolved by the extractor from ops structures and callbacks assignments,
+// each with the confidence of the resolution.
+func getIndirectSuccessorsById(db navdb.Conn, symbolId int, instance int, cache Cache) ([]entry, error) {
+	if res, ok := cache.indirect[symbolId]; ok {
+		return res, nil
+	}
+	calls, err := navdb.IndirectCalls(db, symbolId, instance)
+	if err != nil {
+		return nil, err
+	}
+	res := callees(db, calls, instance, cache)
+	logger.debug("rows fetched", "function", "getIndirectSuccessorsById", "id", symbolId, "rows", len(res))
+	cache.indirect[symbolId] = res
+	return res, nil
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdInfo = "info"
+
+// Everything the database knows about a symbol in an instance.
+// Attributes holds the symbols table row as stored by the extractor, so that
+// columns as address, size or export status are reported when present.
+type symbolInfo struct {
+	Name       string            `json:"name"`
+	Instance   int               `json:"instance"`
+	Attributes map[string]string `json:"attributes"`
+	File       string            `json:"file"`
+	Subsystems []string          `json:"subsystems"`
+	Callers    int               `json:"callers"`
+	Callees    int               `json:"callees"`
+	Instances  []int             `json:"instances"`
+	Source     string            `json:"source,omitempty"`
+	Snippet    []string          `json:"snippet,omitempty"`
+	columns    []string
+}
+
+// Returns the first column of a query as a list of strings.
+func queryColumn(db navdb.Conn, query string, args ...interface{}) ([]string, error) {
+	var res []string
+
+	_, lines, err := queryTable(db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		res = append(res, line[0])
+	}
+	return res, nil
+}
+
+// Returns a single integer computed by a query.
+func queryCount(db navdb.Conn, query string, args ...interface{}) (int, error) {
+	res, err := queryColumn(db, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 1 {
+		return 0, fmt.Errorf("unexpected result count %d", len(res))
+	}
+	return strconv.Atoi(res[0])
+}
+
+// Collects the metadata of every definition of a symbol in an instance.
+// Static functions may share the name, hence a list is returned.
+func getSymbolInfo(db navdb.Conn, symbol string, instance int) ([]symbolInfo, error) {
+	var res []symbolInfo
+
+	cols, lines, err := queryTable(db, "select * from symbols where symbol_name=$1 and symbol_instance_id_ref=$2 order by symbol_id", symbol, instance)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, symbolNotFound(db, symbol, instance)
+	}
+
+	instances, err := queryColumn(db, "select distinct symbol_instance_id_ref from symbols where symbol_name=$1 order by symbol_instance_id_ref", symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		info := symbolInfo{Name: symbol, Instance: instance, Attributes: map[string]string{}, columns: cols}
+		for i, c := range cols {
+			info.Attributes[c] = line[i]
+		}
+		for _, i := range instances {
+			n, err := strconv.Atoi(i)
+			if err != nil {
+				return nil, err
+			}
+			info.Instances = append(info.Instances, n)
+		}
+
+		files, err := queryColumn(db, "select file_name from files where file_id=$1", info.Attributes["symbol_file_ref_id"])
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 {
+			info.File = files[0]
+		}
+		info.Subsystems, err = queryColumn(db, "select distinct subsys_name from tags where tag_file_ref_id=$1 order by subsys_name", info.Attributes["symbol_file_ref_id"])
+		if err != nil {
+			return nil, err
+		}
+
+		id := info.Attributes["symbol_id"]
+		info.Callers, err = queryCount(db, "select count(distinct caller) from xrefs where callee=$1 and xref_instance_id_ref=$2", id, instance)
+		if err != nil {
+			return nil, err
+		}
+		info.Callees, err = queryCount(db, "select count(distinct callee) from xrefs where caller=$1 and xref_instance_id_ref=$2", id, instance)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// Formats the symbol metadata as a list of key value lines.
+func (info symbolInfo) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "symbol: %s\n", info.Name)
+	fmt.Fprintf(&b, "instance: %d\n", info.Instance)
+	for _, c := range info.columns {
+		if c == "symbol_name" || c == "symbol_instance_id_ref" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\n", c, info.Attributes[c])
+	}
+	fmt.Fprintf(&b, "file: %s\n", info.File)
+	fmt.Fprintf(&b, "subsystems: %s\n", strings.Join(info.Subsystems, " "))
+	fmt.Fprintf(&b, "callers: %d\n", info.Callers)
+	fmt.Fprintf(&b, "callees: %d\n", info.Callees)
+	instances := make([]string, len(info.Instances))
+	for i, n := range info.Instances {
+		instances[i] = strconv.Itoa(n)
+	}
+	fmt.Fprintf(&b, "instances: %s", strings.Join(instances, " "))
+	if info.Source != "" {
+		fmt.Fprintf(&b, "\nsource: %s", info.Source)
+	}
+	for _, l := range info.Snippet {
+		fmt.Fprintf(&b, "\n    %s", l)
+	}
+	return b.String()
+}
+
+// Implements the info command.
+func cmdSymbolInfo(db navdb.Conn, conf *configuration) (string, error) {
+	infos, err := getSymbolInfo(db, conf.cmdArgs[0], conf.Instance)
+	if err != nil {
+		return "", err
+	}
+	if src := newSourceTree(db, conf); src != nil {
+		for i := range infos {
+			src.describe(&infos[i], conf.Snippet)
+		}
+	}
+
+	if opt2num(conf.Jout) == graphOnly {
+		out := make([]string, len(infos))
+		for i, info := range infos {
+			out[i] = info.String()
+		}
+		return strings.Join(out, "\n\n"), nil
+	}
+	return jsonResult(cmdInfo, infos)
+}
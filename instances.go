@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdInstances = "instances"
+
+// Returns the instances table as a header and a list of rows.
+// All the columns are reported, so that whatever metadata the extractor
+// stores (kernel version, config, architecture, build date) is shown.
+func getInstances(db navdb.Conn) ([]string, [][]string, error) {
+	return queryTable(db, "select * from instances order by instance_id")
+}
+
+// Returns the metadata row of an instance joined in a single string,
+// used to detect changes of the instance.
+func getInstanceMeta(db navdb.Conn, instance int) (string, error) {
+	_, lines, err := queryTable(db, "select * from instances where instance_id=$1", instance)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) != 1 {
+		return "", exitError{exitInstanceNotFound, fmt.Errorf("instance %d not found", instance)}
+	}
+	return strings.Join(lines[0], "\t"), nil
+}
+
+// Runs a query returning all the columns as strings, along with their names.
+func queryTable(db navdb.Conn, query string, args ...interface{}) ([]string, [][]string, error) {
+	var res [][]string
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("queryTable: %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, fmt.Errorf("queryTable: %w", err)
+		}
+		line := make([]string, len(cols))
+		for i, v := range values {
+			line[i] = v.String
+		}
+		res = append(res, line)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("queryTable: %w", err)
+	}
+	return cols, res, nil
+}
+
+// Implements the instances command.
+func cmdListInstances(db navdb.Conn, _ *configuration) (string, error) {
+	cols, lines, err := getInstances(db)
+	if err != nil {
+		return "", err
+	}
+
+	out := strings.Join(cols, "\t") + "\n"
+	for _, line := range lines {
+		out += strings.Join(line, "\t") + "\n"
+	}
+	return strings.TrimSuffix(out, "\n"), nil
+}
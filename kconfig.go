@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Kconfig option states.
+const (
+	kconfigOn  = "on"
+	kconfigOff = "off"
+)
+
+// Parses a CONFIG_FOO=on/off filter, y and n are accepted as well.
+func parseKconfig(s string) (string, string, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !strings.HasPrefix(name, "CONFIG_") {
+		return "", "", fmt.Errorf("invalid config filter %s, expected CONFIG_FOO=on/off", s)
+	}
+	switch strings.TrimSpace(value) {
+	case kconfigOn, "y":
+		return name, kconfigOn, nil
+	case kconfigOff, "n":
+		return name, kconfigOff, nil
+	}
+	return "", "", fmt.Errorf("invalid config value in %s, expected on or off", s)
+}
+
+// Returns the ids of the functions of the instance compiled out by the
+// configuration filters, i.e. defined in files built only under an option
+// set off. The extractor stores in the configs table the options gating
+// every file; a database without it can not be filtered.
+func compiledOut(db navdb.Conn, conf *configuration, instance int) (map[int]bool, error) {
+	var off []string
+
+	for name, value := range conf.Kconfig {
+		if value == kconfigOff {
+			off = append(off, name)
+		}
+	}
+	if len(off) == 0 {
+		return nil, nil
+	}
+	sort.Strings(off)
+
+	res := map[int]bool{}
+	for _, name := range off {
+		ids, err := queryColumn(db, "select symbol_id from symbols, configs where symbols.symbol_file_ref_id=configs.config_file_ref_id "+
+			"and configs.config_name=$1 and symbols.symbol_instance_id_ref=$2", name, instance)
+		if err != nil {
+			return nil, fmt.Errorf("the database has no per file configuration data: %w", err)
+		}
+		for _, id := range ids {
+			n, err := strconv.Atoi(id)
+			if err != nil {
+				return nil, errors.New("invalid symbol id " + id)
+			}
+			res[n] = true
+		}
+		logger.info("config filter", "config", name, "compiled out", len(ids))
+	}
+	return res, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Log verbosity levels.
+const (
+	logQuiet = iota
+	logInfo
+	logDebug
+)
+
+// Log formats.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Leveled logger emitting text or JSON lines.
+type navLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  int
+	format string
+}
+
+// Application logger, silent until configured.
+var logger = &navLogger{out: io.Discard}
+
+// Configures the application logger, the returned function closes the log file.
+func setupLogger(conf *configuration) (func(), error) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+
+	logger.level = conf.LogLevel
+	logger.format = conf.LogFormat
+	logger.out = os.Stderr
+	if conf.LogFile == "" {
+		return func() {}, nil
+	}
+	f, err := os.OpenFile(conf.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logger.out = f
+	return func() { f.Close() }, nil
+}
+
+// Emits a message with the given key value pairs, if the level is enabled.
+func (l *navLogger) log(level int, msg string, kv ...interface{}) {
+	if level > l.level {
+		return
+	}
+	now := time.Now().Format(time.RFC3339Nano)
+	name := map[int]string{logInfo: "info", logDebug: "debug"}[level]
+
+	var line string
+	if l.format == logFormatJSON {
+		rec := map[string]interface{}{"time": now, "level": name, "msg": msg}
+		for i := 0; i+1 < len(kv); i += 2 {
+			rec[fmt.Sprint(kv[i])] = kv[i+1]
+		}
+		b, _ := json.Marshal(rec)
+		line = string(b)
+	} else {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s %s", now, strings.ToUpper(name), msg)
+		for i := 0; i+1 < len(kv); i += 2 {
+			fmt.Fprintf(&b, " %v=%q", kv[i], fmt.Sprint(kv[i+1]))
+		}
+		line = b.String()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.out, line)
+}
+
+func (l *navLogger) info(msg string, kv ...interface{}) {
+	l.log(logInfo, msg, kv...)
+}
+
+func (l *navLogger) debug(msg string, kv ...interface{}) {
+	l.log(logDebug, msg, kv...)
+}
+
+// Connection logging the issued queries.
+type logConn struct {
+	navdb.Conn
+}
+
+func (db logConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.Conn.QueryContext(ctx, query, args...)
+	logger.debug("query", "sql", query, "args", args, "elapsed", time.Since(start).String(), "error", err)
+	return rows, err
+}
+
+func (db logConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
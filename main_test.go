@@ -6,10 +6,15 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	navdb "github.com/alessandrocarminati/nav/db"
 )
 
 // Utility function to compare two configuration struct instances.
@@ -117,3 +122,368 @@ func TestConfig(t *testing.T) {
 	}
 
 }
+
+// Tests the symbols list collected from repeated and comma separated switches.
+func TestSymbolList(t *testing.T) {
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a,b", "-s", "c"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing multiple symbols", err)
+	}
+	if l := conf.symbolList(); len(l) != 3 || l[0] != "a" || l[1] != "b" || l[2] != "c" {
+		t.Error("Unexpected symbol list", l)
+	}
+
+	os.Args = []string{"nav", "-i", "1", "--regex", "-s", "foo_{1,3},[a,b]x,bar"}
+	conf, err = argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing patterns", err)
+	}
+	if l := conf.symbolList(); len(l) != 3 || l[0] != "foo_{1,3}" || l[1] != "[a,b]x" || l[2] != "bar" {
+		t.Error("Unexpected pattern list", l)
+	}
+
+	fn := filepath.Join(t.TempDir(), "symbols")
+	if err := os.WriteFile(fn, []byte("# comment\nx\n\ny\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"nav", "-i", "1", "-S", fn}
+	conf, err = argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing symbol file", err)
+	}
+	if l := conf.symbolList(); len(l) != 2 || l[0] != "x" || l[1] != "y" {
+		t.Error("Unexpected symbol list from file", l)
+	}
+}
+
+// Tests the long switches given in the --switch=value form.
+func TestLongArgs(t *testing.T) {
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--max-nodes=5", "--quiet=true", "--dedup=false"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing long switches", err)
+	}
+	if conf.MaxNodes != 5 || !conf.Quiet || conf.Dedup {
+		t.Error("Unexpected long switches values", conf.MaxNodes, conf.Quiet, conf.Dedup)
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--quiet=yes"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Invalid value of a switch without value not detected")
+	}
+}
+
+// Tests subcommands parsing.
+func TestSubCmd(t *testing.T) {
+
+	os.Args = []string{"nav", "instances"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil || conf.command != cmdInstances {
+		t.Error("Unexpected error parsing instances command", err)
+	}
+
+	os.Args = []string{"nav", "-l"}
+	conf, err = argsParse(cmdLineItemInit())
+	if err != nil || conf.command != cmdInstances {
+		t.Error("Unexpected error parsing -l switch", err)
+	}
+
+	os.Args = []string{"nav", "instances", "extra"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Unexpected extra argument not detected")
+	}
+
+	os.Args = []string{"nav", "nonexistent"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Unknown command not detected")
+	}
+}
+
+// Tests the command line filters and their validation.
+func TestFilters(t *testing.T) {
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--exclude-before", "rcu_.*", "--exclude-after", "kfree", "--exclude-after", "kmalloc", "--include-only", "MM"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing filters", err)
+	}
+	if len(conf.ExcludedBefore) != 1 || len(conf.ExcludedAfter) != 2 || len(conf.IncludeOnly) != 1 {
+		t.Error("Unexpected filters", conf.ExcludedBefore, conf.ExcludedAfter, conf.IncludeOnly)
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--exclude-after", "(rcu"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Invalid filter regex not detected")
+	}
+}
+
+// Tests the TLS options validation and connection string.
+func TestSSL(t *testing.T) {
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--sslmode", "verify-full", "--sslrootcert", "/etc/ca.pem", "--sslcert", "/my cert.pem", "--sslkey", "key.pem"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing ssl options", err)
+	}
+	tok := navdb.Token{Host: "h", Port: 5432, User: "u", Pass: "p'w", DBName: "d", SSL: navdb.SSLOptions{Mode: conf.DBSSLMode, RootCert: conf.DBSSLRootCert, Cert: conf.DBSSLCert, Key: conf.DBSSLKey}}
+	if dsn := tok.DSN(); dsn != `host='h' port=5432 user='u' password='p\'w' dbname='d' sslmode=verify-full sslrootcert='/etc/ca.pem' sslcert='/my cert.pem' sslkey='key.pem' default_transaction_read_only=on` {
+		t.Error("Unexpected connection string", dsn)
+	}
+
+	for _, mode := range []string{"bogus", "prefer"} {
+		os.Args = []string{"nav", "-i", "1", "-s", "a", "--sslmode", mode}
+		if _, err = argsParse(cmdLineItemInit()); err == nil {
+			t.Error("Invalid sslmode not detected", mode)
+		}
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--sslcert", "cert.pem"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Client certificate without key not detected")
+	}
+}
+
+// Tests verbosity switches and the log output.
+func TestLogger(t *testing.T) {
+
+	fn := filepath.Join(t.TempDir(), "nav.log")
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "-vv", "--log-format=json", "--log-file", fn}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing log options", err)
+	}
+	if conf.LogLevel != logDebug || conf.LogFormat != logFormatJSON || conf.LogFile != fn {
+		t.Error("Unexpected log configuration", conf.LogLevel, conf.LogFormat, conf.LogFile)
+	}
+
+	closeLog, err := setupLogger(&conf)
+	if err != nil {
+		t.Fatal("Unexpected error opening log", err)
+	}
+	logger.info("visit", "symbol", "a")
+	conf.LogLevel = logQuiet
+	closeLog()
+	setupLogger(&conf)
+
+	b, err := os.ReadFile(fn)
+	if err != nil || !strings.Contains(string(b), `"msg":"visit"`) || !strings.Contains(string(b), `"symbol":"a"`) {
+		t.Error("Unexpected log content", string(b), err)
+	}
+}
+
+// Tests the progress indicator status line.
+func TestProgress(t *testing.T) {
+	var b strings.Builder
+
+	p := progress{out: &b, start: time.Now(), discovered: map[int]bool{}}
+	p.last = p.start
+	for i := 0; i < 10; i++ {
+		p.discover(i)
+	}
+	for i := 0; i < 5; i++ {
+		p.visit(i)
+	}
+	if b.String() != "" {
+		t.Error("Unexpected progress output for a quick exploration", b.String())
+	}
+	p.print(p.start.Add(10 * time.Second))
+	if b.String() != "visited 5 frontier 5 elapsed 10s eta 10s\n" {
+		t.Error("Unexpected progress output", b.String())
+	}
+}
+
+// Tests the JSON Schema document and the versioned results.
+func TestSchema(t *testing.T) {
+	var doc struct {
+		Defs map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+			Required   []string               `json:"required"`
+		} `json:"$defs"`
+	}
+
+	os.Args = []string{"nav", "--schema"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil || conf.command != cmdSchema {
+		t.Fatal("Unexpected error parsing --schema switch", err)
+	}
+	out, err := cmdPrintSchema(nil, &conf)
+	if err != nil || json.Unmarshal([]byte(out), &doc) != nil {
+		t.Fatal("Invalid schema document", out, err)
+	}
+	for _, name := range []string{"graph", "ndjson_header", "ndjson_edge", cmdDiff, cmdInfo, cmdTrace, cmdStats, cmdSearch, cmdMatch, cmdSCC, cmdDominators} {
+		if _, ok := doc.Defs[name]; !ok {
+			t.Error("Missing definition", name)
+		}
+	}
+	if doc.Defs["graph"].Properties["schema_version"] == nil || strings.Contains(strings.Join(doc.Defs["graph"].Required, ","), "cycles") {
+		t.Error("Unexpected graph definition", doc.Defs["graph"])
+	}
+	if doc.Defs[cmdTrace].Properties["result"].(map[string]interface{})["type"] != "array" {
+		t.Error("Unexpected trace definition", doc.Defs[cmdTrace])
+	}
+
+	out, err = jsonResult(cmdSCC, [][]string{{"a", "b"}})
+	if err != nil || out != `{"schema_version":1,"command":"scc","result":[["a","b"]]}` {
+		t.Error("Unexpected versioned result", out, err)
+	}
+}
+
+// Tests the connection pool options.
+func TestPoolOptions(t *testing.T) {
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--pool-size", "4", "--parallel", "2", "--query-timeout", "30s"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing pool options", err)
+	}
+	timeout, _ := time.ParseDuration(conf.DBQueryTimeout)
+	tok := navdb.Token{Host: "h", Port: 5432, User: "u", Pass: "p", DBName: "d", PoolSize: conf.DBPoolSize, StatementTimeout: timeout}
+	if dsn := tok.DSN(); !strings.HasSuffix(dsn, " default_transaction_read_only=on statement_timeout=30000") {
+		t.Error("Unexpected connection string", dsn)
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--pool-size", "3", "--parallel", "3"}
+	if _, err = argsParse(cmdLineItemInit()); err != nil {
+		t.Error("Pool as large as the parallel lookups rejected", err)
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--pool-size", "2", "--parallel", "3"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Pool smaller than the parallel lookups not detected")
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--query-timeout", "soon"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Invalid query timeout not detected")
+	}
+}
+
+// Tests the configuration check and the effective configuration sources.
+func TestConfigCommand(t *testing.T) {
+
+	fn := filepath.Join(t.TempDir(), "conf.json")
+	if err := os.WriteFile(fn, []byte(`{"DBUrl": "db.example.org", "maxdepth": 2, "MaxDepht": 3, "Mode": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"nav", "-f", fn, "-m", "2", "config", "show"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing config command", err)
+	}
+	out, err := cmdConfiguration(nil, &conf)
+	lines := map[string]bool{}
+	for _, l := range strings.Split(out, "\n") {
+		lines[l] = true
+	}
+	for _, l := range []string{"DBUrl\t\"db.example.org\"\tfile", "MaxDepth\t2\tfile", "Mode\t2\tcommand line", "DBPort\t5432\tdefault"} {
+		if err != nil || !lines[l] {
+			t.Error("Missing", l, "in config show output", out, err)
+		}
+	}
+
+	conf.cmdArgs = []string{"check"}
+	if _, err = cmdConfiguration(nil, &conf); err == nil || err.Error() != "unknown key MaxDepht, did you mean MaxDepth?" {
+		t.Error("Unexpected config check result", err)
+	}
+
+	os.Args = []string{"nav", "-f", "conf.json", "config", "check"}
+	if conf, err = argsParse(cmdLineItemInit()); err != nil {
+		t.Fatal("Unexpected error parsing config command", err)
+	}
+	if out, err = cmdConfiguration(nil, &conf); err != nil || out != "configuration ok" {
+		t.Error("Sample configuration not valid", out, err)
+	}
+}
+
+// Tests the YAML and TOML configuration files layered with includes.
+func TestConfigFormats(t *testing.T) {
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.toml": "# shared settings\nDBUrl = \"db.example.org\"\nDBPort = 5433\nExcludedAfter = [\n  \".*rcu.*\", # rcu helpers\n  '__.*',\n]\nMaxDepth = 4\nProfiles = { quick = { MaxDepth = 1 } }\n",
+		"user.yaml": "include: base.toml\nmaxdepth: 2\nDBUser: 'jdoe'\nExcludedBefore:\n  - \"kfree\"\n  - 'print#k' # quoted hash\nTargetSubsys: [mm, \"fs\"]\n",
+		"bad.yml":   "include: [user.yaml]\nDBPort: high\n",
+		"loop.yaml": "include: loop.toml\n",
+		"loop.toml": "include = [\"loop.yaml\"]\n",
+	}
+	for fn, s := range files {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := defaultConfig
+	if err := funcJconf(&conf, []string{filepath.Join(dir, "user.yaml")}); err != nil {
+		t.Fatal("Unexpected error reading layered configuration", err)
+	}
+	if conf.DBUrl != "db.example.org" || conf.DBPort != 5433 || conf.DBUser != "jdoe" || conf.MaxDepth != 2 ||
+		strings.Join(conf.ExcludedAfter, " ") != ".*rcu.* __.*" || strings.Join(conf.ExcludedBefore, " ") != "kfree print#k" ||
+		strings.Join(conf.TargetSubsys, " ") != "mm fs" || conf.Profiles["quick"]["MaxDepth"] != float64(1) {
+		t.Errorf("Unexpected layered configuration %+v", conf)
+	}
+
+	conf = defaultConfig
+	if err := funcJconf(&conf, []string{filepath.Join(dir, "bad.yml")}); err == nil || !strings.Contains(err.Error(), "DBPort") {
+		t.Error("Wrong type not reported", err)
+	}
+	if err := funcJconf(&conf, []string{filepath.Join(dir, "loop.yaml")}); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Error("Include cycle not reported", err)
+	}
+}
+
+// Tests the profiles of the configuration file and their precedence.
+func TestProfiles(t *testing.T) {
+
+	fn := filepath.Join(t.TempDir(), "conf.yaml")
+	conf := "MaxDepth: 1\nProfile: quick\nProfiles:\n  quick:\n    MaxDepth: 2\n  audit:\n    MaxDepth: 5\n    Mode: 4\n    ExcludedAfter:\n    - \".*rcu.*\"\n    Jout: mermaid\n  typo:\n    MaxDepht: 3\n"
+	if err := os.WriteFile(fn, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		args     []string
+		maxDepth int
+		mode     outMode
+		jout     string
+	}{
+		{[]string{"-f", fn}, 2, printSubsys, "graphOnly"},
+		{[]string{"--profile", "audit", "-f", fn}, 5, 4, "mermaid"},
+		{[]string{"-f", fn, "--profile=audit", "-x", "3", "-j", "graphOnly"}, 3, 4, "graphOnly"},
+		{[]string{"-x", "3", "-f", fn, "--profile", "audit"}, 5, 4, "mermaid"},
+	}
+	for _, test := range tests {
+		os.Args = append([]string{"nav", "-i", "1", "-s", "a"}, test.args...)
+		c, err := argsParse(cmdLineItemInit())
+		if err != nil || c.MaxDepth != test.maxDepth || c.Mode != test.mode || c.Jout != test.jout {
+			t.Error("Unexpected profile configuration", test.args, c.MaxDepth, c.Mode, c.Jout, err)
+		}
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "-f", fn, "--profile", "deep"}
+	if _, err := argsParse(cmdLineItemInit()); err == nil || err.Error() != "unknown profile deep" {
+		t.Error("Unknown profile not reported", err)
+	}
+
+	os.Args = []string{"nav", "-f", fn, "--profile", "audit", "-x", "3", "-j", "graphOnly", "config", "show"}
+	c, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmdConfiguration(nil, &c)
+	lines := map[string]bool{}
+	for _, l := range strings.Split(out, "\n") {
+		lines[l] = true
+	}
+	for _, l := range []string{"Profile\t\"audit\"\tcommand line", "Mode\t4\tprofile", "MaxDepth\t3\tcommand line", "ExcludedAfter\t[\".*rcu.*\"]\tprofile"} {
+		if err != nil || !lines[l] {
+			t.Error("Missing", l, "in config show output", out, err)
+		}
+	}
+	c.cmdArgs = []string{"check"}
+	if _, err = cmdConfiguration(nil, &c); err == nil || err.Error() != "unknown key MaxDepht in profile typo, did you mean MaxDepth?" {
+		t.Error("Unexpected config check result", err)
+	}
+}
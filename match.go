@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Symbol matching modes.
+const (
+	matchExact = ""
+	matchRegex = "regex"
+	matchGlob  = "glob"
+)
+
+// Command name of the matches listing in the JSON output.
+const cmdMatch = "match"
+
+// Converts a shell like glob pattern into an anchored regular expression.
+func glob2regex(glob string) string {
+	var b strings.Builder
+
+	b.WriteString("^")
+	for _, c := range glob {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Compiles the symbols into patterns according to the matching mode.
+// Invalid expressions are reported at parse time.
+func (conf *configuration) symbolPatterns() ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+
+	switch conf.Match {
+	case matchExact:
+		return nil, nil
+	case matchRegex, matchGlob:
+	default:
+		return nil, fmt.Errorf("unknown match mode %s", conf.Match)
+	}
+	for _, p := range conf.symbolList() {
+		if conf.Match == matchGlob {
+			p = glob2regex(p)
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid symbol pattern %s: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Returns the sorted, deduplicated list of symbols in the instance matching any of the patterns.
+func matchSymbols(db navdb.Conn, conf *configuration) ([]string, error) {
+	var res []string
+	found := map[string]bool{}
+
+	patterns, err := conf.symbolPatterns()
+	if err != nil {
+		return nil, err
+	}
+	for _, re := range patterns {
+		symbols, err := navdb.SymbolsMatching(db, re, conf.Instance)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range symbols {
+			if !found[s] {
+				found[s] = true
+				res = append(res, s)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Returns the listing of the matches, one per line, or the JSON document
+// listing them when a JSON output type is selected.
+func matchListing(conf *configuration, matches []string) (string, error) {
+	var b strings.Builder
+
+	if opt2num(conf.Jout) != graphOnly {
+		if matches == nil {
+			matches = []string{}
+		}
+		out, err := jsonResult(cmdMatch, matches)
+		return out + "\n", err
+	}
+	for _, symbol := range matches {
+		b.WriteString(symbol + "\n")
+	}
+	return b.String(), nil
+}
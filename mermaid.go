@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Escapes a label for use within a quoted mermaid string.
+func mermaidLabel(s string) string {
+	return strings.ReplaceAll(s, "\"", "#quot;")
+}
+
+// Assigns stable mermaid identifiers to labels, in order of appearance.
+type mermaidIds struct {
+	ids   map[string]string
+	order []string
+}
+
+func (m *mermaidIds) id(label string) string {
+	if id, ok := m.ids[label]; ok {
+		return id
+	}
+	id := fmt.Sprintf("n%d", len(m.order))
+	m.ids[label] = id
+	m.order = append(m.order, label)
+	return id
+}
+
+// Renders the exploration as a mermaid flowchart.
+// Function level graphs group symbols in one subgraph per subsystem,
+// subsystem level graphs use subsystems as nodes. Functions link to their
+// source when known.
+func mermaid(e *exploration, mode outMode) string {
+	var edges []string
+	var b strings.Builder
+	ids := mermaidIds{ids: map[string]string{}}
+	seen := map[string]bool{}
+
+	b.WriteString("flowchart LR\n")
+	if mode == printAll {
+		subsysOf := map[string]string{}
+		var subsystems []string
+		addNode := func(n node) {
+			ids.id(n.symbol)
+			if _, ok := subsysOf[n.symbol]; ok {
+				return
+			}
+			subsysOf[n.symbol] = n.subsys
+			if notInStr(subsystems, n.subsys) {
+				subsystems = append(subsystems, n.subsys)
+			}
+		}
+		for _, n := range e.starts {
+			addNode(n)
+		}
+		for _, c := range e.res.calls {
+			addNode(c.l)
+			addNode(c.r)
+			arrow := "-->"
+			if c.r.indirect {
+				arrow = "-.->"
+			}
+			edges = append(edges, fmt.Sprintf("    %s %s %s\n", ids.id(c.l.symbol), arrow, ids.id(c.r.symbol)))
+		}
+		for i, subsys := range subsystems {
+			fmt.Fprintf(&b, "    subgraph s%d [\"%s\"]\n", i, mermaidLabel(subsys))
+			for _, symbol := range ids.order {
+				if subsysOf[symbol] == subsys {
+					fmt.Fprintf(&b, "        %s[\"%s\"]\n", ids.id(symbol), mermaidLabel(symbol))
+				}
+			}
+			b.WriteString("    end\n")
+		}
+	} else {
+		for _, n := range e.starts {
+			ids.id(n.subsys)
+		}
+		for _, a := range e.res.adjm {
+			if mode == printTargeted && !intargets(e.targets, a.l.subsys, a.r.subsys) {
+				continue
+			}
+			edges = append(edges, fmt.Sprintf("    %s --> %s\n", ids.id(a.l.subsys), ids.id(a.r.subsys)))
+		}
+		for _, subsys := range ids.order {
+			fmt.Fprintf(&b, "    %s[\"%s\"]\n", ids.id(subsys), mermaidLabel(subsys))
+		}
+	}
+	for _, edge := range edges {
+		if !seen[edge] {
+			seen[edge] = true
+			b.WriteString(edge)
+		}
+	}
+	if e.sources != nil && mode == printAll {
+		for _, symbol := range ids.order {
+			if link := e.sources.symbolLink(symbol); link != "" {
+				fmt.Fprintf(&b, "    click %s href \"%s\"\n", ids.id(symbol), mermaidLabel(link))
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Returns true if a string is not in the list.
+func notInStr(list []string, v string) bool {
+	for _, a := range list {
+		if a == v {
+			return false
+		}
+	}
+	return true
+}
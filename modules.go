@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdModules = "modules"
+
+// Module of the functions built into the kernel image.
+const moduleBuiltin = "vmlinux"
+
+// Call crossing the boundary between two modules.
+type moduleEdge struct {
+	Caller       string `json:"caller"`
+	CallerModule string `json:"caller_module"`
+	Callee       string `json:"callee"`
+	CalleeModule string `json:"callee_module"`
+}
+
+// Returns the module of every function of the instance built as module, by
+// id since static functions of different modules may share the name. The
+// extractor stores in the modules table the .ko every file is linked into;
+// files not listed are built in.
+func getSymbolModules(db navdb.Conn, instance int) (map[int]string, error) {
+	_, rows, err := queryTable(db, "select symbol_id, module_name from symbols, modules where symbols.symbol_file_ref_id=modules.module_file_ref_id "+
+		"and symbols.symbol_instance_id_ref=$1", instance)
+	if err != nil {
+		return nil, fmt.Errorf("the database has no module data: %w", err)
+	}
+	res := map[int]string{}
+	for _, r := range rows {
+		id, err := strconv.Atoi(r[0])
+		if err != nil {
+			return nil, errors.New("invalid symbol id " + r[0])
+		}
+		res[id] = r[1]
+	}
+	return res, nil
+}
+
+// Returns the module of a function.
+func symbolModule(modules map[int]string, id int) string {
+	if m, ok := modules[id]; ok {
+		return m
+	}
+	return moduleBuiltin
+}
+
+// Returns the functions of the instance in the module the exploration is
+// restricted to, nil if it is not. The functions built in are most of the
+// kernel, so for vmlinux the set hides the ones built as module instead.
+func moduleFilter(db navdb.Conn, conf *configuration, instance int) (*symbolSet, error) {
+	var ids []string
+	var err error
+
+	switch conf.Module {
+	case "":
+		return nil, nil
+	case moduleBuiltin:
+		ids, err = queryColumn(db, "select symbol_id from symbols where symbol_instance_id_ref=$1 and symbol_file_ref_id in "+
+			"(select module_file_ref_id from modules)", instance)
+	default:
+		ids, err = queryColumn(db, "select symbol_id from symbols where symbol_instance_id_ref=$1 and symbol_file_ref_id in "+
+			"(select module_file_ref_id from modules where module_name=$2)", instance, conf.Module)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the database has no module data: %w", err)
+	}
+	logger.info("module filter", "module", conf.Module, "functions", len(ids))
+	return newSymbolSet(ids, conf.Module == moduleBuiltin)
+}
+
+// Implements the modules command: lists the calls of the call tree of the
+// symbol going from a module to another.
+func cmdModuleEdges(db navdb.Conn, conf *configuration) (string, error) {
+	res := []moduleEdge{}
+
+	modules, err := getSymbolModules(db, conf.Instance)
+	if err != nil {
+		return "", err
+	}
+	g, err := exploreCallGraph(db, conf, conf.Instance, conf.symbolList())
+	if err != nil {
+		return "", err
+	}
+	seen := map[moduleEdge]bool{}
+	for _, c := range g.calls {
+		e := moduleEdge{c.l.symbol, symbolModule(modules, c.l.id), c.r.symbol, symbolModule(modules, c.r.id)}
+		if e.CallerModule != e.CalleeModule && !seen[e] {
+			seen[e] = true
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Caller != res[j].Caller {
+			return res[i].Caller < res[j].Caller
+		}
+		return res[i].Callee < res[j].Callee
+	})
+
+	if opt2num(conf.Jout) != graphOnly {
+		return jsonResult(cmdModules, res)
+	}
+	lines := []string{"caller\tcaller_module\tcallee\tcallee_module"}
+	for _, e := range res {
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s\t%s", e.Caller, e.CallerModule, e.Callee, e.CalleeModule))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -8,12 +8,18 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
-	"database/sql"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"time"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/output"
 )
 
 const (
@@ -22,9 +28,18 @@ const (
 	jsonOutputPlain
 	jsonOutputB64
 	jsonOutputGZB64
+	mermaidOutput
+	graphMLOutput
+	csvOutput
+	tsvOutput
+	ndjsonOutput
+	treeOutput
+	htmlOutput
+	cypherOutput
+	plantUMLOutput
 )
 
-const jsonOutputFMT string = "{\"graph\": \"%s\",\"graph_type\":\"%s\",\"symbols\": [%s]}"
+const jsonOutputFMT string = "{\"schema_version\": %d,\"graph\": \"%s\",\"graph_type\":\"%s\",\"symbols\": [%s]}"
 
 var fmtDot = []string{
 	"",
@@ -42,6 +57,14 @@ var fmtDotHeader = []string{
 	"digraph G {\n",
 }
 
+var fmtDotWeighted = []string{
+	"",
+	"\"%s\"->\"%s\" [label=\"%[3]d\" weight=%[3]d]\n",
+	"\\\"%s\\\"->\\\"%s\\\" [label=\\\"%[3]d\\\" weight=%[3]d] \\\\\\n",
+	"\"%s\"->\"%s\" [label=\"%[3]d\" weight=%[3]d]\n",
+	"\"%s\"->\"%s\" [label=\"%[3]d\" weight=%[3]d]\n",
+}
+
 var fmtDotNodeHighlightWSymb = "\"%[1]s\" [shape=record style=\"rounded,filled,bold\" fillcolor=yellow label=\"%[1]s|%[2]s\"]\n"
 var fmtDotNodeHighlightWoSymb = "\"%[1]s\" [shape=record style=\"rounded,filled,bold\" fillcolor=yellow label=\"%[1]s\"]\n"
 
@@ -51,6 +74,15 @@ func opt2num(s string) int {
 		"jsonOutputPlain": 2,
 		"jsonOutputB64":   3,
 		"jsonOutputGZB64": 4,
+		"mermaid":         5,
+		"graphml":         6,
+		"csv":             7,
+		"tsv":             8,
+		"ndjson":          9,
+		"tree":            10,
+		"html":            11,
+		"cypher":          12,
+		"plantuml":        13,
 	}
 	val, ok := opt[s]
 	if !ok {
@@ -59,6 +91,22 @@ func opt2num(s string) int {
 	return val
 }
 
+// Returns the Cypher label of the graph nodes.
+func cypherLabel(mode outMode) string {
+	if mode == printAll {
+		return "Function"
+	}
+	return "Subsystem"
+}
+
+// Returns the DOT flavour used while navigating, non DOT outputs use the plain one.
+func dotFlavour(jout string) int {
+	if n := opt2num(jout); n <= jsonOutputGZB64 {
+		return n
+	}
+	return graphOnly
+}
+
 func decorateLine(l string, r string, adjm []adjM) string {
 	var res = " [label=\""
 
@@ -74,6 +122,26 @@ func decorateLine(l string, r string, adjm []adjM) string {
 	return res
 }
 
+// Collapses the subsystem crossing calls into subsystem to subsystem edges,
+// weighted by the number of underlying calls.
+func aggregate(adjm []adjM, dotFmt string) string {
+	var res string
+	var order [][2]string
+	weights := map[[2]string]int{}
+
+	for _, item := range adjm {
+		k := [2]string{item.l.subsys, item.r.subsys}
+		if _, ok := weights[k]; !ok {
+			order = append(order, k)
+		}
+		weights[k]++
+	}
+	for _, k := range order {
+		res += fmt.Sprintf(dotFmt, k[0], k[1], weights[k])
+	}
+	return res
+}
+
 func decorate(dotStr string, adjm []adjM) string {
 	var res string
 
@@ -87,56 +155,235 @@ func decorate(dotStr string, adjm []adjM) string {
 	return res
 }
 
-func generateOutput(db *sql.DB, conf *configuration) (string, error) {
-	var graphOutput string
-	var jsonOutput string
-	var prod = map[string]int{}
-	var visited []int
-	var entryName string
-	var output string
-	var adjm []adjM
+// Returns the first of the start symbols belonging to the given subsystem.
+func symbolInSubsys(symbols []string, subsys string, subsytemsCache map[string]string) (string, bool) {
+	for _, symbol := range symbols {
+		if subsytemsCache[symbol] == subsys {
+			return symbol, true
+		}
+	}
+	return "", false
+}
+
+func generateOutput(ctx context.Context, db navdb.Conn, conf *configuration) (string, error) {
+	return generateBatchOutput(ctx, db, conf, newCache(), conf.symbolList())
+}
+
+// Outcome of the exploration of a set of start symbols.
+type exploration struct {
+	res      navResult
+	partial  bool
+	symbols  []string
+	starts   []node
+	targets  []string
+	overlay  *runtimeOverlay
+	coverage coverage
+	sources  *sourceTree
+	resume   *resumeToken
+}
+
+// Explores the call trees of all the given symbols.
+// Subtrees shared among the symbols are explored only once.
+// If stream is not nil, edges are passed to it as found instead of being collected.
+// When the context is done, the exploration stops and what gathered so far
+// is returned marked as partial.
+func explore(ctx context.Context, db navdb.Conn, conf *configuration, cache Cache, symbols []string, stream func(node, node, int)) (*exploration, error) {
+	var starts []int
+
+	db = navdb.WithContext(ctx, db)
+	e := exploration{res: newNavResult(), symbols: symbols, sources: newSourceTree(db, conf)}
+	e.targets = append([]string{}, conf.TargetSubsys...)
 
-	cache := make(map[int][]entry)
-	cache2 := make(map[int]entry)
-	cache3 := make(map[string]string)
+	for _, symbol := range symbols {
+		start, err := conf.startId(db, symbol)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := getEntryById(db, start, conf.Instance, cache.entries)
+		if err != nil {
+			return nil, err
+		}
+		startSubsys, _ := getSubsysFromSymbolName(db, entry.symbol, conf.Instance, cache.subSys)
+		if startSubsys == "" {
+			startSubsys = SUBSYS_UNDEF
+		}
+
+		if (conf.Mode == printTargeted) && len(conf.TargetSubsys) == 0 {
+			targSubsysTmp, err := getSubsysFromSymbolName(db, symbol, conf.Instance, cache.subSys)
+			if err != nil {
+				panic(err)
+			}
+			e.targets = append(e.targets, targSubsysTmp)
+		}
+		starts = append(starts, start)
+		e.starts = append(e.starts, node{subsys: startSubsys, symbol: entry.symbol, sourceRef: "entry point", addressRef: "0x0"})
+	}
 
-	start, err := sym2num(db, conf.Symbol, conf.Instance)
+	nc := navConf{
+		ctx:            ctx,
+		db:             db,
+		cache:          cache,
+		targets:        e.targets,
+		excludedAfter:  conf.ExcludedAfter,
+		excludedBefore: conf.ExcludedBefore,
+		includeOnly:    conf.IncludeOnly,
+		dotFmt:         fmtDot[dotFlavour(conf.Jout)],
+		instance:       conf.Instance,
+		maxdepth:       conf.MaxDepth,
+		maxNodes:       conf.MaxNodes,
+		maxEdges:       conf.MaxEdges,
+		strategy:       conf.Strategy,
+		mode:           conf.Mode,
+		stream:         stream,
+		reportCycles:   conf.ReportCycles,
+		followIndirect: conf.FollowIndirect,
+		dotFmtIndirect: fmtDotIndirect[dotFlavour(conf.Jout)],
+	}
+	if conf.resume != nil {
+		nc.explored = conf.resume.explored()
+		e.res = nc.newResult()
+	}
+	if conf.FollowIndirect {
+		if err := checkIndirect(db, conf.Instance); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Overlay != "" {
+		o, err := loadOverlay(conf.Overlay)
+		if err != nil {
+			return nil, err
+		}
+		e.overlay = o
+		nc.overlay = o
+		nc.dotFmtHot = fmtDotHot[dotFlavour(conf.Jout)]
+	}
+	if conf.Coverage != "" {
+		c, err := loadCoverage(conf.Coverage)
+		if err != nil {
+			return nil, err
+		}
+		e.coverage = c
+	}
+	out, err := compiledOut(db, conf, conf.Instance)
 	if err != nil {
-		fmt.Println("Symbol not found")
-		return "", err
+		return nil, err
+	}
+	nc.compiledOut = out
+	if nc.module, err = moduleFilter(db, conf, conf.Instance); err != nil {
+		return nil, err
+	}
+	if nc.visibility, err = visibilityAllowed(db, conf, conf.Instance); err != nil {
+		return nil, err
+	}
+	if !conf.Quiet {
+		nc.progress = newProgress()
+		defer nc.progress.done()
+	}
+	if conf.RecursiveQuery {
+		if err := prefetchRecursive(&nc, starts); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Parallel > 1 {
+		prefetch(&nc, starts, conf.Parallel)
+	}
+	walk(&nc, &e.res, starts, e.starts)
+	if ctx.Err() != nil {
+		e.partial = true
+		setTruncated(conf, fmt.Sprint("Exploration interrupted, the output is partial: ", ctx.Err()))
 	}
+	if len(e.res.truncated) > 0 {
+		setTruncated(conf, fmt.Sprint("Exploration budget reached, the output is truncated at ", len(e.res.truncated), " functions"))
+	}
+	if conf.Resumable && !e.partial {
+		if e.resume, err = newResumeToken(&nc, &e.res); err != nil {
+			return nil, err
+		}
+	}
+	return &e, nil
+}
+
+// Generates a single report covering the call trees of all the given symbols.
+func generateBatchOutput(ctx context.Context, db navdb.Conn, conf *configuration, cache Cache, symbols []string) (string, error) {
+	var out string
 
-	graphOutput = fmtDotHeader[opt2num(conf.Jout)]
-	entry, err := getEntryById(db, start, conf.Instance, cache2)
+	e, err := explore(ctx, db, conf, cache, symbols, nil)
 	if err != nil {
 		return "", err
-	} else {
-		entryName = entry.symbol
-	}
-	startSubsys, _ := getSubsysFromSymbolName(db, entryName, conf.Instance, cache3)
-	if startSubsys == "" {
-		startSubsys = SUBSYS_UNDEF
 	}
 
-	if (conf.Mode == printTargeted) && len(conf.TargetSubsys) == 0 {
-		targSubsysTmp, err := getSubsysFromSymbolName(db, conf.Symbol, conf.Instance, cache3)
-		if err != nil {
-			panic(err)
-		}
-		conf.TargetSubsys = append(conf.TargetSubsys, targSubsysTmp)
+	switch {
+	case conf.Template != "":
+		out, err = templateOutput(conf.Template, e, conf.Mode)
+	case opt2num(conf.Jout) == mermaidOutput:
+		out = mermaid(e, conf.Mode)
+	case opt2num(conf.Jout) == graphMLOutput:
+		out = output.GraphML(newOutGraph(e, conf.Mode))
+	case opt2num(conf.Jout) == csvOutput:
+		out, err = output.EdgeList(newOutGraph(e, conf.Mode), ',')
+	case opt2num(conf.Jout) == tsvOutput:
+		out, err = output.EdgeList(newOutGraph(e, conf.Mode), '\t')
+	case opt2num(conf.Jout) == treeOutput:
+		out = output.Tree(newOutGraph(e, conf.Mode), len(e.starts), conf.Dedup)
+	case opt2num(conf.Jout) == htmlOutput:
+		out, err = output.HTML(newOutGraph(e, conf.Mode), len(e.starts))
+	case opt2num(conf.Jout) == cypherOutput:
+		out = output.Cypher(newOutGraph(e, conf.Mode), cypherLabel(conf.Mode), conf.Instance)
+	case opt2num(conf.Jout) == plantUMLOutput:
+		out = output.PlantUML(newOutGraph(e, conf.Mode), len(e.starts), conf.Diagram)
+	default:
+		out, err = dotOutput(db, conf, cache, e)
+	}
+	if conf.Template != "" {
+		return out, err
 	}
+	if err == nil && conf.budget() {
+		out, err = appendTruncated(out, e.res.truncated, conf.Jout, os.Stderr)
+	}
+	if err == nil && conf.ReportCycles {
+		out, err = appendCycles(out, e.res.cycles, conf.Jout, os.Stderr)
+	}
+	if err == nil && e.coverage != nil {
+		out, err = appendUncovered(out, e, conf.Jout, os.Stderr)
+	}
+	if err == nil && e.resume != nil {
+		out, err = appendResume(out, e.resume, conf.Jout, os.Stderr)
+	}
+	return out, err
+}
 
-	navigate(db, start, node{startSubsys, entryName, "entry point", "0x0"}, conf.TargetSubsys, &visited, &adjm, prod, conf.Instance, Cache{cache, cache2, cache3}, conf.Mode, conf.ExcludedAfter, conf.ExcludedBefore, 0, conf.MaxDepth, fmtDot[opt2num(conf.Jout)], &output)
+// Renders the exploration as DOT graph, optionally wrapped in JSON.
+func dotOutput(db navdb.Conn, conf *configuration, cache Cache, e *exploration) (string, error) {
+	var jsonOutput string
 
+	res := e.res
+	graphOutput := fmtDotHeader[opt2num(conf.Jout)]
+	output := res.output
 	if (conf.Mode == printSubsysWs) || (conf.Mode == printTargeted) {
-		output = decorate(output, adjm)
+		output = decorate(output, res.adjm)
+	}
+	if conf.Mode == printSubsysAggr {
+		output = aggregate(res.adjm, fmtDotWeighted[opt2num(conf.Jout)])
 	}
 
 	graphOutput += output
+	if e.overlay != nil && conf.Mode == printAll {
+		graphOutput += e.overlay.dotNodes(e.functions(), opt2num(conf.Jout))
+	}
+	if e.coverage != nil && conf.Mode == printAll {
+		graphOutput += e.coverage.dotNodes(e.functions(), opt2num(conf.Jout))
+	}
+	if e.sources != nil && conf.Mode == printAll {
+		graphOutput += e.sources.dotNodes(e.functions(), opt2num(conf.Jout))
+	}
+	if conf.Mode == printAll {
+		graphOutput += truncatedDotNodes(res.truncated, opt2num(conf.Jout))
+	}
 	if conf.Mode == printTargeted {
-		for _, i := range conf.TargetSubsys {
-			if cache3[conf.Symbol] == i {
-				graphOutput += fmt.Sprintf(fmtDotNodeHighlightWSymb, i, conf.Symbol)
+		for _, i := range e.targets {
+			if highlightSymbol, ok := symbolInSubsys(e.symbols, i, cache.subSys); ok {
+				graphOutput += fmt.Sprintf(fmtDotNodeHighlightWSymb, i, highlightSymbol)
 			} else {
 				graphOutput += fmt.Sprintf(fmtDotNodeHighlightWoSymb, i)
 			}
@@ -144,7 +391,7 @@ func generateOutput(db *sql.DB, conf *configuration) (string, error) {
 	}
 	graphOutput += "}"
 
-	symbdata, err := symbSubsys(db, visited, conf.Instance, Cache{cache, cache2, cache3})
+	symbdata, err := symbSubsys(db, res.visited, conf.Instance, cache)
 	if err != nil {
 		return "", err
 	}
@@ -153,10 +400,10 @@ func generateOutput(db *sql.DB, conf *configuration) (string, error) {
 	case graphOnly:
 		jsonOutput = graphOutput
 	case jsonOutputPlain:
-		jsonOutput = fmt.Sprintf(jsonOutputFMT, graphOutput, conf.Jout, symbdata)
+		jsonOutput = fmt.Sprintf(jsonOutputFMT, schemaVersion, graphOutput, conf.Jout, symbdata)
 	case jsonOutputB64:
 		b64dot := base64.StdEncoding.EncodeToString([]byte(graphOutput))
-		jsonOutput = fmt.Sprintf(jsonOutputFMT, b64dot, conf.Jout, symbdata)
+		jsonOutput = fmt.Sprintf(jsonOutputFMT, schemaVersion, b64dot, conf.Jout, symbdata)
 
 	case jsonOutputGZB64:
 		var b bytes.Buffer
@@ -168,7 +415,7 @@ func generateOutput(db *sql.DB, conf *configuration) (string, error) {
 			return "", errors.New("gzip failed")
 		}
 		b64dot := base64.StdEncoding.EncodeToString(b.Bytes())
-		jsonOutput = fmt.Sprintf(jsonOutputFMT, b64dot, conf.Jout, symbdata)
+		jsonOutput = fmt.Sprintf(jsonOutputFMT, schemaVersion, b64dot, conf.Jout, symbdata)
 
 	default:
 		return "", errors.New("unknown output mode")
@@ -176,28 +423,237 @@ func generateOutput(db *sql.DB, conf *configuration) (string, error) {
 	return jsonOutput, nil
 }
 
+// Renders the call graph in the configured image file.
+func generateImage(ctx context.Context, db navdb.Conn, conf *configuration) error {
+	e, err := explore(ctx, db, conf, newCache(), conf.symbolList(), nil)
+	if err != nil {
+		return err
+	}
+	img, err := render(e, conf)
+	if err != nil {
+		return err
+	}
+	if conf.ReportCycles {
+		printCycles(os.Stderr, e.res.cycles)
+	}
+	if e.resume != nil {
+		fmt.Fprintln(os.Stderr, strings.Join(resumeLines(e.resume), "\n"))
+	}
+	return output.Write(conf.OutFile, conf.Compress, img)
+}
+
+// Writes a separate report for every requested symbol in the split directory.
+// Caches are shared, so the database is queried only once for common subtrees.
+func generateSplitOutput(ctx context.Context, db navdb.Conn, conf *configuration) error {
+	ext := ".json"
+	if opt2num(conf.Jout) == graphOnly {
+		ext = ".dot"
+	}
+	if conf.Compress {
+		ext += ".gz"
+	}
+
+	cache := newCache()
+	for _, symbol := range conf.symbolList() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		out, err := generateBatchOutput(ctx, db, conf, cache, []string{symbol})
+		if err != nil {
+			return err
+		}
+		err = output.Write(filepath.Join(conf.SplitDir, symbol+ext), conf.Compress, []byte(out+"\n"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Connects the database described by the configuration, and checks it is
+// reachable within the context. Queries are prepared, and retried if failing
+// for transient errors.
+func connectConf(ctx context.Context, conf *configuration) (navdb.Conn, error) {
+	t := navdb.Token{
+		Host:     conf.DBUrl,
+		Port:     conf.DBPort,
+		User:     conf.DBUser,
+		Pass:     conf.DBPassword,
+		DBName:   conf.DBTargetDB,
+		Backend:  conf.DBDriver,
+		SSL:      navdb.SSLOptions{Mode: conf.DBSSLMode, RootCert: conf.DBSSLRootCert, Cert: conf.DBSSLCert, Key: conf.DBSSLKey},
+		PoolSize: conf.DBPoolSize,
+	}
+	if conf.DBQueryTimeout != "" {
+		t.StatementTimeout, _ = time.ParseDuration(conf.DBQueryTimeout)
+	}
+	if conf.DBDriver == navdb.Sqlite {
+		t.DBName = conf.DBFile
+	}
+	db, err := navdb.Connect(&t)
+	if err != nil {
+		return nil, exitError{exitDBUnreachable, err}
+	}
+	db = navdb.Prepare(db)
+	delay, _ := time.ParseDuration(conf.DBRetryDelay)
+	rdb := navdb.RetryConn{Conn: logConn{db}, Retries: conf.DBRetries, Delay: delay}
+	if err := rdb.HealthCheck(ctx, &t); err != nil {
+		db.Close()
+		return nil, exitError{exitDBUnreachable, err}
+	}
+	return rdb, nil
+}
+
+// Returns the context bounding the run: it is cancelled by the configured
+// timeout or by the first interrupt signal. Further signals terminate the
+// process as usual.
+func runContext(conf *configuration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if conf.Timeout == "" {
+		return ctx, stop
+	}
+	timeout, _ := time.ParseDuration(conf.Timeout)
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	return tctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// Executes the selected subcommand and prints its output.
+func runSubCmd(conf *configuration) {
+	var db navdb.Conn
+	var err error
+
+	c, _ := findSubCmd(conf.command)
+	if c.needsDB {
+		ctx, cancel := runContext(conf)
+		defer cancel()
+		db, err = connectConf(ctx, conf)
+		if err != nil {
+			fail(conf, "Can't connect to the database", err)
+		}
+		defer db.Close()
+		db = navdb.WithContext(ctx, db)
+		if err = resolveAddr(db, conf); err != nil {
+			fail(conf, "Can't resolve the address", err)
+		}
+	}
+	out, err := c.function(db, conf)
+	if err != nil {
+		fail(conf, "Internal error", err)
+	}
+	if err = output.Write(conf.OutFile, conf.Compress, []byte(out+"\n")); err != nil {
+		fail(conf, "Can't write the output", err)
+	}
+	exitIfViolated(conf)
+	exitIfTruncated(conf)
+}
+
 func main() {
 
 	conf, err := argsParse(cmdLineItemInit())
 	if err != nil {
-		if err.Error() != "dummy" {
-			fmt.Println(err.Error())
+		args, _ := splitLongArgs(os.Args[1:])
+		conf.Errors = errorsFormat(args)
+		if conf.Errors != errorsJSON {
+			if err.Error() != "dummy" {
+				fmt.Println(err.Error())
+			}
+			printHelp(cmdLineItemInit())
+			os.Exit(exitBadArgs)
 		}
-		printHelp(cmdLineItemInit())
-		os.Exit(-1)
+		fail(&conf, "", exitError{exitBadArgs, err})
 	}
-	if opt2num(conf.Jout) == 0 {
-		fmt.Printf("Unknown mode %s\n", conf.Jout)
-		os.Exit(-2)
+	closeLog, err := setupLogger(&conf)
+	if err != nil {
+		fail(&conf, "Can't open the log file", exitError{exitBadArgs, err})
 	}
-	t := connectToken{conf.DBUrl, conf.DBPort, conf.DBUser, conf.DBPassword, conf.DBTargetDB}
-	db := connectDb(&t)
+	defer closeLog()
 
-	output, err := generateOutput(db, &conf)
+	if conf.command != "" {
+		runSubCmd(&conf)
+		return
+	}
+
+	ctx, cancel := runContext(&conf)
+	defer cancel()
+	db, err := connectConf(ctx, &conf)
 	if err != nil {
-		fmt.Println("Internal error", err)
-		os.Exit(-3)
+		fail(&conf, "Can't connect to the database", err)
+	}
+	defer db.Close()
+
+	if err = resolveAddr(db, &conf); err != nil {
+		fail(&conf, "Can't resolve the address", err)
+	}
+
+	if conf.Match != matchExact {
+		matches, err := matchSymbols(db, &conf)
+		if err != nil {
+			fail(&conf, "Internal error", err)
+		}
+		if !conf.ExploreMatches {
+			out, err := matchListing(&conf, matches)
+			if err != nil {
+				fail(&conf, "Internal error", err)
+			}
+			if err = output.Write(conf.OutFile, conf.Compress, []byte(out)); err != nil {
+				fail(&conf, "Can't write the output", err)
+			}
+			return
+		}
+		if len(matches) == 0 {
+			fail(&conf, "", exitError{exitSymbolNotFound, fmt.Errorf("no symbol matches %s", strings.Join(conf.cliSymbols, ","))})
+		}
+		conf.cliSymbols = matches
 	}
-	fmt.Println(output)
 
+	if opt2num(conf.Jout) == ndjsonOutput && conf.Template == "" {
+		out, err := output.Open(conf.OutFile, conf.Compress)
+		if err != nil {
+			fail(&conf, "Can't write the output", err)
+		}
+		err = streamOutput(ctx, db, &conf, out)
+		if err != nil {
+			out.Abort()
+			fail(&conf, "Internal error", err)
+		}
+		if err = out.Close(); err != nil {
+			fail(&conf, "Can't write the output", err)
+		}
+		exitIfTruncated(&conf)
+		return
+	}
+
+	if isRenderTarget(conf.OutFile) {
+		err = generateImage(ctx, db, &conf)
+		if err != nil {
+			fail(&conf, "Internal error", err)
+		}
+		exitIfTruncated(&conf)
+		return
+	}
+
+	if conf.SplitDir != "" {
+		err = generateSplitOutput(ctx, db, &conf)
+		if err != nil {
+			fail(&conf, "Internal error", err)
+		}
+		exitIfTruncated(&conf)
+		return
+	}
+
+	out, err := cachedOutput(ctx, db, &conf, func() (string, error) { return generateOutput(ctx, db, &conf) })
+	if err != nil {
+		fail(&conf, "Internal error", err)
+	}
+	if err = output.Write(conf.OutFile, conf.Compress, []byte(out+"\n")); err != nil {
+		fail(&conf, "Can't write the output", err)
+	}
+	exitIfTruncated(&conf)
 }
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Streamed node record.
+type ndjsonNode struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Subsystem string `json:"subsystem"`
+}
+
+// Streamed edge record, depth is 1 for the calls made by the start symbols.
+// Kind is direct or indirect, confidence is 1 for the direct calls.
+type ndjsonEdge struct {
+	Type            string  `json:"type"`
+	Caller          string  `json:"caller"`
+	Callee          string  `json:"callee"`
+	CallerSubsystem string  `json:"caller_subsystem"`
+	CalleeSubsystem string  `json:"callee_subsystem"`
+	SourceRef       string  `json:"source_ref"`
+	AddressRef      string  `json:"address_ref"`
+	Depth           int     `json:"depth"`
+	Kind            string  `json:"kind"`
+	Confidence      float64 `json:"confidence"`
+}
+
+// Streamed cycle record, the path starts and ends with the same symbol.
+type ndjsonCycle struct {
+	Type string   `json:"type"`
+	Path []string `json:"path"`
+}
+
+// Streamed record of a function whose calls were cut by the budget.
+type ndjsonTruncated struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// Streamed record of a function the test suite never called.
+type ndjsonUncovered struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// Explores the call graph writing one JSON object per line for every node and
+// edge as soon as they are found. The edges and the rendered graph are not
+// kept, but memory still grows with the explored graph: the visited set and
+// the caches of the successors and symbol entries hold all of it.
+func streamOutput(ctx context.Context, db navdb.Conn, conf *configuration, w io.Writer) error {
+	var werr error
+	enc := json.NewEncoder(w)
+	seen := map[string]bool{}
+
+	emitNode := func(n node) {
+		if !seen[n.symbol] && werr == nil {
+			seen[n.symbol] = true
+			werr = enc.Encode(ndjsonNode{"node", n.symbol, n.subsys})
+		}
+	}
+	if err := enc.Encode(ndjsonHeader{"header", schemaVersion}); err != nil {
+		return err
+	}
+	stream := func(l node, r node, depth int) {
+		emitNode(l)
+		emitNode(r)
+		if werr == nil {
+			werr = enc.Encode(ndjsonEdge{"edge", l.symbol, r.symbol, l.subsys, r.subsys, r.sourceRef, r.addressRef, depth, edgeKind(r), edgeConfidence(r)})
+		}
+	}
+
+	e, err := explore(ctx, db, conf, newCache(), conf.symbolList(), stream)
+	if err != nil {
+		return err
+	}
+	for _, n := range e.starts {
+		emitNode(n)
+	}
+	if werr == nil {
+		werr = streamTruncated(enc, e.res.truncated)
+	}
+	if werr == nil && conf.ReportCycles {
+		werr = streamCycles(enc, e.res.cycles)
+	}
+	if werr == nil && e.coverage != nil {
+		var names []string
+		for name := range seen {
+			names = append(names, name)
+		}
+		werr = streamUncovered(enc, e.coverage, names)
+	}
+	if werr == nil && e.resume != nil {
+		werr = streamResume(enc, e.resume)
+	}
+	return werr
+}
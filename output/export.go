@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+// Package output formats the call graphs and writes the results.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Renders the graph as GraphML document, suitable for Gephi or yEd. The
+// nodes source is given only when known.
+func GraphML(g *graph.Graph) string {
+	var b strings.Builder
+
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	b.WriteString("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	b.WriteString("  <key id=\"name\" for=\"node\" attr.name=\"name\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"subsystem\" for=\"node\" attr.name=\"subsystem\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"depth\" for=\"node\" attr.name=\"depth\" attr.type=\"int\"/>\n")
+	b.WriteString("  <key id=\"source\" for=\"node\" attr.name=\"source\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"source_ref\" for=\"edge\" attr.name=\"source_ref\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"address_ref\" for=\"edge\" attr.name=\"address_ref\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"kind\" for=\"edge\" attr.name=\"kind\" attr.type=\"string\"/>\n")
+	b.WriteString("  <key id=\"confidence\" for=\"edge\" attr.name=\"confidence\" attr.type=\"double\"/>\n")
+	b.WriteString("  <graph id=\"G\" edgedefault=\"directed\">\n")
+	for i, n := range g.Nodes {
+		var source string
+		if n.Source != "" {
+			source = "<data key=\"source\">" + html.EscapeString(n.Source) + "</data>"
+		}
+		fmt.Fprintf(&b, "    <node id=\"n%d\"><data key=\"name\">%s</data><data key=\"subsystem\">%s</data><data key=\"depth\">%d</data>%s</node>\n",
+			i, html.EscapeString(n.Name), html.EscapeString(n.Subsys), n.Depth, source)
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=\"n%d\" target=\"n%d\"><data key=\"source_ref\">%s</data><data key=\"address_ref\">%s</data>"+
+			"<data key=\"kind\">%s</data><data key=\"confidence\">%g</data></edge>\n",
+			i, e.From, e.To, html.EscapeString(e.SourceRef), html.EscapeString(e.AddressRef), e.Kind(), e.Confidence)
+	}
+	b.WriteString("  </graph>\n</graphml>")
+	return b.String()
+}
+
+// Columns of the edge lists, their header.
+var EdgeListHeader = []string{"caller", "callee", "caller_subsystem", "callee_subsystem", "depth"}
+
+// Renders the graph as an edge list with header, using the given separator.
+// Edges depth is 1 for the calls made by the start symbols.
+func EdgeList(g *graph.Graph, sep rune) (string, error) {
+	var b bytes.Buffer
+
+	w := csv.NewWriter(&b)
+	w.Comma = sep
+	records := [][]string{EdgeListHeader}
+	for _, e := range g.Edges {
+		from, to := g.Nodes[e.From], g.Nodes[e.To]
+		records = append(records, []string{from.Name, to.Name, from.Subsys, to.Subsys, strconv.Itoa(from.Depth + 1)})
+	}
+	if err := w.WriteAll(records); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// Quotes a Cypher string literal.
+func cypherString(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(s) + "\""
+}
+
+// Renders the graph as Cypher statements loading it into a graph database as
+// Neo4j, one per line to be fed to cypher-shell. Nodes get the label and the
+// instance as property, so that several graphs can be loaded side by side,
+// and the source when known, and are connected by CALLS relationships. Both
+// are merged, so loading overlapping explorations adds only what is new: a
+// node keeps the depth of the first exploration reaching it.
+func Cypher(g *graph.Graph, label string, instance int) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "CREATE INDEX IF NOT EXISTS FOR (n:%s) ON (n.name, n.instance);\n", label)
+	for _, n := range g.Nodes {
+		var source string
+		if n.Source != "" {
+			source = ", n.source = " + cypherString(n.Source)
+		}
+		fmt.Fprintf(&b, "MERGE (n:%s {name: %s, instance: %d}) ON CREATE SET n.depth = %d SET n.subsystem = %s%s;\n",
+			label, cypherString(n.Name), instance, n.Depth, cypherString(n.Subsys), source)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "MATCH (a:%[1]s {name: %[2]s, instance: %[4]d}), (b:%[1]s {name: %[3]s, instance: %[4]d}) "+
+			"MERGE (a)-[r:CALLS]->(b) SET r.kind = %[5]s, r.confidence = %[6]g, r.source_ref = %[7]s, r.address_ref = %[8]s;\n",
+			label, cypherString(g.Nodes[e.From].Name), cypherString(g.Nodes[e.To].Name), instance,
+			cypherString(e.Kind()), e.Confidence, cypherString(e.SourceRef), cypherString(e.AddressRef))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Self contained page with the viewer, the graph replaces the placeholder.
+//
+//go:embed viewer.html
+var htmlViewer string
+
+const htmlPlaceholder = "/*GRAPH*/null"
+
+// Graph as embedded in the HTML page.
+type htmlGraph struct {
+	Starts int        `json:"starts"`
+	Nodes  []htmlNode `json:"nodes"`
+	Edges  []htmlEdge `json:"edges"`
+}
+
+type htmlNode struct {
+	Name   string `json:"name"`
+	Subsys string `json:"subsys"`
+	Depth  int    `json:"depth"`
+	Source string `json:"source,omitempty"`
+}
+
+type htmlEdge struct {
+	From     int  `json:"from"`
+	To       int  `json:"to"`
+	Indirect bool `json:"indirect"`
+}
+
+// Renders the graph as a self contained HTML page, with a viewer supporting
+// zoom, subtrees collapse, node search and subsystem filtering; the sources
+// with a web URL open on double click. The first starts nodes are the start
+// ones.
+func HTML(g *graph.Graph, starts int) (string, error) {
+	h := htmlGraph{Starts: starts, Nodes: []htmlNode{}, Edges: []htmlEdge{}}
+	for _, n := range g.Nodes {
+		h.Nodes = append(h.Nodes, htmlNode{n.Name, n.Subsys, n.Depth, n.Source})
+	}
+	for _, e := range g.Edges {
+		h.Edges = append(h.Edges, htmlEdge{e.From, e.To, e.Indirect})
+	}
+	// json escapes <, > and &, the data can not terminate the script.
+	b, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(htmlViewer, htmlPlaceholder, string(b), 1), nil
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Tests the graph is embedded in the page, escaped.
+func TestHTML(t *testing.T) {
+	g := graph.New()
+	from, to := g.AddNode("start", "CORE"), g.AddNode("</script>", "MM")
+	g.Edges = append(g.Edges, graph.Edge{From: from, To: to, Indirect: true})
+	g.ComputeDepth(1)
+
+	out, err := HTML(g, 1)
+	if err != nil {
+		t.Fatal("Unexpected error rendering HTML", err)
+	}
+	expected := `var graph = {"starts":1,"nodes":[{"name":"start","subsys":"CORE","depth":0},{"name":"\u003c/script\u003e","subsys":"MM","depth":1}],` +
+		`"edges":[{"from":0,"to":1,"indirect":true}]};`
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") || !strings.Contains(out, expected) || strings.Count(out, "</script>") != 1 {
+		t.Error("Unexpected HTML output", out)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Destination of the results: stdout or a file, optionally gzip compressed.
+// Files are written in a temporary file renamed over the target on Close,
+// so readers never see a truncated result.
+type Sink struct {
+	f    *os.File
+	path string
+	gz   *gzip.Writer
+	w    io.Writer
+}
+
+// Opens the output, stdout if path is empty.
+func Open(path string, compress bool) (*Sink, error) {
+	o := Sink{path: path, w: os.Stdout}
+
+	if path != "" {
+		f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+		if err != nil {
+			return nil, err
+		}
+		o.f = f
+		o.w = f
+	}
+	if compress {
+		o.gz = gzip.NewWriter(o.w)
+		o.w = o.gz
+	}
+	return &o, nil
+}
+
+func (o *Sink) Write(p []byte) (int, error) {
+	return o.w.Write(p)
+}
+
+// Completes the output, moving the file in place.
+func (o *Sink) Close() error {
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			o.Abort()
+			return err
+		}
+	}
+	if o.f == nil {
+		return nil
+	}
+	if err := o.f.Chmod(0644); err != nil {
+		o.Abort()
+		return err
+	}
+	if err := o.f.Close(); err != nil {
+		os.Remove(o.f.Name())
+		return err
+	}
+	if err := os.Rename(o.f.Name(), o.path); err != nil {
+		os.Remove(o.f.Name())
+		return err
+	}
+	return nil
+}
+
+// Drops the output, leaving any existing file untouched.
+func (o *Sink) Abort() {
+	if o.f != nil {
+		o.f.Close()
+		os.Remove(o.f.Name())
+	}
+}
+
+// Writes data to the output in a single shot.
+func Write(path string, compress bool, data []byte) error {
+	o, err := Open(path, compress)
+	if err != nil {
+		return err
+	}
+	if _, err = o.Write(data); err != nil {
+		o.Abort()
+		return err
+	}
+	return o.Close()
+}
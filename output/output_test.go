@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests the output file is replaced atomically, compressed when asked to.
+func TestOutputFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "out.json")
+
+	if err := os.WriteFile(fn, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o, err := Open(fn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Write([]byte("new"))
+	o.Abort()
+	if b, _ := os.ReadFile(fn); string(b) != "old" {
+		t.Error("Aborted output replaced the file", string(b))
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(fn)); len(entries) != 1 {
+		t.Error("Temporary file left behind", entries)
+	}
+
+	if err := Write(fn, true, []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal("Output not compressed", err)
+	}
+	if b, err := io.ReadAll(r); err != nil || string(b) != "new\n" {
+		t.Error("Unexpected output file content", string(b), err)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// PlantUML diagrams the graphs are rendered as.
+const (
+	SequenceDiagram = "sequence"
+	ActivityDiagram = "activity"
+)
+
+// Escapes a name for use within a quoted PlantUML string, which has no
+// escape for the double quotes.
+func plantUMLString(s string) string {
+	return strings.ReplaceAll(s, "\"", "'")
+}
+
+// Returns the subsystems grouping the nodes in order of appearance, none if
+// the nodes are subsystems themselves.
+func groups(g *graph.Graph) []string {
+	var res []string
+
+	for _, n := range g.Nodes {
+		if n.Name != n.Subsys {
+			for _, n := range g.Nodes {
+				if notIn(res, n.Subsys) {
+					res = append(res, n.Subsys)
+				}
+			}
+			break
+		}
+	}
+	return res
+}
+
+// Returns the swimlane of a subsystem, which can't hold bars.
+func swimlane(subsys string) string {
+	return "|" + strings.ReplaceAll(subsys, "|", "/") + "|"
+}
+
+// Renders the graph as a PlantUML sequence or activity diagram of the calls
+// made from the first starts nodes, as the kind of diagram design documents
+// use. Calls are walked depth first and every function is expanded once.
+func PlantUML(g *graph.Graph, starts int, diagram string) string {
+	if diagram == ActivityDiagram {
+		return activity(g, starts)
+	}
+	return sequence(g, starts)
+}
+
+// Renders the calls as messages between the functions, boxed by subsystem.
+// A called function is active while its own calls are shown, a call to a
+// function already expanded is a message alone. Indirect calls are dashed.
+func sequence(g *graph.Graph, starts int) string {
+	var b strings.Builder
+	var visit func(n int)
+
+	succ := g.Successors()
+	indirect := map[[2]int]bool{}
+	for _, e := range g.Edges {
+		indirect[[2]int{e.From, e.To}] = e.Indirect
+	}
+
+	b.WriteString("@startuml\n")
+	boxes := groups(g)
+	participant := func(i int, indent string) {
+		fmt.Fprintf(&b, "%sparticipant \"%s\" as n%d", indent, plantUMLString(g.Nodes[i].Name), i)
+		if g.Nodes[i].Source != "" {
+			fmt.Fprintf(&b, " [[%s]]", g.Nodes[i].Source)
+		}
+		b.WriteString("\n")
+	}
+	for _, box := range boxes {
+		fmt.Fprintf(&b, "box \"%s\"\n", plantUMLString(box))
+		for i, n := range g.Nodes {
+			if n.Subsys == box {
+				participant(i, "    ")
+			}
+		}
+		b.WriteString("end box\n")
+	}
+	if len(boxes) == 0 {
+		for i := range g.Nodes {
+			participant(i, "")
+		}
+	}
+
+	expanded := map[int]bool{}
+	visit = func(n int) {
+		expanded[n] = true
+		fmt.Fprintf(&b, "activate n%d\n", n)
+		for _, s := range succ[n] {
+			arrow := "->"
+			if indirect[[2]int{n, s}] {
+				arrow = "-->"
+			}
+			fmt.Fprintf(&b, "n%d %s n%d\n", n, arrow, s)
+			if !expanded[s] {
+				visit(s)
+			}
+		}
+		fmt.Fprintf(&b, "deactivate n%d\n", n)
+	}
+	for i := 0; i < starts && i < len(g.Nodes); i++ {
+		if !expanded[i] {
+			visit(i)
+		}
+	}
+	b.WriteString("@enduml")
+	return b.String()
+}
+
+// Renders the calls as a flow of activities, one per function, in one
+// swimlane per subsystem. The calls of a function with several callees are
+// split in parallel branches; functions already expanded are marked and not
+// expanded again, as the calls back to the functions on the current path.
+func activity(g *graph.Graph, starts int) string {
+	var b strings.Builder
+	var visit func(n int, indent string)
+	var lane string
+
+	succ := g.Successors()
+	expanded := map[int]bool{}
+	onPath := map[int]bool{}
+	lanes := len(groups(g)) > 0
+
+	node := func(n int, indent string, note string) {
+		if lanes && g.Nodes[n].Subsys != lane {
+			lane = g.Nodes[n].Subsys
+			fmt.Fprintf(&b, "%s%s\n", indent, swimlane(lane))
+		}
+		fmt.Fprintf(&b, "%s:%s%s;\n", indent, g.Nodes[n].Name, note)
+	}
+	split := func(nodes []int, indent string) {
+		if len(nodes) == 1 {
+			visit(nodes[0], indent)
+			return
+		}
+		for i, n := range nodes {
+			if i == 0 {
+				fmt.Fprintf(&b, "%ssplit\n", indent)
+			} else {
+				fmt.Fprintf(&b, "%ssplit again\n", indent)
+			}
+			visit(n, indent+"    ")
+		}
+		fmt.Fprintf(&b, "%send split\n", indent)
+	}
+	visit = func(n int, indent string) {
+		switch {
+		case onPath[n]:
+			node(n, indent, " (recursive)")
+			return
+		case expanded[n]:
+			node(n, indent, " (expanded above)")
+			return
+		}
+		expanded[n] = true
+		onPath[n] = true
+		node(n, indent, "")
+		if len(succ[n]) > 0 {
+			split(succ[n], indent)
+		}
+		onPath[n] = false
+	}
+
+	b.WriteString("@startuml\n")
+	var roots []int
+	for i := 0; i < starts && i < len(g.Nodes); i++ {
+		roots = append(roots, i)
+	}
+	if len(roots) > 0 && lanes {
+		lane = g.Nodes[0].Subsys
+		fmt.Fprintln(&b, swimlane(lane))
+	}
+	b.WriteString("start\n")
+	if len(roots) > 0 {
+		split(roots, "")
+	}
+	b.WriteString("stop\n@enduml")
+	return b.String()
+}
+
+// Returns true if a string is not in the list.
+func notIn(list []string, v string) bool {
+	for _, a := range list {
+		if a == v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	"testing"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Tests the sequence and activity diagrams, recursive and shared calls
+// expanded once.
+func TestPlantUML(t *testing.T) {
+	g := graph.New()
+	for _, c := range [][3]string{{"start", "a", "MM"}, {"start", "b", "CORE"}, {"a", "c", "MM"}, {"b", "c", "MM"}, {"c", "c", "MM"}} {
+		from, to := g.AddNode(c[0], "CORE"), g.AddNode(c[1], c[2])
+		g.Edges = append(g.Edges, graph.Edge{From: from, To: to, Indirect: c[0] == "b"})
+	}
+
+	sequence := `@startuml
+box "CORE"
+    participant "start" as n0
+    participant "b" as n2
+end box
+box "MM"
+    participant "a" as n1
+    participant "c" as n3
+end box
+activate n0
+n0 -> n1
+activate n1
+n1 -> n3
+activate n3
+n3 -> n3
+deactivate n3
+deactivate n1
+n0 -> n2
+activate n2
+n2 --> n3
+deactivate n2
+deactivate n0
+@enduml`
+	if out := PlantUML(g, 1, SequenceDiagram); out != sequence {
+		t.Error("Unexpected sequence diagram", out)
+	}
+
+	activity := `@startuml
+|CORE|
+start
+:start;
+split
+    |MM|
+    :a;
+    :c;
+    :c (recursive);
+split again
+    |CORE|
+    :b;
+    |MM|
+    :c (expanded above);
+end split
+stop
+@enduml`
+	if out := PlantUML(g, 1, ActivityDiagram); out != activity {
+		t.Error("Unexpected activity diagram", out)
+	}
+}
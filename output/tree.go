@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Renders the graph as an indented call tree from each of the first starts
+// nodes, with their subsystem and source if known. A call back to a function
+// on the current path is marked recursive and not expanded. Shared subtrees
+// are expanded at every occurrence unless dedup is set: then nodes are
+// numbered and a subtree is expanded once, its later occurrences referring to
+// the first one.
+func Tree(g *graph.Graph, starts int, dedup bool) string {
+	var b strings.Builder
+	var visit func(n int, prefix string, last bool, root bool)
+
+	succ := g.Successors()
+	number := map[int]int{}
+	onPath := map[int]bool{}
+
+	visit = func(n int, prefix string, last bool, root bool) {
+		branch, indent := "├── ", "│   "
+		if last {
+			branch, indent = "└── ", "    "
+		}
+		if root {
+			branch, indent = "", ""
+		}
+		label := fmt.Sprintf("%s [%s]", g.Nodes[n].Name, g.Nodes[n].Subsys)
+		if g.Nodes[n].Source != "" {
+			label += " " + g.Nodes[n].Source
+		}
+		switch {
+		case onPath[n]:
+			fmt.Fprintf(&b, "%s%s%s (recursive)\n", prefix, branch, label)
+			return
+		case dedup && number[n] > 0:
+			fmt.Fprintf(&b, "%s%s%s (see node #%d)\n", prefix, branch, label, number[n])
+			return
+		case dedup:
+			number[n] = len(number) + 1
+			label = fmt.Sprintf("#%d %s", number[n], label)
+		}
+		fmt.Fprintf(&b, "%s%s%s\n", prefix, branch, label)
+		onPath[n] = true
+		for i, s := range succ[n] {
+			visit(s, prefix+indent, i == len(succ[n])-1, false)
+		}
+		onPath[n] = false
+	}
+
+	for i := 0; i < starts && i < len(g.Nodes); i++ {
+		visit(i, "", true, true)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
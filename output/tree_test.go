@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package output
+
+import (
+	"testing"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Tests the call tree, expanded and deduplicated.
+func TestTree(t *testing.T) {
+	g := graph.New()
+	for _, c := range [][2]string{{"start", "a"}, {"start", "b"}, {"a", "c"}, {"b", "c"}, {"c", "d"}, {"d", "c"}} {
+		from, to := g.AddNode(c[0], "CORE"), g.AddNode(c[1], "CORE")
+		g.Edges = append(g.Edges, graph.Edge{From: from, To: to})
+	}
+
+	expanded := `start [CORE]
+├── a [CORE]
+│   └── c [CORE]
+│       └── d [CORE]
+│           └── c [CORE] (recursive)
+└── b [CORE]
+    └── c [CORE]
+        └── d [CORE]
+            └── c [CORE] (recursive)`
+	if out := Tree(g, 1, false); out != expanded {
+		t.Error("Unexpected expanded tree", out)
+	}
+
+	dedup := `#1 start [CORE]
+├── #2 a [CORE]
+│   └── #3 c [CORE]
+│       └── #4 d [CORE]
+│           └── c [CORE] (recursive)
+└── #5 b [CORE]
+    └── c [CORE] (see node #3)`
+	if out := Tree(g, 1, true); out != dedup {
+		t.Error("Unexpected deduplicated tree", out)
+	}
+}
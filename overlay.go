@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calls between functions both seen at runtime.
+var fmtDotHot = []string{
+	"",
+	"\"%s\"->\"%s\" [color=red penwidth=2]\n",
+	"\\\"%s\\\"->\\\"%s\\\" [color=red penwidth=2] \\\\\\n",
+	"\"%s\"->\"%s\" [color=red penwidth=2]\n",
+	"\"%s\"->\"%s\" [color=red penwidth=2]\n",
+}
+
+// Functions seen at runtime, filled with their heat color.
+var fmtDotNodeHot = []string{
+	"",
+	"\"%s\" [style=filled fillcolor=\"%s\" xlabel=\"%s\"]\n",
+	"\\\"%s\\\" [style=filled fillcolor=\\\"%s\\\" xlabel=\\\"%s\\\"] \\\\\\n",
+	"\"%s\" [style=filled fillcolor=\"%s\" xlabel=\"%s\"]\n",
+	"\"%s\" [style=filled fillcolor=\"%s\" xlabel=\"%s\"]\n",
+}
+
+// Runtime figures of a function: the number of calls, or of samples for
+// perf, and the time spent, known for ftrace only.
+type runtimeStats struct {
+	hits    int
+	runtime time.Duration
+}
+
+// Runtime figures of the functions of a capture, by name.
+type runtimeOverlay struct {
+	funcs   map[string]*runtimeStats
+	maxHits int
+}
+
+var (
+	// Function graph tracer line: cpu, duration and the call after the bar.
+	ftraceLineRe = regexp.MustCompile(`^\s*(\d+)\)(.*?)\|\s?(.*)$`)
+	ftraceDurRe  = regexp.MustCompile(`([\d.]+)\s*us`)
+	ftraceCallRe = regexp.MustCompile(`^\s*([\w.]+)\(\)\s*(;|\{)`)
+	ftraceEndRe  = regexp.MustCompile(`^\s*\}(\s*/\*\s*([\w.]+)\s*\*/)?`)
+	// perf script call chain frame: address and symbol with optional offset.
+	perfFrameRe = regexp.MustCompile(`^\s+[0-9a-fA-F]+\s+([\w.]+?)(\+0x[0-9a-fA-F]+)?\s+\(`)
+)
+
+// Returns the figures of a function, compiler generated clones as foo.isra.0
+// being accounted to their base function.
+func (o *runtimeOverlay) get(name string) *runtimeStats {
+	name = strings.SplitN(name, ".", 2)[0]
+	s, ok := o.funcs[name]
+	if !ok {
+		s = &runtimeStats{}
+		o.funcs[name] = s
+	}
+	return s
+}
+
+// Counts a hit of a function.
+func (o *runtimeOverlay) hit(name string) {
+	s := o.get(name)
+	s.hits++
+	if s.hits > o.maxHits {
+		o.maxHits = s.hits
+	}
+}
+
+// Returns the duration found in the prefix of a function graph line.
+func ftraceDuration(s string) time.Duration {
+	m := ftraceDurRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	us, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+// Parses a function_graph tracer capture. Every entry is a call, the
+// duration of a function is reported on its leaf line or closing brace.
+func parseFtraceGraph(data []byte) *runtimeOverlay {
+	o := &runtimeOverlay{funcs: map[string]*runtimeStats{}}
+	stacks := map[string][]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		m := ftraceLineRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		cpu, dur, call := m[1], ftraceDuration(m[2]), m[3]
+		if c := ftraceCallRe.FindStringSubmatch(call); c != nil {
+			o.hit(c[1])
+			if c[2] == ";" {
+				o.get(c[1]).runtime += dur
+			} else {
+				stacks[cpu] = append(stacks[cpu], c[1])
+			}
+			continue
+		}
+		if c := ftraceEndRe.FindStringSubmatch(call); c != nil {
+			name := c[2]
+			if n := len(stacks[cpu]); n > 0 {
+				name = stacks[cpu][n-1]
+				stacks[cpu] = stacks[cpu][:n-1]
+			}
+			if name != "" {
+				o.get(name).runtime += dur
+			}
+		}
+	}
+	return o
+}
+
+// Parses a perf script capture with call chains. Every sample counts a hit
+// for each function in its chain.
+func parsePerfScript(data []byte) *runtimeOverlay {
+	o := &runtimeOverlay{funcs: map[string]*runtimeStats{}}
+	sample := map[string]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		m := perfFrameRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			sample = map[string]bool{}
+			continue
+		}
+		name := strings.SplitN(m[1], ".", 2)[0]
+		if !sample[name] {
+			sample[name] = true
+			o.hit(name)
+		}
+	}
+	return o
+}
+
+// Loads a runtime capture, either ftrace function_graph or perf script output.
+func loadOverlay(fn string) (*runtimeOverlay, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	o := parseFtraceGraph(data)
+	if len(o.funcs) == 0 {
+		o = parsePerfScript(data)
+	}
+	if len(o.funcs) == 0 {
+		return nil, errors.New("no function found in the runtime capture " + fn)
+	}
+	logger.info("runtime overlay loaded", "file", fn, "functions", len(o.funcs))
+	return o, nil
+}
+
+// Returns the runtime figures of a function, nil if it was not seen.
+func (o *runtimeOverlay) stats(name string) *runtimeStats {
+	if o == nil {
+		return nil
+	}
+	return o.funcs[name]
+}
+
+// Checks if both ends of a call were seen at runtime.
+func (o *runtimeOverlay) hot(l string, r string) bool {
+	return o.stats(l) != nil && o.stats(r) != nil
+}
+
+// Returns the heat color of a function, from yellow to red as hits grow.
+// Functions seen only returning, as when the capture starts mid call, have
+// no hits and may be all there is.
+func (o *runtimeOverlay) heat(name string) color.RGBA {
+	g := 255
+	if o.maxHits > 0 {
+		g -= 255 * o.stats(name).hits / o.maxHits
+	}
+	return color.RGBA{0xff, uint8(g), 0, 0xff}
+}
+
+// Returns the label of a function seen at runtime.
+func (s *runtimeStats) String() string {
+	if s.runtime == 0 {
+		return fmt.Sprintf("%d hits", s.hits)
+	}
+	return fmt.Sprintf("%d hits %s", s.hits, s.runtime)
+}
+
+// Returns the DOT statements coloring the functions of the graph seen at runtime.
+func (o *runtimeOverlay) dotNodes(names []string, flavour int) string {
+	var res string
+
+	for _, name := range names {
+		if s := o.stats(name); s != nil {
+			c := o.heat(name)
+			res += fmt.Sprintf(fmtDotNodeHot[flavour], name, fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B), s)
+		}
+	}
+	return res
+}
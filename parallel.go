@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"sync"
+)
+
+// Successors of a symbol fetched by a prefetch worker, along with the
+// caches the worker filled while fetching them.
+type prefetchResult struct {
+	successors []entry
+	cache      Cache
+	symbolId   int
+}
+
+// Fetches successors and their subsystems for a symbol into a private cache,
+// so that workers never share the maps.
+func prefetchSymbol(nc *navConf, symbolId int) prefetchResult {
+	res := prefetchResult{cache: newCache(), symbolId: symbolId}
+	succ, err := getSuccessorsById(nc.db, symbolId, nc.instance, res.cache)
+	if err != nil {
+		return res
+	}
+	for _, s := range succ {
+		getSubsysFromSymbolName(nc.db, s.symbol, nc.instance, res.cache.subSys)
+	}
+	res.successors = succ
+	return res
+}
+
+// Merges a worker private cache into the shared one.
+func mergeCache(dst Cache, src Cache) {
+	for k, v := range src.successors {
+		dst.successors[k] = v
+	}
+	for k, v := range src.entries {
+		dst.entries[k] = v
+	}
+	for k, v := range src.subSys {
+		dst.subSys[k] = v
+	}
+}
+
+// Warms up the caches by visiting the call graph breadth first, one level at
+// a time, spreading the database lookups of each level across a pool of
+// workers. The navigation that follows runs on the warm caches, so the output
+// is the same as the serial exploration. Exclusions and depth are applied as
+// in navigate, nodes missed here are simply fetched later by navigate.
+func prefetch(nc *navConf, starts []int, workers int) {
+	var frontier []int
+	depth := map[int]int{}
+
+	for _, s := range starts {
+		if _, ok := depth[s]; !ok {
+			depth[s] = 0
+			frontier = append(frontier, s)
+		}
+	}
+
+	for len(frontier) > 0 && nc.ctx.Err() == nil {
+		var wg sync.WaitGroup
+		var next []int
+
+		results := make([]prefetchResult, len(frontier))
+		jobs := make(chan int)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					results[i] = prefetchSymbol(nc, frontier[i])
+				}
+			}()
+		}
+		for i := range frontier {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		for _, r := range results {
+			mergeCache(nc.cache, r.cache)
+			callerSubsys := nc.cache.subSys[nc.cache.entries[r.symbolId].symbol]
+			for _, curr := range r.successors {
+				if _, ok := depth[curr.symId]; ok {
+					continue
+				}
+				subsys := nc.cache.subSys[curr.symbol]
+				if nc.compiledOut[curr.symId] || nc.module.hides(curr.symId) || !notExcluded(curr.symbol, nc.excludedBefore) || !included(curr.symbol, subsys, nc.includeOnly) || !notExcluded(curr.symbol, nc.excludedAfter) {
+					continue
+				}
+				d := depth[r.symbolId]
+				if nc.mode == printAll || callerSubsys != subsys {
+					d++
+				}
+				depth[curr.symId] = d
+				if nc.maxdepth == 0 || d <= nc.maxdepth {
+					next = append(next, curr.symId)
+				}
+			}
+		}
+		frontier = next
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Progress reporting timings: nothing is shown for quick explorations.
+const (
+	progressDelay    = time.Second
+	progressInterval = 500 * time.Millisecond
+	progressLogEvery = 10 * time.Second
+)
+
+// Exploration progress indicator. On a terminal the status line is
+// refreshed in place, otherwise a line is printed from time to time.
+type progress struct {
+	out        io.Writer
+	start      time.Time
+	last       time.Time
+	discovered map[int]bool
+	visited    int
+	tty        bool
+	shown      bool
+}
+
+// Returns a progress indicator writing on stderr.
+func newProgress() *progress {
+	tty := false
+	if fi, err := os.Stderr.Stat(); err == nil {
+		tty = fi.Mode()&os.ModeCharDevice != 0
+	}
+	now := time.Now()
+	return &progress{out: os.Stderr, start: now, last: now, discovered: map[int]bool{}, tty: tty}
+}
+
+// Starts counting again, for a new pass over the graph.
+func (p *progress) restart() {
+	p.discovered = map[int]bool{}
+	p.visited = 0
+}
+
+// Records a node that is going to be explored.
+func (p *progress) discover(id int) {
+	p.discovered[id] = true
+}
+
+// Records a visited node, and refreshes the indicator if it is time to.
+func (p *progress) visit(id int) {
+	p.discovered[id] = true
+	p.visited++
+
+	now := time.Now()
+	interval := progressInterval
+	if !p.tty {
+		interval = progressLogEvery
+	}
+	if now.Sub(p.start) < progressDelay || now.Sub(p.last) < interval {
+		return
+	}
+	p.last = now
+	p.print(now)
+}
+
+// Prints the status: the frontier are the nodes discovered and not yet
+// visited, the ETA assumes the current visit rate.
+func (p *progress) print(now time.Time) {
+	elapsed := now.Sub(p.start)
+	frontier := len(p.discovered) - p.visited
+	eta := time.Duration(float64(elapsed) / float64(p.visited) * float64(frontier))
+	line := fmt.Sprintf("visited %d frontier %d elapsed %s eta %s", p.visited, frontier, elapsed.Round(time.Second), eta.Round(time.Second))
+	if p.tty {
+		fmt.Fprintf(p.out, "\r\033[K%s", line)
+	} else {
+		fmt.Fprintln(p.out, line)
+	}
+	p.shown = true
+}
+
+// Terminates the status line, if any was shown.
+func (p *progress) done() {
+	if p.shown && p.tty {
+		fmt.Fprintln(p.out)
+	}
+}
@@ -6,14 +6,15 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
 	"sort"
 	"strings"
 
-	_ "github.com/lib/pq"
+	navdb "github.com/alessandrocarminati/nav/db"
 )
 
 type outMode int64
@@ -25,31 +26,26 @@ const (
 	printSubsys
 	printSubsysWs
 	printTargeted
+	printSubsysAggr
 	OutModeLast
 )
 const SUBSYS_UNDEF = "The REST"
 
 // Parent node.
 type node struct {
+	id         int
 	subsys     string
 	symbol     string
 	sourceRef  string
 	addressRef string
+	indirect   bool
+	confidence float64
 }
 type adjM struct {
 	l node
 	r node
 }
 
-// Sql connection configuration.
-type connectToken struct {
-	host   string
-	port   int
-	user   string
-	pass   string
-	dbname string
-}
-
 type entry struct {
 	symbol     string
 	fn         string
@@ -57,120 +53,60 @@ type entry struct {
 	addressRef string
 	subsys     []string
 	symId      int
-}
-
-type edge struct {
-	sourceRef  string
-	addressRef string
-	caller     int
-	callee     int
+	indirect   bool
+	confidence float64
 }
 
 type Cache struct {
 	successors map[int][]entry
+	indirect   map[int][]entry
 	entries    map[int]entry
 	subSys     map[string]string
 }
 
-// Connects the target db and returns the handle.
-func connectDb(t *connectToken) *sql.DB {
-	psqlconn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", t.host, t.port, t.user, t.pass, t.dbname)
-	db, err := sql.Open("postgres", psqlconn)
-	if err != nil {
-		panic(err)
-	}
-	return db
-}
-
 // Returns function details from a given id.
-func getEntryById(db *sql.DB, symbolId int, instance int, cache map[int]entry) (entry, error) {
-	var e entry
-	var s sql.NullString
-
+func getEntryById(db navdb.Conn, symbolId int, instance int, cache map[int]entry) (entry, error) {
 	if e, ok := cache[symbolId]; ok {
 		return e, nil
 	}
-
-	query := "select symbol_id, symbol_name, subsys_name, file_name from " +
-		"(select * from symbols, files where symbols.symbol_file_ref_id=files.file_id and symbols.symbol_instance_id_ref=$2) as dummy " +
-		"left outer join tags on dummy.symbol_file_ref_id=tags.tag_file_ref_id where symbol_id=$1 and symbol_instance_id_ref=$2"
-	rows, err := db.Query(query, symbolId, instance)
+	sym, err := navdb.SymbolById(db, symbolId, instance)
 	if err != nil {
-		panic(err)
-	}
-	defer func() {
-		closeErr := rows.Close()
-		if err == nil {
-			err = closeErr
-		}
-	}()
-
-	for rows.Next() {
-		if err := rows.Scan(&e.symId, &e.symbol, &s, &e.fn); err != nil {
-			fmt.Println("getEntryById: error while scan query rows")
-			fmt.Println(err)
-			return e, err
-		}
-		if s.Valid {
-			e.subsys = append(e.subsys, s.String)
-		}
-	}
-	if err = rows.Err(); err != nil {
-		fmt.Println("getEntryById: error in access query rows")
-		return e, err
+		return entry{}, err
 	}
+	e := entry{symbol: sym.Name, fn: sym.File, subsys: sym.Subsys, symId: sym.Id}
+	logger.debug("rows fetched", "function", "getEntryById", "id", symbolId, "symbol", e.symbol, "subsystems", len(e.subsys))
 	cache[symbolId] = e
 	return e, nil
 }
 
 // Returns the list of successors (called function) for a given function.
-func getSuccessorsById(db *sql.DB, symbolId int, instance int, cache Cache) ([]entry, error) {
-	var e edge
-	var res []entry
-
+func getSuccessorsById(db navdb.Conn, symbolId int, instance int, cache Cache) ([]entry, error) {
 	if res, ok := cache.successors[symbolId]; ok {
 		return res, nil
 	}
-
-	query := "select caller, callee, source_line, ref_addr from xrefs where caller =$1 and xref_instance_id_ref=$2"
-	rows, err := db.Query(query, symbolId, instance)
+	calls, err := navdb.Calls(db, symbolId, instance)
 	if err != nil {
-		panic(err)
-	}
-	defer func() {
-		closeErr := rows.Close()
-		if err == nil {
-			err = closeErr
-		}
-	}()
-
-	for rows.Next() {
-		if err := rows.Scan(&e.caller, &e.callee, &e.sourceRef, &e.addressRef); err != nil {
-			fmt.Println("get_successors_by_id: error while scan query rows", err)
-			return nil, err
-		}
-		successor, _ := getEntryById(db, e.callee, instance, cache.entries)
-		successor.sourceRef = e.sourceRef
-		successor.addressRef = e.addressRef
-		res = append(res, successor)
-	}
-	if err = rows.Err(); err != nil {
-		fmt.Println("get_successors_by_id: error in access query rows")
 		return nil, err
 	}
+	res := callees(db, calls, instance, cache)
+	logger.debug("rows fetched", "function", "getSuccessorsById", "id", symbolId, "rows", len(res))
 	cache.successors[symbolId] = res
 	return res, nil
 }
 
-// Return id an item is already in the list.
-func notIn(list []int, v int) bool {
+// Returns the functions called, each with its call site.
+func callees(db navdb.Conn, calls []navdb.Call, instance int, cache Cache) []entry {
+	var res []entry
 
-	for _, a := range list {
-		if a == v {
-			return false
-		}
+	for _, c := range calls {
+		successor, _ := getEntryById(db, c.Callee, instance, cache.entries)
+		successor.sourceRef = c.SourceRef
+		successor.addressRef = c.AddressRef
+		successor.indirect = c.Indirect
+		successor.confidence = c.Confidence
+		res = append(res, successor)
 	}
-	return true
+	return res
 }
 
 // Removes duplicates resulting by the exploration of a call tree.
@@ -189,70 +125,35 @@ func removeDuplicate(list []entry) []entry {
 }
 
 // Given a function returns the lager subsystem it belongs.
-func getSubsysFromSymbolName(db *sql.DB, symbol string, instance int, subsytemsCache map[string]string) (string, error) {
-	var ty, sub string
-
+func getSubsysFromSymbolName(db navdb.Conn, symbol string, instance int, subsytemsCache map[string]string) (string, error) {
 	if res, ok := subsytemsCache[symbol]; ok {
 		return res, nil
 	}
-	query := "select (select symbol_type from symbols where symbol_name=$1 and symbol_instance_id_ref=$2) as type, subsys_name from " +
-		"(select count(*) as cnt, subsys_name from tags where subsys_name in (select subsys_name from symbols, " +
-		"tags where symbols.symbol_file_ref_id=tags.tag_file_ref_id and symbols.symbol_name=$1 and symbols.symbol_instance_id_ref=$2) " +
-		"group by subsys_name order by cnt desc) as tbl;"
-
-	rows, err := db.Query(query, symbol, instance)
+	sub, err := navdb.SymbolSubsys(db, symbol, instance)
 	if err != nil {
-		panic(err)
-	}
-	defer func() {
-		closeErr := rows.Close()
-		if err == nil {
-			err = closeErr
-		}
-	}()
-
-	for rows.Next() {
-		if err := rows.Scan(&ty, &sub); err != nil {
-			fmt.Println("get_subsys_from_symbol_name: error while scan query rows")
-			return "", err
-		}
-	}
-
-	if ty == "indirect" {
-		sub = ty
+		return "", err
 	}
+	logger.debug("rows fetched", "function", "getSubsysFromSymbolName", "symbol", symbol, "subsystem", sub)
 	subsytemsCache[symbol] = sub
 	return sub, nil
 }
 
 // Returns the id of a given function name.
-func sym2num(db *sql.DB, symb string, instance int) (int, error) {
-	var res = 0
-	var cnt = 0
-	query := "select symbol_id from symbols where symbols.symbol_name=$1 and symbols.symbol_instance_id_ref=$2"
-	rows, err := db.Query(query, symb, instance)
-	if err != nil {
-		panic(err)
+func sym2num(db navdb.Conn, symb string, instance int) (int, error) {
+	id, err := navdb.SymbolId(db, symb, instance)
+	if errors.Is(err, navdb.ErrSymbolNotFound) {
+		return id, symbolNotFound(db, symb, instance)
 	}
-	defer func() {
-		closeErr := rows.Close()
-		if err == nil {
-			err = closeErr
-		}
-	}()
+	return id, err
+}
 
-	for rows.Next() {
-		cnt++
-		if err := rows.Scan(&res); err != nil {
-			fmt.Println("sym2num: error while scan query rows")
-			fmt.Println(err)
-			return res, err
-		}
+// Returns the error of a symbol missing from an instance, or of the missing
+// instance itself.
+func symbolNotFound(db navdb.Conn, symb string, instance int) error {
+	if _, err := getInstanceMeta(db, instance); err != nil {
+		return err
 	}
-	if cnt != 1 {
-		return res, errors.New("duplicate ID in the DB")
-	}
-	return res, nil
+	return exitError{exitSymbolNotFound, fmt.Errorf("symbol %s not found in instance %d", symb, instance)}
 }
 
 // Checks if a given function needs to be explored.
@@ -266,39 +167,249 @@ func notExcluded(symbol string, excluded []string) bool {
 	return true
 }
 
-// Computes the call tree of a given function name
-// TODO: refactory needed:
-// What is the problem: too many args.
-// suggestion: New version with input and output structs.
-func navigate(db *sql.DB, symbolId int, parentDispaly node, targets []string, visited *[]int, AdjMap *[]adjM, prod map[string]int, instance int, cache Cache, mode outMode, excludedAfter []string, excludedBefore []string, depth int, maxdepth int, dotFmt string, output *string) {
+// Exploration parameters, they do not change while navigating.
+type navConf struct {
+	ctx            context.Context
+	db             navdb.Conn
+	cache          Cache
+	targets        []string
+	excludedAfter  []string
+	excludedBefore []string
+	includeOnly    []string
+	compiledOut    map[int]bool
+	// Functions outside the module are not explored, the ones hidden by
+	// the visibility filter are but their calls are shown as made by the
+	// visible caller.
+	module         *symbolSet
+	visibility     *symbolSet
+	collapsed      map[int][]entry
+	explored       map[int]bool
+	stream         func(l node, r node, depth int)
+	progress       *progress
+	dotFmt         string
+	dotFmtIndirect string
+	dotFmtHot      string
+	overlay        *runtimeOverlay
+	instance       int
+	maxdepth       int
+	maxNodes       int
+	maxEdges       int
+	mode           outMode
+	reportCycles   bool
+	followIndirect bool
+	strategy       string
+}
+
+// Exploration results, they accumulate while navigating and can be shared
+// among several start symbols.
+type navResult struct {
+	prod    map[string]int
+	seen    map[int]bool
+	visited []int
+	adjm    []adjM
+	calls   []adjM
+	output  string
+	// Ids and names of the functions being explored, from the start symbol.
+	path      []int
+	pathNames []string
+	cycles    [][]string
+	cycleKeys map[string]bool
+	// Functions and calls in the output, to enforce the budget.
+	nodes         map[int]bool
+	edges         int
+	truncated     []string
+	truncatedIds  []int
+	truncatedKeys map[string]bool
+	// Functions not expanded because of the depth limit.
+	depthCut []int
+	// Breadth first queue.
+	queue  []visit
+	queued map[int]bool
+}
+
+// Returns an empty exploration result.
+func newNavResult() navResult {
+	return navResult{prod: map[string]int{}, seen: map[int]bool{}, cycleKeys: map[string]bool{}, nodes: map[int]bool{}, truncatedKeys: map[string]bool{}, queued: map[int]bool{}}
+}
+
+// Returns an empty set of caches.
+func newCache() Cache {
+	return Cache{make(map[int][]entry), make(map[int][]entry), make(map[int]entry), make(map[string]string)}
+}
+
+// Checks if a function is allowed by the include list, matching either its
+// name or its subsystem. An empty list allows everything.
+func included(symbol string, subsys string, includeOnly []string) bool {
+	if len(includeOnly) == 0 {
+		return true
+	}
+	return !notExcluded(symbol, includeOnly) || !notExcluded(subsys, includeOnly)
+}
+
+// Returns the callees of a function, the indirect ones too if followed.
+func (nc *navConf) successors(symbolId int) ([]entry, error) {
+	successors, err := getSuccessorsById(nc.db, symbolId, nc.instance, nc.cache)
+	if err == nil && nc.followIndirect {
+		var indirect []entry
+		indirect, err = getIndirectSuccessorsById(nc.db, symbolId, nc.instance, nc.cache)
+		successors = append(successors, indirect...)
+	}
+	return successors, err
+}
+
+// Returns the visible functions a function hidden by the visibility filter
+// leads to: its visible callees and, recursively, the ones of its hidden
+// callees. Functions compiled out, outside the module or excluded are not
+// followed.
+func (nc *navConf) reachedThrough(symbolId int) []entry {
+	var res []entry
+
+	if res, ok := nc.collapsed[symbolId]; ok {
+		return res
+	}
+	seen := map[int]bool{symbolId: true}
+	queue := []int{symbolId}
+	for len(queue) > 0 {
+		successors, err := nc.successors(queue[0])
+		if err != nil {
+			logger.info("successors lookup failed", "id", queue[0], "error", err)
+		}
+		queue = queue[1:]
+		for _, curr := range successors {
+			if seen[curr.symId] || nc.compiledOut[curr.symId] || nc.module.hides(curr.symId) {
+				continue
+			}
+			seen[curr.symId] = true
+			switch {
+			case !nc.visibility.hides(curr.symId):
+				res = append(res, curr)
+			case notExcluded(curr.symbol, nc.excludedBefore) && notExcluded(curr.symbol, nc.excludedAfter):
+				logger.info("hidden, explored", "symbol", curr.symbol)
+				queue = append(queue, curr.symId)
+			}
+		}
+	}
+	if nc.collapsed == nil {
+		nc.collapsed = map[int][]entry{}
+	}
+	nc.collapsed[symbolId] = res
+	return res
+}
+
+// Replaces the calls to the functions hidden by the visibility filter with
+// calls to the visible functions they lead to, made from the call site of
+// the hidden function and indirect if any call on the way is.
+func (nc *navConf) skipHidden(successors []entry) []entry {
+	var res []entry
+
+	for _, curr := range successors {
+		if !nc.visibility.hides(curr.symId) {
+			res = append(res, curr)
+			continue
+		}
+		for _, e := range nc.reachedThrough(curr.symId) {
+			e.sourceRef, e.addressRef = curr.sourceRef, curr.addressRef
+			switch {
+			case curr.indirect && e.indirect:
+				e.confidence = math.Min(e.confidence, curr.confidence)
+			case curr.indirect:
+				e.indirect, e.confidence = true, curr.confidence
+			}
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Computes the call tree of a given function name.
+func navigate(nc *navConf, res *navResult, symbolId int, parentDispaly node, depth int) {
 	var tmp, s string
 	var l, r, ll node
 	var depthInc = 0
 
-	*visited = append(*visited, symbolId)
+	if nc.ctx.Err() != nil {
+		return
+	}
+	res.visited = append(res.visited, symbolId)
+	res.seen[symbolId] = true
+	res.nodes[symbolId] = true
 	l = parentDispaly
-	successors, err := getSuccessorsById(db, symbolId, instance, cache)
-	if mode == printAll {
+	l.id = symbolId
+	res.path = append(res.path, symbolId)
+	res.pathNames = append(res.pathNames, l.symbol)
+	defer func() {
+		res.path = res.path[:len(res.path)-1]
+		res.pathNames = res.pathNames[:len(res.pathNames)-1]
+	}()
+	logger.info("visit", "symbol", l.symbol, "id", symbolId, "depth", depth)
+	if nc.progress != nil {
+		nc.progress.visit(symbolId)
+	}
+	successors, err := nc.successors(symbolId)
+	if err == nil && nc.visibility != nil {
+		successors = nc.skipHidden(successors)
+	}
+	if nc.mode == printAll {
 		successors = removeDuplicate(successors)
 	}
+	if err != nil {
+		logger.info("successors lookup failed", "symbol", l.symbol, "error", err)
+	}
+	if nc.progress != nil && (nc.maxdepth == 0 || depth < nc.maxdepth) {
+		for _, curr := range successors {
+			if !res.seen[curr.symId] && !nc.compiledOut[curr.symId] && !nc.module.hides(curr.symId) && notExcluded(curr.symbol, nc.excludedBefore) && notExcluded(curr.symbol, nc.excludedAfter) {
+				nc.progress.discover(curr.symId)
+			}
+		}
+	}
 	if err == nil {
 		for _, curr := range successors {
-			if notExcluded(curr.symbol, excludedBefore) {
+			if nc.compiledOut[curr.symId] {
+				logger.info("compiled out", "symbol", curr.symbol, "caller", l.symbol)
+				continue
+			}
+			if nc.module.hides(curr.symId) {
+				logger.info("outside the module", "symbol", curr.symbol, "caller", l.symbol)
+				continue
+			}
+			if !notExcluded(curr.symbol, nc.excludedBefore) {
+				logger.info("excluded before", "symbol", curr.symbol, "caller", l.symbol)
+			}
+			if notExcluded(curr.symbol, nc.excludedBefore) {
+				r.id = curr.symId
 				r.symbol = curr.symbol
 				r.sourceRef = curr.sourceRef
 				r.addressRef = curr.addressRef
-				tmp, _ = getSubsysFromSymbolName(db, r.symbol, instance, cache.subSys)
+				r.indirect = curr.indirect
+				r.confidence = curr.confidence
+				tmp, _ = getSubsysFromSymbolName(nc.db, r.symbol, nc.instance, nc.cache.subSys)
+				if !included(curr.symbol, tmp, nc.includeOnly) {
+					logger.info("not included", "symbol", curr.symbol, "subsystem", tmp, "caller", l.symbol)
+					continue
+				}
+				r.subsys = tmp
 				if tmp == "" {
 					r.subsys = SUBSYS_UNDEF
 				}
+				if nc.overBudget(res, curr.symId) {
+					res.truncate(symbolId, l.symbol)
+					continue
+				}
+				res.edges++
+				res.nodes[curr.symId] = true
 
-				switch mode {
+				switch nc.mode {
 				case printAll:
-					s = fmt.Sprintf(dotFmt, l.symbol, r.symbol)
+					s = fmt.Sprintf(nc.dotFmt, l.symbol, r.symbol)
+					if r.indirect {
+						s = fmt.Sprintf(nc.dotFmtIndirect, l.symbol, r.symbol, r.confidence)
+					} else if nc.overlay.hot(l.symbol, r.symbol) {
+						s = fmt.Sprintf(nc.dotFmtHot, l.symbol, r.symbol)
+					}
 					ll = r
 					depthInc = 1
-				case printSubsys, printSubsysWs, printTargeted:
-					if tmp, _ = getSubsysFromSymbolName(db, r.symbol, instance, cache.subSys); r.subsys != tmp {
+				case printSubsys, printSubsysWs, printTargeted, printSubsysAggr:
+					if tmp, _ = getSubsysFromSymbolName(nc.db, r.symbol, nc.instance, nc.cache.subSys); r.subsys != tmp {
 						if tmp != "" {
 							r.subsys = tmp
 						} else {
@@ -307,30 +418,46 @@ func navigate(db *sql.DB, symbolId int, parentDispaly node, targets []string, vi
 					}
 
 					if l.subsys != r.subsys {
-						s = fmt.Sprintf(dotFmt, l.subsys, r.subsys)
-						*AdjMap = append(*AdjMap, adjM{l, r})
+						s = fmt.Sprintf(nc.dotFmt, l.subsys, r.subsys)
+						res.adjm = append(res.adjm, adjM{l, r})
 						depthInc = 1
 					} else {
 						s = ""
 					}
 					ll = r
 				default:
-					panic(mode)
+					panic(nc.mode)
 				}
-				if _, ok := prod[s]; ok {
-					prod[s]++
+				if nc.stream != nil {
+					if s != "" && ((nc.mode != printTargeted) || (intargets(nc.targets, l.subsys, r.subsys))) {
+						nc.stream(l, r, depth+1)
+					}
 				} else {
-					prod[s] = 1
-					if s != "" {
-						if (mode != printTargeted) || (intargets(targets, l.subsys, r.subsys)) {
-							*output = (*output) + s
+					res.calls = append(res.calls, adjM{l, r})
+					if _, ok := res.prod[s]; ok {
+						res.prod[s]++
+					} else {
+						res.prod[s] = 1
+						if s != "" && nc.mode != printSubsysAggr {
+							if (nc.mode != printTargeted) || (intargets(nc.targets, l.subsys, r.subsys)) {
+								res.output += s
+							}
 						}
 					}
 				}
 
-				if notIn(*visited, curr.symId) {
-					if (notExcluded(curr.symbol, excludedAfter) || notExcluded(curr.symbol, excludedBefore)) && (maxdepth == 0 || ((maxdepth > 0) && (depth < maxdepth))) {
-						navigate(db, curr.symId, ll, targets, visited, AdjMap, prod, instance, cache, mode, excludedBefore, excludedBefore, depth+depthInc, maxdepth, dotFmt, output)
+				if nc.reportCycles {
+					res.addCycle(curr.symId)
+				}
+				if !res.seen[curr.symId] {
+					if !notExcluded(curr.symbol, nc.excludedAfter) {
+						logger.info("excluded after, not expanded", "symbol", curr.symbol)
+					} else if nc.maxdepth > 0 && depth >= nc.maxdepth {
+						logger.info("depth limit, not expanded", "symbol", curr.symbol, "depth", depth)
+						res.depthCut = append(res.depthCut, curr.symId)
+					}
+					if notExcluded(curr.symbol, nc.excludedAfter) && (nc.maxdepth == 0 || ((nc.maxdepth > 0) && (depth < nc.maxdepth))) {
+						nc.next(res, curr.symId, ll, depth+depthInc)
 					}
 				}
 			}
@@ -350,7 +477,7 @@ func intargets(targets []string, n1 string, n2 string) bool {
 }
 
 // Returns the subsystem list associated with a given function name.
-func symbSubsys(db *sql.DB, symblist []int, instance int, cache Cache) (string, error) {
+func symbSubsys(db navdb.Conn, symblist []int, instance int, cache Cache) (string, error) {
 	var out string
 	var res string
 
@@ -364,19 +491,17 @@ func symbSubsys(db *sql.DB, symblist []int, instance int, cache Cache) (string,
 			return "", errors.New("symbSubsys: query failed")
 		}
 
-		defer func() {
-			closeErr := rows.Close()
-			if err == nil {
-				err = closeErr
-			}
-		}()
-
 		for rows.Next() {
 			if err := rows.Scan(&res); err != nil {
+				rows.Close()
 				return "", errors.New("symbSubsys: error while scan query rows")
 			}
 			out += fmt.Sprintf("\"%s\",", res)
 		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
 		out = strings.TrimSuffix(out, ",") + "]},"
 	}
 	out = strings.TrimSuffix(out, ",")
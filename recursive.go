@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Functions reachable from the start ones, within the max depth if any.
+// Without depth limit the union discards the functions already reached,
+// with it the (function, depth) pairs, so that both terminate.
+const (
+	reachQuery      = "with recursive reach(id) as (select symbol_id from symbols where symbol_id in (%s) union select xrefs.callee from xrefs, reach where xrefs.caller=reach.id and xrefs.xref_instance_id_ref=$1)"
+	reachDepthQuery = "with recursive reach(id, depth) as (select symbol_id, 0 from symbols where symbol_id in (%s) union select xrefs.callee, reach.depth+1 from xrefs, reach " +
+		"where xrefs.caller=reach.id and xrefs.xref_instance_id_ref=$1 and reach.depth<$2)"
+)
+
+// Returns the reach common table expression and its arguments. The callers
+// are the reached functions to be expanded, the ones below the max depth.
+func reachCTE(nc *navConf, starts []int) (string, string, []interface{}) {
+	ids := make([]string, len(starts))
+	for i, s := range starts {
+		ids[i] = strconv.Itoa(s)
+	}
+	if nc.maxdepth == 0 {
+		return fmt.Sprintf(reachQuery, strings.Join(ids, ",")), "select id from reach", []interface{}{nc.instance}
+	}
+	return fmt.Sprintf(reachDepthQuery, strings.Join(ids, ",")), "select id from reach where depth<$2", []interface{}{nc.instance, nc.maxdepth}
+}
+
+// Fills the caches with the calls made by all the functions reachable from
+// the starts and the details of the functions called, with a single recursive
+// query each instead of two queries per function. Filters are applied later
+// by navigate, hence the functions they drop are fetched anyway. Subsystems
+// and indirect calls are still looked up per function.
+func prefetchRecursive(nc *navConf, starts []int) error {
+	cte, callers, args := reachCTE(nc, starts)
+	rows, err := nc.db.Query(cte+" select symbol_id, symbol_name, subsys_name, file_name from "+
+		"(select * from symbols, files where symbols.symbol_file_ref_id=files.file_id and symbols.symbol_instance_id_ref=$1) as dummy "+
+		"left outer join tags on dummy.symbol_file_ref_id=tags.tag_file_ref_id where symbol_id in (select id from reach)", args...)
+	if err != nil {
+		return err
+	}
+	entries := map[int]entry{}
+	for rows.Next() {
+		var e entry
+		var s sql.NullString
+		if err := rows.Scan(&e.symId, &e.symbol, &s, &e.fn); err != nil {
+			rows.Close()
+			return err
+		}
+		if prev, ok := entries[e.symId]; ok {
+			e.subsys = prev.subsys
+		}
+		if s.Valid {
+			e.subsys = append(e.subsys, s.String)
+		}
+		entries[e.symId] = e
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, e := range entries {
+		nc.cache.entries[id] = e
+	}
+
+	rows, err = nc.db.Query(cte+" select caller, callee, source_line, ref_addr from xrefs where xref_instance_id_ref=$1 and caller in ("+callers+")", args...)
+	if err != nil {
+		return err
+	}
+	var calls []navdb.Call
+	for rows.Next() {
+		var c navdb.Call
+		if err := rows.Scan(&c.Caller, &c.Callee, &c.SourceRef, &c.AddressRef); err != nil {
+			rows.Close()
+			return err
+		}
+		calls = append(calls, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// The callees are resolved once the rows are closed, not to hold a
+	// second connection.
+	successors := map[int][]entry{}
+	for _, c := range calls {
+		successor, _ := getEntryById(nc.db, c.Callee, nc.instance, nc.cache.entries)
+		successor.sourceRef = c.SourceRef
+		successor.addressRef = c.AddressRef
+		successors[c.Caller] = append(successors[c.Caller], successor)
+	}
+	ids, err := queryColumn(nc.db, cte+" "+callers, args...)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		n, _ := strconv.Atoi(id)
+		nc.cache.successors[n] = successors[n]
+	}
+	logger.info("recursive prefetch", "functions", len(entries), "callers", len(ids))
+	return nil
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Layout metrics, in pixels. Character width matches the raster font.
+const (
+	renderCharW    = 7
+	renderNodeH    = 26
+	renderNodePad  = 10
+	renderNodeGap  = 20
+	renderLayerGap = 80
+	renderMargin   = 20
+	renderArrow    = 8
+)
+
+// Node fill colors, assigned to subsystems by hashing their names.
+var renderPalette = []color.RGBA{
+	{0xa6, 0xce, 0xe3, 0xff},
+	{0xb2, 0xdf, 0x8a, 0xff},
+	{0xfb, 0x9a, 0x99, 0xff},
+	{0xfd, 0xbf, 0x6f, 0xff},
+	{0xca, 0xb2, 0xd6, 0xff},
+	{0xff, 0xff, 0x99, 0xff},
+	{0x8d, 0xd3, 0xc7, 0xff},
+	{0xfc, 0xcd, 0xe5, 0xff},
+}
+
+// Graph node with its computed position.
+type renderNode struct {
+	graph.Node
+	x    int
+	y    int
+	w    int
+	fill color.RGBA
+}
+
+// Graph laid out in layers by depth, ready to be drawn.
+type renderLayout struct {
+	nodes  []renderNode
+	edges  []graph.Edge
+	hot    []bool
+	width  int
+	height int
+}
+
+// Returns the fill color of a subsystem.
+func subsysColor(subsys string) color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(subsys))
+	return renderPalette[h.Sum32()%uint32(len(renderPalette))]
+}
+
+// Places nodes in rows by depth, ordering each row by the average position of
+// the predecessors in the row above to limit edge crossings.
+func layoutGraph(g *graph.Graph) *renderLayout {
+	var layers [][]int
+	l := renderLayout{edges: g.Edges, hot: make([]bool, len(g.Edges))}
+
+	for i, n := range g.Nodes {
+		for len(layers) <= n.Depth {
+			layers = append(layers, nil)
+		}
+		layers[n.Depth] = append(layers[n.Depth], i)
+		l.nodes = append(l.nodes, renderNode{Node: n, w: len(n.Name)*renderCharW + 2*renderNodePad, fill: subsysColor(n.Subsys)})
+	}
+
+	pos := make([]float64, len(g.Nodes))
+	pred := make([][]int, len(g.Nodes))
+	for _, e := range g.Edges {
+		pred[e.To] = append(pred[e.To], e.From)
+	}
+	for d, layer := range layers {
+		if d > 0 {
+			bary := map[int]float64{}
+			for _, n := range layer {
+				sum, cnt := 0.0, 0
+				for _, p := range pred[n] {
+					if g.Nodes[p].Depth == d-1 {
+						sum += pos[p]
+						cnt++
+					}
+				}
+				if cnt > 0 {
+					bary[n] = sum / float64(cnt)
+				}
+			}
+			sort.SliceStable(layer, func(i, j int) bool { return bary[layer[i]] < bary[layer[j]] })
+		}
+		for i, n := range layer {
+			pos[n] = float64(i)
+		}
+	}
+
+	rowWidth := make([]int, len(layers))
+	for d, layer := range layers {
+		for _, n := range layer {
+			rowWidth[d] += l.nodes[n].w + renderNodeGap
+		}
+		rowWidth[d] -= renderNodeGap
+		if rowWidth[d] > l.width {
+			l.width = rowWidth[d]
+		}
+	}
+	for d, layer := range layers {
+		x := renderMargin + (l.width-rowWidth[d])/2
+		for _, n := range layer {
+			l.nodes[n].x = x
+			l.nodes[n].y = renderMargin + d*(renderNodeH+renderLayerGap)
+			x += l.nodes[n].w + renderNodeGap
+		}
+	}
+	l.width += 2 * renderMargin
+	l.height = 2*renderMargin + len(layers)*(renderNodeH+renderLayerGap) - renderLayerGap
+	return &l
+}
+
+// Returns the edge end points, from the bottom of the caller to the top of the callee.
+func (l *renderLayout) edgePoints(e graph.Edge) (int, int, int, int) {
+	from, to := l.nodes[e.From], l.nodes[e.To]
+	return from.x + from.w/2, from.y + renderNodeH, to.x + to.w/2, to.y
+}
+
+// Colors the functions seen at runtime by heat, and the calls between them in red.
+func (l *renderLayout) applyOverlay(o *runtimeOverlay) {
+	for i, n := range l.nodes {
+		if o.stats(n.Name) != nil {
+			l.nodes[i].fill = o.heat(n.Name)
+		}
+	}
+	for i, e := range l.edges {
+		l.hot[i] = o.hot(l.nodes[e.From].Name, l.nodes[e.To].Name)
+	}
+}
+
+// Colors the functions of the coverage report, green if covered and red if not.
+func (l *renderLayout) applyCoverage(c coverage) {
+	for i, n := range l.nodes {
+		if fc, ok := c[n.Name]; ok {
+			l.nodes[i].fill = fc.color()
+		}
+	}
+}
+
+// Returns the color of an edge.
+func (l *renderLayout) edgeColor(i int) color.RGBA {
+	if l.hot[i] {
+		return color.RGBA{0xff, 0, 0, 0xff}
+	}
+	return color.RGBA{0, 0, 0, 0xff}
+}
+
+// Edges leaving nodes deeper than thinDepth are drawn thinner, 0 disables thinning.
+func edgeWidth(l *renderLayout, e graph.Edge, thinDepth int) int {
+	if thinDepth > 0 && l.nodes[e.From].Depth >= thinDepth {
+		return 1
+	}
+	return 2
+}
+
+// Renders the layout as SVG document.
+func renderSVG(l *renderLayout, thinDepth int) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n", l.width, l.height)
+	fmt.Fprintf(&b, "<defs><marker id=\"arrow\" markerWidth=\"%[1]d\" markerHeight=\"%[1]d\" refX=\"%[1]d\" refY=\"%[2]d\" orient=\"auto\" markerUnits=\"userSpaceOnUse\"><path d=\"M0,0 L%[1]d,%[2]d L0,%[1]d z\"/></marker></defs>\n", renderArrow, renderArrow/2)
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	for i, e := range l.edges {
+		x1, y1, x2, y2 := l.edgePoints(e)
+		c := l.edgeColor(i)
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#%02x%02x%02x\" stroke-width=\"%d\" marker-end=\"url(#arrow)\"/>\n", x1, y1, x2, y2, c.R, c.G, c.B, edgeWidth(l, e, thinDepth))
+	}
+	for _, n := range l.nodes {
+		c := n.fill
+		fmt.Fprintf(&b, "<g><title>%s</title><rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"6\" fill=\"#%02x%02x%02x\" stroke=\"black\"/>", html.EscapeString(n.Subsys), n.x, n.y, n.w, renderNodeH, c.R, c.G, c.B)
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\" dominant-baseline=\"central\">%s</text></g>\n", n.x+n.w/2, n.y+renderNodeH/2, html.EscapeString(n.Name))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// Draws a line using the Bresenham algorithm.
+func drawLine(img *image.RGBA, x1, y1, x2, y2 int, width int, c color.Color) {
+	dx, dy := abs(x2-x1), -abs(y2-y1)
+	sx, sy := 1, 1
+	if x1 > x2 {
+		sx = -1
+	}
+	if y1 > y2 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		for i := 0; i < width; i++ {
+			for j := 0; j < width; j++ {
+				img.Set(x1+i, y1+j, c)
+			}
+		}
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y1 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Renders the layout as PNG image.
+func renderPNG(l *renderLayout, thinDepth int) ([]byte, error) {
+	var b bytes.Buffer
+
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, e := range l.edges {
+		x1, y1, x2, y2 := l.edgePoints(e)
+		w := edgeWidth(l, e, thinDepth)
+		c := l.edgeColor(i)
+		drawLine(img, x1, y1, x2, y2, w, c)
+		drawLine(img, x2, y2, x2-renderArrow/2, y2-renderArrow, w, c)
+		drawLine(img, x2, y2, x2+renderArrow/2, y2-renderArrow, w, c)
+	}
+	d := font.Drawer{Dst: img, Src: image.Black, Face: basicfont.Face7x13}
+	for _, n := range l.nodes {
+		r := image.Rect(n.x, n.y, n.x+n.w, n.y+renderNodeH)
+		draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+		draw.Draw(img, r.Inset(1), &image.Uniform{n.fill}, image.Point{}, draw.Src)
+		d.Dot = fixed.P(n.x+renderNodePad, n.y+renderNodeH/2+4)
+		d.DrawString(n.Name)
+	}
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Returns true if the file name asks for a rendered image.
+func isRenderTarget(fn string) bool {
+	ext := strings.ToLower(filepath.Ext(fn))
+	return ext == ".svg" || ext == ".png"
+}
+
+// Renders the exploration in the image format selected by the file extension.
+func render(e *exploration, conf *configuration) ([]byte, error) {
+	l := layoutGraph(newOutGraph(e, conf.Mode))
+	if e.coverage != nil && conf.Mode == printAll {
+		l.applyCoverage(e.coverage)
+	}
+	if e.overlay != nil && conf.Mode == printAll {
+		l.applyOverlay(e.overlay)
+	}
+	switch strings.ToLower(filepath.Ext(conf.OutFile)) {
+	case ".svg":
+		return renderSVG(l, conf.ThinDepth), nil
+	case ".png":
+		return renderPNG(l, conf.ThinDepth)
+	default:
+		return nil, fmt.Errorf("unsupported image format %s", conf.OutFile)
+	}
+}
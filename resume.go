@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Prefix of the resume tokens, versioning their encoding.
+const resumePrefix = "nav1."
+
+// Function left unexpanded by the depth limit or the budget.
+type frontierFunc struct {
+	Id     int    `json:"id"`
+	Symbol string `json:"symbol"`
+}
+
+// State of a cut exploration, enough to continue it: the functions whose
+// calls were all explored, ids delta encoded, and the frontier.
+type resumeToken struct {
+	Instance int            `json:"instance"`
+	Explored []int          `json:"explored"`
+	Frontier []frontierFunc `json:"frontier"`
+}
+
+// Resume section of the outputs.
+type resumeDoc struct {
+	Token    string   `json:"token"`
+	Frontier []string `json:"frontier"`
+}
+
+// Streamed record of the resume token.
+type ndjsonResume struct {
+	Type     string   `json:"type"`
+	Token    string   `json:"token"`
+	Frontier []string `json:"frontier"`
+}
+
+// Returns the token resuming an exploration, nil if nothing was cut. The
+// functions truncated by the budget are on the frontier, to be explored
+// again, the ones cut by the depth limit unless reached by a shorter path.
+func newResumeToken(nc *navConf, res *navResult) (*resumeToken, error) {
+	t := resumeToken{Instance: nc.instance}
+	frontier := map[int]bool{}
+
+	add := func(id int) error {
+		if frontier[id] {
+			return nil
+		}
+		e, err := getEntryById(nc.db, id, nc.instance, nc.cache.entries)
+		if err != nil {
+			return err
+		}
+		frontier[id] = true
+		t.Frontier = append(t.Frontier, frontierFunc{id, e.symbol})
+		return nil
+	}
+	for _, id := range res.truncatedIds {
+		if err := add(id); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range res.depthCut {
+		if !res.seen[id] {
+			if err := add(id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(t.Frontier) == 0 {
+		return nil, nil
+	}
+
+	var explored []int
+	for id := range res.seen {
+		if !frontier[id] {
+			explored = append(explored, id)
+		}
+	}
+	sort.Ints(explored)
+	prev := 0
+	for _, id := range explored {
+		t.Explored = append(t.Explored, id-prev)
+		prev = id
+	}
+	return &t, nil
+}
+
+// Returns the ids of the explored functions.
+func (t *resumeToken) explored() map[int]bool {
+	res := map[int]bool{}
+	id := 0
+	for _, d := range t.Explored {
+		id += d
+		res[id] = true
+	}
+	return res
+}
+
+// Returns the names of the frontier functions.
+func (t *resumeToken) symbols() []string {
+	var res []string
+	for _, f := range t.Frontier {
+		if notInStr(res, f.Symbol) {
+			res = append(res, f.Symbol)
+		}
+	}
+	return res
+}
+
+// Encodes the token as gzipped JSON, base64 encoded for the command line.
+func (t *resumeToken) String() string {
+	var b bytes.Buffer
+
+	j, _ := json.Marshal(t)
+	gz := gzip.NewWriter(&b)
+	gz.Write(j)
+	gz.Close()
+	return resumePrefix + base64.RawURLEncoding.EncodeToString(b.Bytes())
+}
+
+// Decodes a token.
+func parseResumeToken(s string) (*resumeToken, error) {
+	var t resumeToken
+
+	if !strings.HasPrefix(s, resumePrefix) {
+		return nil, errors.New("invalid resume token")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, resumePrefix))
+	if err != nil {
+		return nil, errors.New("invalid resume token")
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.New("invalid resume token")
+	}
+	j, err := io.ReadAll(gz)
+	if err != nil || json.Unmarshal(j, &t) != nil || len(t.Frontier) == 0 {
+		return nil, errors.New("invalid resume token")
+	}
+	return &t, nil
+}
+
+// Returns the id of a start symbol: the one given by id if any, the frontier
+// function when resuming, the symbol of the instance otherwise.
+func (conf *configuration) startId(db navdb.Conn, symbol string) (int, error) {
+	if id, ok := conf.startIds[symbol]; ok {
+		return id, nil
+	}
+	if conf.resume == nil {
+		return sym2num(db, symbol, conf.Instance)
+	}
+	for _, f := range conf.resume.Frontier {
+		if f.Symbol == symbol {
+			return f.Id, nil
+		}
+	}
+	return 0, exitError{exitSymbolNotFound, fmt.Errorf("%s is not on the frontier of the resume token", symbol)}
+}
+
+// Returns an empty exploration result, the functions explored before being
+// resumed already seen.
+func (nc *navConf) newResult() navResult {
+	res := newNavResult()
+	for id := range nc.explored {
+		res.seen[id] = true
+	}
+	return res
+}
+
+// Returns the lines reporting the frontier and the token.
+func resumeLines(t *resumeToken) []string {
+	var lines []string
+
+	for _, f := range t.Frontier {
+		lines = append(lines, "frontier: "+f.Symbol)
+	}
+	return append(lines, "resume: "+t.String())
+}
+
+// Appends the resume token to an output, see appendSection.
+func appendResume(out string, t *resumeToken, jout string, w io.Writer) (string, error) {
+	return appendSection(out, "resume", resumeDoc{t.String(), t.symbols()}, resumeLines(t), jout, w)
+}
+
+// Writes the resume token of a streamed exploration.
+func streamResume(enc *json.Encoder, t *resumeToken) error {
+	return enc.Encode(ndjsonResume{"resume", t.String(), t.symbols()})
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdSchema = "schema"
+
+// Version of the JSON outputs structure. It is bumped whenever a field is
+// removed, renamed or changes meaning; adding fields keeps the version.
+const schemaVersion = 1
+
+// JSON graph output, the graph is DOT, optionally gzipped, base64 encoded.
+type graphDoc struct {
+	SchemaVersion int         `json:"schema_version"`
+	Graph         string      `json:"graph"`
+	GraphType     string      `json:"graph_type"`
+	Symbols       []symbolDoc `json:"symbols"`
+	Cycles        [][]string  `json:"cycles,omitempty"`
+	Uncovered     []string    `json:"uncovered,omitempty"`
+	Truncated     []string    `json:"truncated,omitempty"`
+	Resume        *resumeDoc  `json:"resume,omitempty"`
+}
+
+// Subsystems of a function of the JSON graph output.
+type symbolDoc struct {
+	FuncName   string   `json:"FuncName"`
+	Subsystems []string `json:"subsystems"`
+}
+
+// First record of the streamed output.
+type ndjsonHeader struct {
+	Type          string `json:"type"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+// JSON output of the subcommands.
+type resultDoc struct {
+	SchemaVersion int         `json:"schema_version"`
+	Command       string      `json:"command"`
+	Result        interface{} `json:"result"`
+}
+
+// Wraps the result of a subcommand in the versioned JSON document.
+func jsonResult(command string, result interface{}) (string, error) {
+	out, err := json.Marshal(resultDoc{schemaVersion, command, result})
+	return string(out), err
+}
+
+// Returns the JSON Schema of a Go type, as encoding/json marshals it.
+// Fields tagged omitempty are not required.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if !f.IsExported() || tag == "-" || tag == "" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			props[name] = typeSchema(f.Type)
+			if opts != "omitempty" {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": props, "required": required}
+	}
+	return map[string]interface{}{}
+}
+
+// Returns the schema of a subcommand output with the given result type.
+func resultSchema(command string, result map[string]interface{}) map[string]interface{} {
+	s := typeSchema(reflect.TypeOf(resultDoc{}))
+	props := s["properties"].(map[string]interface{})
+	props["schema_version"] = map[string]interface{}{"const": schemaVersion}
+	props["command"] = map[string]interface{}{"const": command}
+	props["result"] = result
+	return s
+}
+
+// Returns the schema of a streamed record, identified by its type.
+func recordSchema(kind string, t reflect.Type) map[string]interface{} {
+	s := typeSchema(t)
+	s["properties"].(map[string]interface{})["type"] = map[string]interface{}{"const": kind}
+	return s
+}
+
+// Returns the JSON Schema document describing all the JSON outputs: the
+// -j jsonOutput* graphs, the -j ndjson records, the subcommands results and
+// the --errors json reports.
+func schemaDocument() (string, error) {
+	of := func(v interface{}) map[string]interface{} { return typeSchema(reflect.TypeOf(v)) }
+
+	graph := of(graphDoc{})
+	graph["properties"].(map[string]interface{})["schema_version"] = map[string]interface{}{"const": schemaVersion}
+	errDoc := of(errorDoc{})
+	errDoc["properties"].(map[string]interface{})["schema_version"] = map[string]interface{}{"const": schemaVersion}
+	header := recordSchema("header", reflect.TypeOf(ndjsonHeader{}))
+	header["properties"].(map[string]interface{})["schema_version"] = map[string]interface{}{"const": schemaVersion}
+
+	defs := map[string]interface{}{
+		"graph":            graph,
+		"error":            errDoc,
+		"ndjson_header":    header,
+		"ndjson_node":      recordSchema("node", reflect.TypeOf(ndjsonNode{})),
+		"ndjson_edge":      recordSchema("edge", reflect.TypeOf(ndjsonEdge{})),
+		"ndjson_cycle":     recordSchema("cycle", reflect.TypeOf(ndjsonCycle{})),
+		"ndjson_uncovered": recordSchema("uncovered", reflect.TypeOf(ndjsonUncovered{})),
+		"ndjson_truncated": recordSchema("truncated", reflect.TypeOf(ndjsonTruncated{})),
+		"ndjson_resume":    recordSchema("resume", reflect.TypeOf(ndjsonResume{})),
+		cmdDiff:            resultSchema(cmdDiff, of(graphDiff{})),
+		cmdCompare:         resultSchema(cmdCompare, of(compareResult{})),
+		cmdInfo:            resultSchema(cmdInfo, of([]symbolInfo{})),
+		cmdTrace:           resultSchema(cmdTrace, of([]traceFrame{})),
+		cmdStats:           resultSchema(cmdStats, of([]symbolStats{})),
+		cmdSearch:          resultSchema(cmdSearch, of([]searchResult{})),
+		cmdMatch:           resultSchema(cmdMatch, of([]string{})),
+		cmdSCC:             resultSchema(cmdSCC, of([][]string{})),
+		cmdSets:            resultSchema(cmdSets, of(setResult{})),
+		cmdModules:         resultSchema(cmdModules, of([]moduleEdge{})),
+		cmdSubsys:          resultSchema(cmdSubsys, of(subsysContents{})),
+		cmdConfig:          resultSchema(cmdConfig, map[string]interface{}{"oneOf": []interface{}{map[string]interface{}{"const": "ok"}, of([]configValue{})}}),
+		cmdPaths:           resultSchema(cmdPaths, map[string]interface{}{"oneOf": []interface{}{of([][]string{}), of([]weightedPath{})}}),
+		cmdDominators:      resultSchema(cmdDominators, map[string]interface{}{"oneOf": []interface{}{of([]domEdge{}), of([]string{})}}),
+	}
+	var names []string
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var refs []interface{}
+	for _, name := range names {
+		refs = append(refs, map[string]interface{}{"$ref": "#/$defs/" + name})
+	}
+	doc := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "nav JSON outputs",
+		"$defs":   defs,
+		"anyOf":   refs,
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	return string(out), err
+}
+
+// Implements the schema command.
+func cmdPrintSchema(_ navdb.Conn, _ *configuration) (string, error) {
+	return schemaDocument()
+}
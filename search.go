@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdSearch = "search"
+
+// Instance defining some of the searched symbols.
+type searchResult struct {
+	Instance map[string]string `json:"instance"`
+	Symbols  []string          `json:"symbols"`
+}
+
+// Returns, for every instance, the symbols matching the configured names or
+// patterns, along with the instance metadata. Instances with no match are
+// omitted.
+func searchInstances(db navdb.Conn, conf *configuration) ([]string, []searchResult, error) {
+	var res []searchResult
+
+	cols, lines, err := getInstances(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, line := range lines {
+		instance, err := strconv.Atoi(line[0])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		c := *conf
+		c.Instance = instance
+		var symbols []string
+		if conf.Match == matchExact {
+			for _, s := range conf.symbolList() {
+				found, err := queryColumn(db, "select distinct symbol_name from symbols where symbol_name=$1 and symbol_instance_id_ref=$2", s, instance)
+				if err != nil {
+					return nil, nil, err
+				}
+				symbols = append(symbols, found...)
+			}
+		} else if symbols, err = matchSymbols(db, &c); err != nil {
+			return nil, nil, err
+		}
+		if len(symbols) == 0 {
+			continue
+		}
+
+		meta := map[string]string{}
+		for i, col := range cols {
+			meta[col] = line[i]
+		}
+		res = append(res, searchResult{meta, symbols})
+	}
+	return cols, res, nil
+}
+
+// Implements the search command.
+func cmdSearchInstances(db navdb.Conn, conf *configuration) (string, error) {
+	cols, res, err := searchInstances(db, conf)
+	if err != nil {
+		return "", err
+	}
+
+	if opt2num(conf.Jout) != graphOnly {
+		if res == nil {
+			res = []searchResult{}
+		}
+		return jsonResult(cmdSearch, res)
+	}
+	lines := []string{strings.Join(append(append([]string{}, cols...), "symbols"), "\t")}
+	for _, r := range res {
+		var line []string
+		for _, col := range cols {
+			line = append(line, r.Instance[col])
+		}
+		line = append(line, strings.Join(r.Symbols, ","))
+		lines = append(lines, strings.Join(line, "\t"))
+	}
+	return strings.Join(lines, "\n"), nil
+}
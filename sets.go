@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdSets = "sets"
+
+// Set operations over the call graphs of several symbols.
+const (
+	setUnion        = "union"
+	setIntersection = "intersection"
+	setDifference   = "difference"
+)
+
+const (
+	fmtDotSetNode       = "\"%s\" [style=filled fillcolor=\"%s\" tooltip=\"%s\"]\n"
+	fmtDotSetNodeShared = "\"%s\" [style=wedged fillcolor=\"%s\" tooltip=\"%s\"]\n"
+)
+
+// Function of a set operation result, with the symbols reaching it.
+type setNode struct {
+	Symbol    string   `json:"symbol"`
+	ReachedBy []string `json:"reached_by"`
+}
+
+// Result of a set operation over call graphs.
+type setResult struct {
+	Op      string     `json:"op"`
+	Symbols []string   `json:"symbols"`
+	Nodes   []setNode  `json:"nodes"`
+	Edges   []callEdge `json:"edges"`
+}
+
+// Returns the tag color of the i-th symbol.
+func setColor(i int) string {
+	c := renderPalette[i%len(renderPalette)]
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Combines the call graphs explored from each symbol. The union keeps every
+// function, the intersection the functions reachable from all the symbols,
+// the difference the functions reachable from the first and from none of the
+// others. Edges are kept when both ends are.
+func combineCallGraphs(op string, symbols []string, graphs []callGraph) setResult {
+	res := setResult{Op: op, Symbols: symbols, Nodes: []setNode{}, Edges: []callEdge{}}
+	keep := map[string]bool{}
+
+	reached := map[string][]string{}
+	for i, g := range graphs {
+		for n := range g.nodes {
+			reached[n] = append(reached[n], symbols[i])
+		}
+	}
+	for n, by := range reached {
+		switch op {
+		case setUnion:
+			keep[n] = true
+		case setIntersection:
+			keep[n] = len(by) == len(graphs)
+		case setDifference:
+			keep[n] = len(by) == 1 && graphs[0].nodes[n]
+		}
+		if keep[n] {
+			res.Nodes = append(res.Nodes, setNode{n, by})
+		}
+	}
+	sort.Slice(res.Nodes, func(i, j int) bool { return res.Nodes[i].Symbol < res.Nodes[j].Symbol })
+
+	edges := map[callEdge]bool{}
+	for _, g := range graphs {
+		for e := range g.edges {
+			if keep[e.Caller] && keep[e.Callee] && !edges[e] {
+				edges[e] = true
+				res.Edges = append(res.Edges, e)
+			}
+		}
+	}
+	sortEdges(res.Edges)
+	return res
+}
+
+// Renders the result as DOT graph, nodes filled with the colors of the
+// symbols reaching them.
+func (r setResult) dot() string {
+	var b strings.Builder
+
+	colors := map[string]string{}
+	for i, s := range r.Symbols {
+		colors[s] = setColor(i)
+	}
+	b.WriteString(fmtDotHeader[graphOnly])
+	for _, e := range r.Edges {
+		fmt.Fprintf(&b, fmtDot[graphOnly], e.Caller, e.Callee)
+	}
+	for _, n := range r.Nodes {
+		var fill []string
+		for _, s := range n.ReachedBy {
+			fill = append(fill, colors[s])
+		}
+		format := fmtDotSetNode
+		if len(fill) > 1 {
+			format = fmtDotSetNodeShared
+		}
+		fmt.Fprintf(&b, format, n.Symbol, strings.Join(fill, ":"), strings.Join(n.ReachedBy, ","))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// Implements the sets command.
+func cmdGraphSets(db navdb.Conn, conf *configuration) (string, error) {
+	op := conf.cmdArgs[0]
+	if op != setUnion && op != setIntersection && op != setDifference {
+		return "", fmt.Errorf("unknown set operation %s", op)
+	}
+	symbols := conf.symbolList()
+	if len(symbols) < 2 {
+		return "", errors.New("sets needs at least two symbols")
+	}
+
+	var graphs []callGraph
+	for _, symbol := range symbols {
+		g, err := exploreCallGraph(db, conf, conf.Instance, []string{symbol})
+		if err != nil {
+			return "", err
+		}
+		graphs = append(graphs, g)
+	}
+
+	res := combineCallGraphs(op, symbols, graphs)
+	if opt2num(conf.Jout) == graphOnly {
+		return res.dot(), nil
+	}
+	return jsonResult(cmdSets, res)
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Max number of lines of the source snippets, longer functions are cut.
+const snippetMaxLines = 60
+
+// Functions definition in the source, DOT node attributes linking it.
+var fmtDotNodeSource = []string{
+	"",
+	"\"%s\" [URL=\"%s\" tooltip=\"%s\"]\n",
+	"\\\"%s\\\" [URL=\\\"%s\\\" tooltip=\\\"%s\\\"] \\\\\\n",
+	"\"%s\" [URL=\"%s\" tooltip=\"%s\"]\n",
+	"\"%s\" [URL=\"%s\" tooltip=\"%s\"]\n",
+}
+
+// Location of a function definition, Line is 0 when not known.
+type sourceLoc struct {
+	File string
+	Line int
+}
+
+func (l sourceLoc) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Kernel sources the functions are looked up in: a local tree, where the
+// definitions lines are found, and the base URL of a web browser of it.
+// Either may be missing.
+type sourceTree struct {
+	db       navdb.Conn
+	instance int
+	root     string
+	base     string
+	files    map[string][]string
+	links    map[string]string
+}
+
+// Returns the sources of the configuration, nil if none is given.
+func newSourceTree(db navdb.Conn, conf *configuration) *sourceTree {
+	if conf.SrcTree == "" && conf.SrcURL == "" {
+		return nil
+	}
+	return &sourceTree{db: db, instance: conf.Instance, root: conf.SrcTree, base: strings.TrimSuffix(conf.SrcURL, "/"), files: map[string][]string{}, links: map[string]string{}}
+}
+
+// Returns the lines of a source file, nil if it can't be read.
+func (s *sourceTree) lines(file string) []string {
+	if lines, ok := s.files[file]; ok {
+		return lines
+	}
+	var lines []string
+	if b, err := os.ReadFile(filepath.Join(s.root, file)); err == nil {
+		lines = strings.Split(string(b), "\n")
+	} else {
+		logger.info("source not readable", "file", file, "error", err)
+	}
+	s.files[file] = lines
+	return lines
+}
+
+// Return types alone on the line before the function name, kernel style.
+var returnTypeLine = regexp.MustCompile(`^[A-Za-z_][^;{}()#]*$`)
+
+// Returns the index of the line where the function is defined, -1 if not
+// found: the first line starting with a declaration of it followed by a
+// body rather than by a semicolon, or the line before with its return type.
+func findDefinition(lines []string, symbol string) int {
+	decl := regexp.MustCompile(`^([A-Za-z_].*\W)?` + regexp.QuoteMeta(symbol) + `\s*\(`)
+
+	for i, l := range lines {
+		if !decl.MatchString(l) {
+			continue
+		}
+		j := i
+		for j < len(lines)-1 && j < i+20 && !strings.ContainsAny(lines[j], "{;") {
+			j++
+		}
+		b, s := strings.Index(lines[j], "{"), strings.Index(lines[j], ";")
+		switch {
+		case b < 0 || s >= 0 && s < b:
+		case i > 0 && returnTypeLine.MatchString(lines[i-1]):
+			return i - 1
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// Locates the definition of a function defined in a file, the line being
+// known only with a local tree.
+func (s *sourceTree) locate(symbol string, file string) sourceLoc {
+	loc := sourceLoc{File: file}
+	if s.root != "" && file != "" {
+		loc.Line = findDefinition(s.lines(file), symbol) + 1
+	}
+	return loc
+}
+
+// Locates the definition of a function, looking up its file.
+func (s *sourceTree) locateSymbol(symbol string) (sourceLoc, error) {
+	files, err := queryColumn(s.db, "select file_name from symbols, files where symbol_file_ref_id=file_id and symbol_name=$1 and symbol_instance_id_ref=$2 order by symbol_id", symbol, s.instance)
+	if err != nil || len(files) == 0 {
+		return sourceLoc{}, err
+	}
+	return s.locate(symbol, files[0]), nil
+}
+
+// Returns the link to a definition: the web browser URL, or the path in the
+// local tree with the line, the form editors and terminals open.
+func (s *sourceTree) link(loc sourceLoc) string {
+	switch {
+	case loc.File == "":
+		return ""
+	case s.base != "" && loc.Line > 0:
+		return fmt.Sprintf("%s/%s#L%d", s.base, loc.File, loc.Line)
+	case s.base != "":
+		return s.base + "/" + loc.File
+	}
+	return sourceLoc{filepath.Join(s.root, loc.File), loc.Line}.String()
+}
+
+// Returns the source of the function defined at the location, up to its
+// closing brace or the max lines; nil if the location is not known.
+func (s *sourceTree) snippet(loc sourceLoc) []string {
+	var res []string
+
+	if s.root == "" || loc.Line == 0 {
+		return nil
+	}
+	lines := s.lines(loc.File)
+	depth, opened := 0, false
+	for i := loc.Line - 1; i < len(lines); i++ {
+		if len(res) == snippetMaxLines {
+			return append(res, "...")
+		}
+		res = append(res, lines[i])
+		depth += strings.Count(lines[i], "{") - strings.Count(lines[i], "}")
+		opened = opened || strings.Contains(lines[i], "{")
+		if opened && depth <= 0 {
+			break
+		}
+	}
+	return res
+}
+
+// Returns the link to the definition of a function, empty if not found.
+func (s *sourceTree) symbolLink(symbol string) string {
+	if link, ok := s.links[symbol]; ok {
+		return link
+	}
+	loc, err := s.locateSymbol(symbol)
+	if err != nil {
+		logger.info("source lookup failed", "symbol", symbol, "error", err)
+	}
+	s.links[symbol] = s.link(loc)
+	return s.links[symbol]
+}
+
+// Sets the source of the functions of a graph, nodes being functions.
+func (s *sourceTree) annotate(g *graph.Graph) {
+	for i, n := range g.Nodes {
+		g.Nodes[i].Source = s.symbolLink(n.Name)
+	}
+}
+
+// Returns the DOT node attributes linking the functions to their source.
+func (s *sourceTree) dotNodes(names []string, flavour int) string {
+	var res string
+
+	for _, name := range names {
+		if link := s.symbolLink(name); link != "" {
+			res += fmt.Sprintf(fmtDotNodeSource[flavour], name, link, link)
+		}
+	}
+	return res
+}
+
+// Fills the source location of the symbol metadata, with the snippet if
+// asked to.
+func (s *sourceTree) describe(info *symbolInfo, snippet bool) {
+	loc := s.locate(info.Name, info.File)
+	info.Source = s.link(loc)
+	if snippet {
+		info.Snippet = s.snippet(loc)
+	}
+}
@@ -0,0 +1,1386 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Minimal extractor schema and a small call graph used by the tests.
+// Instance 1: start -> a -> c, start -> b -> c, c -> d.
+// Instance 2: start -> a -> c -> e.
+var sqliteFixture = []string{
+	"create table instances (instance_id integer primary key, version_string text, note text)",
+	"insert into instances values (1, '6.1.0', 'x86_64 defconfig'), (2, '6.2.0', 'arm64 defconfig')",
+	"create table files (file_id integer primary key, file_name text)",
+	"create table tags (tag_file_ref_id integer, subsys_name text)",
+	"create table symbols (symbol_id integer primary key, symbol_name text, symbol_address text, symbol_type text, symbol_file_ref_id integer, symbol_instance_id_ref integer)",
+	"create table xrefs (caller integer, callee integer, source_line text, ref_addr text, xref_instance_id_ref integer)",
+	"insert into files values (1, 'kernel/start.c'), (2, 'mm/alloc.c')",
+	"insert into tags values (1, 'CORE'), (2, 'MM')",
+	"insert into symbols values (1, 'start', '0x1000', 'direct', 1, 1), (2, 'a', '0x2000', 'direct', 1, 1), (3, 'b', '0x3000', 'direct', 2, 1), (4, 'c', '0x4000', 'direct', 2, 1), (5, 'd', '0x5000', 'direct', 1, 1)",
+	"insert into symbols values (6, 'start', '0x1000', 'direct', 1, 2), (7, 'a', '0x2000', 'direct', 1, 2), (8, 'c', '0x4000', 'direct', 2, 2), (9, 'e', '0x6000', 'direct', 2, 2)",
+	"insert into xrefs values (1, 2, 'start.c:10', '0x1010', 1), (1, 3, 'start.c:11', '0x1020', 1), (2, 4, 'start.c:20', '0x2010', 1), (3, 4, 'alloc.c:30', '0x3010', 1), (4, 5, 'alloc.c:40', '0x4010', 1)",
+	"insert into xrefs values (6, 7, 'start.c:10', '0x1010', 2), (7, 8, 'start.c:20', '0x2010', 2), (8, 9, 'alloc.c:41', '0x4010', 2)",
+}
+
+// Creates the fixture database file and returns its path.
+func sqliteFixtureDB(t *testing.T) string {
+	t.Helper()
+
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, q := range sqliteFixture {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(q, err)
+		}
+	}
+	return fn
+}
+
+// Adds to instance 1 the recursions c -> c and a -> c -> d -> a.
+var cyclesFixture = "insert into xrefs values (4, 4, 'alloc.c:42', '0x4020', 1), (5, 2, 'start.c:50', '0x5010', 1)"
+
+// Opens the fixture through the application sqlite backend, after running
+// the extra statements.
+func sqliteFixtureConn(t *testing.T, extra ...string) navdb.Conn {
+	t.Helper()
+
+	fn := sqliteFixtureDB(t)
+	if len(extra) > 0 {
+		raw, err := sql.Open("sqlite3", fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range extra {
+			if _, err := raw.Exec(q); err != nil {
+				t.Fatal(q, err)
+			}
+		}
+		raw.Close()
+	}
+	db, err := navdb.Connect(&navdb.Token{DBName: fn, Backend: navdb.Sqlite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Returns the configuration the tests explore the instance 1 of the fixture
+// with, from the given symbol if any.
+func fixtureConfig(symbol string) configuration {
+	conf := defaultConfig
+	conf.Symbol = symbol
+	conf.Instance = 1
+	conf.Mode = printAll
+	conf.Quiet = true
+	return conf
+}
+
+// Generates the output of the exploration, as the commands do theirs.
+func generate(db navdb.Conn, conf *configuration) (string, error) {
+	return generateOutput(context.Background(), db, conf)
+}
+
+// Case of a table driven test: the changes to the base configuration, the
+// command run, the output exploration if none, and what it must give. The
+// output must be want unless it is checked by substrings or a function.
+type cmdCase struct {
+	name     string
+	setup    func(conf *configuration)
+	run      func(db navdb.Conn, conf *configuration) (string, error)
+	want     string
+	contains []string
+	excludes []string
+	check    func(out string) bool
+	fails    bool
+}
+
+// Runs every case as a subtest on its own copy of the base configuration.
+func runCmdCases(t *testing.T, db navdb.Conn, base configuration, cases []cmdCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			conf := base
+			if tc.setup != nil {
+				tc.setup(&conf)
+			}
+			run := tc.run
+			if run == nil {
+				run = generate
+			}
+			out, err := run(db, &conf)
+			if tc.fails {
+				if err == nil {
+					t.Error("Expected error, got output", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("Unexpected error", err)
+			}
+			if tc.contains == nil && tc.excludes == nil && tc.check == nil && out != tc.want {
+				t.Errorf("Unexpected output %q", out)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(out, s) {
+					t.Errorf("Missing %q in %s", s, out)
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(out, s) {
+					t.Errorf("Unexpected %q in %s", s, out)
+				}
+			}
+			if tc.check != nil && !tc.check(out) {
+				t.Errorf("Unexpected output %q", out)
+			}
+		})
+	}
+}
+
+// Tests a full exploration on sqlite.
+func TestSqlite(t *testing.T) {
+
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig("start"), []cmdCase{
+		{name: "single", contains: []string{"\"start\"->\"a\"", "\"start\"->\"b\"", "\"a\"->\"c\"", "\"c\"->\"d\""}},
+		{name: "batch", setup: func(c *configuration) { c.cliSymbols = []string{"a", "b"} }, excludes: []string{"\"start\""},
+			check: func(out string) bool { return strings.Count(out, "\"c\"->\"d\"") == 1 }},
+	})
+}
+
+// Tests regex and glob symbol matching.
+func TestMatchSymbols(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("")
+
+	conf.Match = matchRegex
+	conf.cliSymbols = []string{"^[ab]$", "st"}
+	res, err := matchSymbols(db, &conf)
+	if err != nil || strings.Join(res, ",") != "a,b,start" {
+		t.Error("Unexpected regex matches", res, err)
+	}
+
+	conf.Match = matchGlob
+	conf.cliSymbols = []string{"s*"}
+	res, err = matchSymbols(db, &conf)
+	if err != nil || strings.Join(res, ",") != "start" {
+		t.Error("Unexpected glob matches", res, err)
+	}
+
+	if out, err := matchListing(&conf, res); err != nil || out != "start\n" {
+		t.Error("Unexpected matches listing", out, err)
+	}
+	conf.Jout = "jsonOutputPlain"
+	if out, err := matchListing(&conf, nil); err != nil || out != `{"schema_version":1,"command":"match","result":[]}`+"\n" {
+		t.Error("Unexpected JSON matches listing", out, err)
+	}
+
+	conf.Match = matchRegex
+	conf.cliSymbols = []string{"("}
+	if _, err = conf.symbolPatterns(); err == nil {
+		t.Error("Invalid regex not detected")
+	}
+}
+
+// Tests the instances listing.
+func TestInstances(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	out, err := cmdListInstances(db, &configuration{})
+	if err != nil {
+		t.Fatal("Unexpected error listing instances", err)
+	}
+	if out != "instance_id\tversion_string\tnote\n1\t6.1.0\tx86_64 defconfig\n2\t6.2.0\tarm64 defconfig" {
+		t.Error("Unexpected instances output", out)
+	}
+}
+
+// Tests the call graph comparison between instances.
+func TestInstanceDiff(t *testing.T) {
+
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig("start"), []cmdCase{
+		{name: "1-2", setup: func(c *configuration) { c.cmdArgs = []string{"1", "2"} }, run: cmdInstanceDiff,
+			want: "--- instance 1\n+++ instance 2\n- node b\n- node d\n+ node e\n- edge b -> c\n- edge c -> d\n- edge start -> b\n+ edge c -> e"},
+	})
+}
+
+// Tests the symbol search across instances.
+func TestSearch(t *testing.T) {
+
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig(""), []cmdCase{
+		{name: "names", setup: func(c *configuration) { c.cliSymbols = []string{"e", "b"} }, run: cmdSearchInstances,
+			want: "instance_id\tversion_string\tnote\tsymbols\n1\t6.1.0\tx86_64 defconfig\tb\n2\t6.2.0\tarm64 defconfig\te"},
+		{name: "regex", setup: func(c *configuration) {
+			c.cliSymbols = []string{"^[a-c]$"}
+			c.Match = matchRegex
+			c.Jout = "jsonOutputPlain"
+		}, run: cmdSearchInstances,
+			want: `{"schema_version":1,"command":"search","result":[{"instance":{"instance_id":"1","note":"x86_64 defconfig","version_string":"6.1.0"},"symbols":["a","b","c"]},` +
+				`{"instance":{"instance_id":"2","note":"arm64 defconfig","version_string":"6.2.0"},"symbols":["a","c"]}]}`},
+	})
+}
+
+// Tests the symbol metadata report.
+func TestSymbolInfo(t *testing.T) {
+
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig(""), []cmdCase{
+		{name: "c", setup: func(c *configuration) { c.cmdArgs = []string{"c"} }, run: cmdSymbolInfo,
+			want: "symbol: c\ninstance: 1\nsymbol_id: 4\nsymbol_address: 0x4000\nsymbol_type: direct\nsymbol_file_ref_id: 2\n" +
+				"file: mm/alloc.c\nsubsystems: MM\ncallers: 2\ncallees: 1\ninstances: 1 2"},
+		{name: "missing", setup: func(c *configuration) { c.cmdArgs = []string{"missing"} }, run: cmdSymbolInfo, fails: true},
+	})
+}
+
+// Tests the address lookup.
+func TestAddr(t *testing.T) {
+
+	os.Args = []string{"nav", "-i", "1", "--addr", "0x4010"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing address", err)
+	}
+
+	db := sqliteFixtureConn(t, "insert into symbols values (10, 'x', null, 'direct', 1, 1), (11, 'y', '0x00002800', 'direct', 1, 1), (12, 'z', 'none', 'direct', 1, 1)")
+	if err = resolveAddr(db, &conf); err != nil || conf.Symbol != "c" || strings.Join(conf.symbolList(), ",") != "c" {
+		t.Error("Unexpected address resolution", conf.symbolList(), err)
+	}
+	for addr, symbol := range map[uint64]string{0x1000: "start", 0x27ff: "a", 0x2fff: "y", 0xffffffff: "d"} {
+		if res, err := symbolByAddr(db, addr, 1); err != nil || res != symbol {
+			t.Error("Unexpected symbol for address", addr, res, err)
+		}
+	}
+	if _, err = symbolByAddr(db, 0x10, 1); err == nil {
+		t.Error("Address before any symbol not detected")
+	}
+
+	os.Args = []string{"nav", "-i", "1", "--addr", "rip"}
+	if _, err = argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Invalid address not detected")
+	}
+}
+
+// Tests the stack trace annotation.
+func TestTrace(t *testing.T) {
+
+	trace := "WARNING: CPU: 0 PID: 1 at mm/alloc.c:40 d+0x4/0x10\n" +
+		"RIP: 0010:d+0x4/0x10\n" +
+		"Call Trace:\n" +
+		" <TASK>\n" +
+		" c.isra.0+0x10/0x40 [mod]\n" +
+		" ? b+0x8/0x20\n" +
+		" start+0x20/0x80\n" +
+		" missing+0x1/0x2\n" +
+		" </TASK>\n"
+	dir := t.TempDir()
+	for fn, data := range map[string]string{"oops.txt": trace, "empty.txt": "no frames here\n"} {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig(""), []cmdCase{
+		{name: "oops", setup: func(c *configuration) { c.cmdArgs = []string{filepath.Join(dir, "oops.txt")} }, run: cmdTraceAnnotate,
+			want: "#0 d+0x4/0x10\tkernel/start.c\tCORE\tdirect call from c.isra.0\n" +
+				"#1 c.isra.0+0x10/0x40\tmm/alloc.c\tMM\tdirect call from b\n" +
+				"#2 ? b+0x8/0x20\tmm/alloc.c\tMM\tdirect call from start\n" +
+				"#3 start+0x20/0x80\tkernel/start.c\tCORE\tno direct call from missing\n" +
+				"#4 missing+0x1/0x2\tnot found"},
+		{name: "no frames", setup: func(c *configuration) { c.cmdArgs = []string{filepath.Join(dir, "empty.txt")} }, run: cmdTraceAnnotate, fails: true},
+	})
+}
+
+// Tests the recursion reporting on a graph with a self call and a longer cycle.
+func TestCycles(t *testing.T) {
+
+	suffix := func(s string) func(string) bool {
+		return func(out string) bool { return strings.HasSuffix(out, s) }
+	}
+	conf := fixtureConfig("start")
+	conf.ReportCycles = true
+	runCmdCases(t, sqliteFixtureConn(t, cyclesFixture), conf, []cmdCase{
+		{name: "dot", check: suffix("}\n// cycle: c -> c\n// cycle: a -> c -> d -> a")},
+		{name: "json", setup: func(c *configuration) { c.Jout = "jsonOutputPlain" }, check: suffix(",\"cycles\": [[\"c\",\"c\"],[\"a\",\"c\",\"d\",\"a\"]]}")},
+		{name: "mermaid", setup: func(c *configuration) {
+			c.Symbol = "b"
+			c.Jout = "mermaid"
+		}, check: suffix("\n%% cycle: c -> c\n%% cycle: a -> c -> d -> a")},
+	})
+}
+
+// Tests the graph statistics of symbols and subsystems.
+func TestStats(t *testing.T) {
+
+	conf := fixtureConfig("")
+	conf.cliSymbols = []string{"start", "c"}
+	runCmdCases(t, sqliteFixtureConn(t), conf, []cmdCase{
+		{name: "symbols", run: cmdSymbolStats, want: "symbol\tfan_in\tfan_out\treachable\tmax_depth\tsubsystems\nstart\t0\t2\t4\t3\t2\nc\t2\t1\t1\t1\t2"},
+		{name: "subsystem", setup: func(c *configuration) {
+			c.cmdArgs = []string{"MM"}
+			c.Top = 1
+			c.Jout = "jsonOutputPlain"
+		}, run: cmdSymbolStats, want: `{"schema_version":1,"command":"stats","result":[{"symbol":"b","fan_in":1,"fan_out":1,"reachable":2,"max_depth":2,"subsystems":2}]}`},
+		{name: "empty subsystem", setup: func(c *configuration) { c.cmdArgs = []string{"NONE"} }, run: cmdSymbolStats, fails: true},
+	})
+
+	db := sqliteFixtureConn(t, "insert into symbols values (10, 'c', '0x7000', 'direct', 2, 1)")
+	runCmdCases(t, db, conf, []cmdCase{
+		{name: "same named statics", setup: func(c *configuration) { c.cmdArgs = []string{"MM"} }, run: cmdSymbolStats,
+			want: "symbol\tfan_in\tfan_out\treachable\tmax_depth\tsubsystems\nb\t1\t1\t2\t2\t2\nc\t2\t1\t1\t1\t2\nc\t0\t0\t0\t0\t1"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conf.cliSymbols = []string{"start"}
+	if g, err := exploreGraph(navdb.WithContext(ctx, db), &conf, conf.symbolList()); err == nil && len(g.Nodes) > 1 {
+		t.Error("Cancelled context ignored", g.Nodes)
+	}
+}
+
+// Tests the strongly connected components and dominators analysis.
+func TestAnalysis(t *testing.T) {
+
+	sink := func(s string) func(*configuration) {
+		return func(c *configuration) { c.cmdArgs = []string{s} }
+	}
+	conf := fixtureConfig("start")
+	runCmdCases(t, sqliteFixtureConn(t), conf, []cmdCase{
+		{name: "dominator tree", run: cmdDominatorTree, want: "node\tidom\na\tstart\nb\tstart\nc\tstart\nd\tc"},
+		{name: "dominators of the sink", setup: sink("d"), run: cmdDominatorTree, want: "start -> c -> d"},
+		{name: "unreachable sink", setup: sink("e"), run: cmdDominatorTree, fails: true},
+		{name: "acyclic components", run: cmdSCCs, want: ""},
+	})
+	runCmdCases(t, sqliteFixtureConn(t, cyclesFixture), conf, []cmdCase{
+		{name: "components", run: cmdSCCs, want: "scc 1: a c d"},
+		{name: "cyclic dominators", setup: sink("d"), run: cmdDominatorTree, want: "start -> c -> d"},
+	})
+}
+
+// Tests the exploration of the indirect calls.
+func TestIndirect(t *testing.T) {
+
+	db := sqliteFixtureConn(t,
+		"create table indirect_xrefs (caller integer, callee integer, source_line text, ref_addr text, confidence real, xref_instance_id_ref integer)",
+		"insert into indirect_xrefs values (5, 3, 'start.c:60', '0x5020', 0.75, 1)")
+	follow := func(c *configuration) { c.FollowIndirect = true }
+	runCmdCases(t, db, fixtureConfig("c"), []cmdCase{
+		{name: "without switch", excludes: []string{"\"b\""}},
+		{name: "followed", setup: follow, contains: []string{"\"d\"->\"b\" [style=dashed label=\"0.75\"]", "\"b\"->\"c\" \n"}},
+		{name: "mermaid", setup: func(c *configuration) {
+			c.FollowIndirect = true
+			c.Jout = "mermaid"
+		}, contains: []string{"n1 -.-> n2"}},
+	})
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig("c"), []cmdCase{
+		{name: "missing data", setup: follow, fails: true},
+	})
+}
+
+// Tests the ftrace and perf captures parsing and the runtime overlay output.
+func TestOverlay(t *testing.T) {
+
+	ftrace := "# tracer: function_graph\n#\n# CPU  DURATION                  FUNCTION CALLS\n# |     |   |                     |   |   |   |\n" +
+		" 0)               |  start() {\n" +
+		" 0)               |    a() {\n" +
+		" 0)   1.500 us    |      c();\n" +
+		" 0)   3.000 us    |    }\n" +
+		" 0)   0.500 us    |    a();\n" +
+		" 0) + 10.000 us   |  }\n"
+	perf := "swapper     0 [000]   100.000001:     250000 cpu-clock: \n" +
+		"\tffffffff81001000 c+0x10 ([kernel.kallsyms])\n" +
+		"\tffffffff81002000 a+0x20 ([kernel.kallsyms])\n\n" +
+		"swapper     0 [000]   100.000002:     250000 cpu-clock: \n" +
+		"\tffffffff81001000 c.isra.0+0x10 ([kernel.kallsyms])\n" +
+		"\tffffffff81003000 b+0x20 ([kernel.kallsyms])\n"
+	dir := t.TempDir()
+	for fn, data := range map[string]string{"ftrace.txt": ftrace, "perf.txt": perf, "empty.txt": "nothing\n"} {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o, err := loadOverlay(filepath.Join(dir, "ftrace.txt"))
+	if err != nil {
+		t.Fatal("Unexpected error loading ftrace capture", err)
+	}
+	if len(o.funcs) != 3 || o.stats("a").String() != "2 hits 3.5µs" || o.stats("start").String() != "1 hits 10µs" || o.maxHits != 2 {
+		t.Error("Unexpected ftrace figures", o.stats("a"), o.stats("start"), o.maxHits)
+	}
+	o, err = loadOverlay(filepath.Join(dir, "perf.txt"))
+	if err != nil || len(o.funcs) != 3 || o.stats("c").String() != "2 hits" || o.stats("b").String() != "1 hits" {
+		t.Error("Unexpected perf figures", o, err)
+	}
+	if _, err = loadOverlay(filepath.Join(dir, "empty.txt")); err == nil {
+		t.Error("Capture without functions not detected")
+	}
+	o = parseFtraceGraph([]byte(" 0)   3.000 us    |    } /* a */\n"))
+	if len(o.funcs) != 1 || o.maxHits != 0 || o.heat("a") != (color.RGBA{0xff, 0xff, 0, 0xff}) {
+		t.Error("Unexpected figures of a capture starting mid call", o.funcs, o.maxHits)
+	}
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.Overlay = filepath.Join(dir, "ftrace.txt")
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error exploring with overlay", err)
+	}
+	for _, s := range []string{"\"start\"->\"a\" [color=red penwidth=2]", "\"a\"->\"c\" [color=red penwidth=2]", "\"c\"->\"d\" \n",
+		"\"a\" [style=filled fillcolor=\"#ff0000\" xlabel=\"2 hits 3.5µs\"]", "\"c\" [style=filled fillcolor=\"#ff8000\" xlabel=\"1 hits 1.5µs\"]"} {
+		if !strings.Contains(out, s) {
+			t.Error("Missing", s, "in overlay output", out)
+		}
+	}
+	if strings.Contains(out, "\"d\" [style") {
+		t.Error("Function not seen at runtime colored", out)
+	}
+}
+
+// Tests the nodes and edges budgets.
+func TestBudget(t *testing.T) {
+	var b bytes.Buffer
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	for _, budget := range [][2]int{{0, 2}, {3, 0}} {
+		conf.MaxNodes, conf.MaxEdges = budget[0], budget[1]
+		e, err := explore(context.Background(), db, &conf, newCache(), conf.symbolList(), nil)
+		if err != nil {
+			t.Fatal("Unexpected error exploring with budget", err)
+		}
+		if len(e.res.calls) != 2 || strings.Join(e.res.truncated, ",") != "c,start" {
+			t.Error("Unexpected truncated exploration", budget, e.res.calls, e.res.truncated)
+		}
+	}
+
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil || !strings.Contains(out, "\"c\" [color=orange penwidth=2 xlabel=\"truncated\"]") || strings.Contains(out, "\"c\"->\"d\"") ||
+		!strings.HasSuffix(out, "// truncated: c\n// truncated: start") {
+		t.Error("Unexpected truncated output", out, err)
+	}
+	conf.Jout = "jsonOutputPlain"
+	out, err = generateOutput(context.Background(), db, &conf)
+	if err != nil || !strings.HasSuffix(out, `,"truncated": ["c","start"]}`) {
+		t.Error("Unexpected truncated JSON output", out, err)
+	}
+	if err = streamOutput(context.Background(), db, &conf, &b); err != nil || !strings.Contains(b.String(), `{"type":"truncated","name":"start"}`) {
+		t.Error("Unexpected truncated stream", b.String(), err)
+	}
+}
+
+// Tests the traversal strategies, with and without budget.
+func TestStrategy(t *testing.T) {
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	calls := func(e *exploration) string {
+		var res []string
+		for _, c := range e.res.calls {
+			res = append(res, c.l.symbol+"->"+c.r.symbol)
+		}
+		return strings.Join(res, " ")
+	}
+
+	for _, tc := range []struct {
+		strategy  string
+		maxEdges  int
+		calls     string
+		truncated string
+	}{
+		{strategyDFS, 0, "start->a a->c c->d start->b b->c", ""},
+		{strategyBFS, 0, "start->a start->b a->c b->c c->d", ""},
+		{strategyIDDFS, 0, "start->a a->c c->d start->b b->c", ""},
+		{strategyDFS, 2, "start->a a->c", "c,start"},
+		{strategyBFS, 2, "start->a start->b", "a,b"},
+		{strategyIDDFS, 4, "start->a a->c start->b b->c", "c"},
+	} {
+		conf.Strategy, conf.MaxEdges = tc.strategy, tc.maxEdges
+		e, err := explore(context.Background(), db, &conf, newCache(), conf.symbolList(), nil)
+		if err != nil {
+			t.Fatal("Unexpected error exploring", tc.strategy, err)
+		}
+		if calls(e) != tc.calls || strings.Join(e.res.truncated, ",") != tc.truncated {
+			t.Error("Unexpected", tc.strategy, "exploration with budget", tc.maxEdges, calls(e), e.res.truncated)
+		}
+	}
+
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--strategy", "random"}
+	if _, err := argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Unsupported strategy not detected")
+	}
+	os.Args = []string{"nav", "-i", "1", "-s", "a", "--strategy", "iddfs", "-j", "ndjson"}
+	if _, err := argsParse(cmdLineItemInit()); err == nil {
+		t.Error("Streamed iddfs not detected")
+	}
+}
+
+// Tests the output formatted by a user template.
+func TestTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := "{{range .Nodes}}{{.Symbol}} {{.Subsystem}} {{.Depth}} [{{join .Children \",\"}}]\n{{end}}" +
+		"{{range .Edges}}{{.Caller}}->{{.Callee}} {{.Kind}}\n{{end}}"
+	for fn, data := range map[string]string{"ok.tmpl": tmpl, "bad.tmpl": "{{range .Nodes}}", "field.tmpl": "{{.Missing}}"} {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.Template = filepath.Join(dir, "ok.tmpl")
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error formatting with template", err)
+	}
+	for _, s := range []string{"start CORE 0 [a,b]\n", "c MM 2 [d]\n", "d CORE 3 []\n", "start->a direct\n", "c->d direct"} {
+		if !strings.Contains(out, s) {
+			t.Error("Missing", s, "in template output", out)
+		}
+	}
+	for _, fn := range []string{"bad.tmpl", "field.tmpl", "missing.tmpl"} {
+		conf.Template = filepath.Join(dir, fn)
+		if _, err := generateOutput(context.Background(), db, &conf); err == nil {
+			t.Error("Invalid template not detected", fn)
+		}
+	}
+}
+
+// Tests the lcov report parsing and the coverage marking.
+func TestCoverage(t *testing.T) {
+
+	lcov := "TN:\nSF:kernel/start.c\nFN:10,start\nFN:20,a\nFN:40,d\nFNDA:1,start\nFNDA:1,a\nFNDA:0,d\n" +
+		"DA:10,1\nDA:11,1\nDA:20,1\nDA:21,0\nDA:40,0\nend_of_record\n" +
+		"SF:mm/alloc.c\nFN:30,35,b\nFN:40,c\nFNDA:0,b\nFNDA:3,c\nDA:30,0\nDA:41,3\nend_of_record\n"
+	fn := filepath.Join(t.TempDir(), "test.info")
+	if err := os.WriteFile(fn, []byte(lcov), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadCoverage(fn)
+	if err != nil {
+		t.Fatal("Unexpected error loading coverage", err)
+	}
+	for name, percent := range map[string]int{"start": 100, "a": 50, "b": 0, "c": 100, "d": 0} {
+		if c[name] == nil || c[name].percent() != percent {
+			t.Error("Unexpected coverage of", name, c[name])
+		}
+	}
+	if _, err = parseLcov(strings.NewReader("TN:\n")); err == nil {
+		t.Error("Report without functions not detected")
+	}
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.Coverage = fn
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error exploring with coverage", err)
+	}
+	if !strings.Contains(out, "\"a\" [style=filled fillcolor=\"#b2df8a\" xlabel=\"50%\"]") ||
+		!strings.Contains(out, "\"b\" [style=filled fillcolor=\"#fb9a99\" xlabel=\"0%\"]") ||
+		!strings.HasSuffix(out, "}\n// uncovered: 2 of 5 functions\n// uncovered: b\n// uncovered: d") {
+		t.Error("Unexpected coverage output", out)
+	}
+
+	conf.Jout = "jsonOutputPlain"
+	out, err = generateOutput(context.Background(), db, &conf)
+	if err != nil || !strings.HasSuffix(out, ",\"uncovered\": [\"b\",\"d\"]}") {
+		t.Error("Unexpected coverage in JSON output", out, err)
+	}
+}
+
+// Tests the kernel configuration filters.
+func TestKconfig(t *testing.T) {
+
+	os.Args = []string{"nav", "-i", "1", "-s", "start", "-m", "1", "--config", "CONFIG_MM=y", "--config", "CONFIG_MM=n", "--config", "CONFIG_CORE=on"}
+	conf, err := argsParse(cmdLineItemInit())
+	if err != nil {
+		t.Fatal("Unexpected error parsing config filters", err)
+	}
+	if len(conf.Kconfig) != 2 || conf.Kconfig["CONFIG_MM"] != kconfigOff || conf.Kconfig["CONFIG_CORE"] != kconfigOn {
+		t.Error("Unexpected config filters", conf.Kconfig)
+	}
+	for _, opt := range []string{"CONFIG_MM", "MM=on", "CONFIG_MM=m"} {
+		os.Args = []string{"nav", "-i", "1", "-s", "start", "--config", opt}
+		if _, err = argsParse(cmdLineItemInit()); err == nil {
+			t.Error("Invalid config filter not detected", opt)
+		}
+	}
+
+	conf.Quiet = true
+	if _, err = generateOutput(context.Background(), sqliteFixtureConn(t), &conf); err == nil {
+		t.Error("Missing configuration data not detected")
+	}
+	db := sqliteFixtureConn(t, "create table configs (config_file_ref_id integer, config_name text)", "insert into configs values (2, 'CONFIG_MM')")
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error exploring with config filters", err)
+	}
+	if !strings.Contains(out, "\"start\"->\"a\"") || strings.Contains(out, "\"b\"") || strings.Contains(out, "\"c\"") {
+		t.Error("Compiled out functions in output", out)
+	}
+}
+
+// Tests the aggregated subsystems mode.
+func TestSubsysAggr(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.Mode = printSubsysAggr
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	expected := "digraph G {\n\"CORE\"->\"MM\" [label=\"2\" weight=2]\n\"MM\"->\"CORE\" [label=\"1\" weight=1]\n}"
+	if out != expected {
+		t.Error("Unexpected aggregated output", out)
+	}
+}
+
+// Tests exclusion and inclusion filters during the exploration.
+func TestFiltersExplore(t *testing.T) {
+
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig("start"), []cmdCase{
+		{name: "excluded after", setup: func(c *configuration) { c.ExcludedAfter = []string{"^c$"} },
+			contains: []string{"\"a\"->\"c\""}, excludes: []string{"\"c\"->\"d\""}},
+		{name: "included only", setup: func(c *configuration) { c.IncludeOnly = []string{"MM"} },
+			want: "digraph G {\n\"start\"->\"b\" \n\"b\"->\"c\" \n}"},
+	})
+}
+
+// Tests the mermaid output.
+func TestMermaid(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.Jout = "mermaid"
+	conf.MaxDepth = 1
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	expected := `flowchart LR
+    subgraph s0 ["CORE"]
+        n0["start"]
+        n1["a"]
+    end
+    subgraph s1 ["MM"]
+        n2["c"]
+        n3["b"]
+    end
+    n0 --> n1
+    n1 --> n2
+    n0 --> n3
+    n3 --> n2`
+	if out != expected {
+		t.Error("Unexpected mermaid output", out)
+	}
+}
+
+// Tests the graph layout and the image rendering.
+func TestRender(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("")
+	e, err := explore(context.Background(), db, &conf, newCache(), []string{"start"}, nil)
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	g := newOutGraph(e, conf.Mode)
+	depth := map[string]int{}
+	for _, n := range g.Nodes {
+		depth[n.Name] = n.Depth
+	}
+	if depth["start"] != 0 || depth["a"] != 1 || depth["b"] != 1 || depth["c"] != 2 || depth["d"] != 3 || len(g.Edges) != 5 {
+		t.Error("Unexpected graph", g.Nodes, g.Edges)
+	}
+
+	conf.OutFile = filepath.Join(t.TempDir(), "graph.svg")
+	svg, err := render(e, &conf)
+	if err != nil || !strings.Contains(string(svg), ">start</text>") || strings.Count(string(svg), "<line ") != 5 {
+		t.Error("Unexpected svg output", string(svg), err)
+	}
+	conf.OutFile = filepath.Join(t.TempDir(), "graph.png")
+	img, err := render(e, &conf)
+	if err != nil || !strings.HasPrefix(string(img), "\x89PNG") {
+		t.Error("Unexpected png output", err)
+	}
+}
+
+// Tests GraphML and edge list exports.
+func TestExport(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.Jout = "csv"
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	expected := "caller,callee,caller_subsystem,callee_subsystem,depth\n" +
+		"start,a,CORE,CORE,1\na,c,CORE,MM,2\nc,d,MM,CORE,3\nstart,b,CORE,MM,1\nb,c,MM,MM,2"
+	if out != expected {
+		t.Error("Unexpected csv output", out)
+	}
+
+	conf.Jout = "graphml"
+	out, err = generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	if strings.Count(out, "<node ") != 5 || strings.Count(out, "<edge ") != 5 || !strings.Contains(out, "source=\"n0\" target=\"n1\"") {
+		t.Error("Unexpected graphml output", out)
+	}
+
+	conf.Jout = "cypher"
+	out, err = generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	lines := strings.Split(out, "\n")
+	if len(lines) != 11 || lines[1] != `MERGE (n:Function {name: "start", instance: 1}) ON CREATE SET n.depth = 0 SET n.subsystem = "CORE";` ||
+		lines[6] != `MATCH (a:Function {name: "start", instance: 1}), (b:Function {name: "a", instance: 1}) `+
+			`MERGE (a)-[r:CALLS]->(b) SET r.kind = "direct", r.confidence = 1, r.source_ref = "start.c:10", r.address_ref = "0x1010";` {
+		t.Error("Unexpected cypher output", out)
+	}
+
+	conf.Jout = "plantuml"
+	conf.Diagram = "activity"
+	out, err = generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	if !strings.HasPrefix(out, "@startuml\n|CORE|\nstart\n:start;\nsplit\n") || !strings.Contains(out, ":c (expanded above);") {
+		t.Error("Unexpected plantuml output", out)
+	}
+}
+
+// Tests the NDJSON streaming output.
+func TestStreamOutput(t *testing.T) {
+	var b bytes.Buffer
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	if err := streamOutput(context.Background(), db, &conf, &b); err != nil {
+		t.Fatal("Unexpected error while streaming", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 11 || strings.Count(b.String(), "\"type\":\"node\"") != 5 {
+		t.Error("Unexpected stream", b.String())
+	}
+	if lines[0] != `{"type":"header","schema_version":1}` || lines[1] != `{"type":"node","name":"start","subsystem":"CORE"}` ||
+		lines[3] != `{"type":"edge","caller":"start","callee":"a","caller_subsystem":"CORE","callee_subsystem":"CORE","source_ref":"start.c:10","address_ref":"0x1010","depth":1,"kind":"direct","confidence":1}` {
+		t.Error("Unexpected stream records", lines[0], lines[1], lines[3])
+	}
+}
+
+// Tests the on disk results cache.
+func TestCachedOutput(t *testing.T) {
+
+	calls := 0
+	generate := func() (string, error) {
+		calls++
+		return "out", nil
+	}
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.CacheDir = t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		if out, err := cachedOutput(context.Background(), db, &conf, generate); err != nil || out != "out" {
+			t.Error("Unexpected cached output", out, err)
+		}
+	}
+	if calls != 1 {
+		t.Error("Cached result not used", calls)
+	}
+	if files, _ := os.ReadDir(conf.CacheDir); len(files) != 1 || filepath.Ext(files[0].Name()) != ".json" {
+		t.Error("Unexpected cache files", files)
+	}
+
+	conf.MaxDepth = 3
+	cachedOutput(context.Background(), db, &conf, generate)
+	conf.NoCache = true
+	cachedOutput(context.Background(), db, &conf, generate)
+	if calls != 3 {
+		t.Error("Cache not bypassed", calls)
+	}
+}
+
+// Tests the parallel exploration produces the same output as the serial one.
+func TestParallel(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	for _, mode := range []outMode{printAll, printSubsys, printSubsysWs} {
+		conf := fixtureConfig("start")
+		conf.Mode = mode
+		serial, err := generateOutput(context.Background(), db, &conf)
+		if err != nil {
+			t.Fatal("Unexpected error while exploring", err)
+		}
+		conf.Parallel = 4
+		parallel, err := generateOutput(context.Background(), db, &conf)
+		if err != nil {
+			t.Fatal("Unexpected error while exploring in parallel", err)
+		}
+		if serial != parallel {
+			t.Error("Parallel output differs", mode, serial, parallel)
+		}
+	}
+}
+
+// Tests a cancelled exploration returns a partial result.
+func TestInterrupted(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("")
+	ctx, cancel := context.WithCancel(context.Background())
+	e, err := explore(ctx, db, &conf, newCache(), []string{"start"}, func(l node, r node, _ int) {
+		if r.symbol == "a" {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal("Unexpected error while exploring", err)
+	}
+	if !e.partial || len(e.res.visited) != 1 {
+		t.Error("Unexpected interrupted exploration", e.partial, e.res.visited)
+	}
+}
+
+// Tests the set operations over the call graphs of two symbols.
+func TestGraphSets(t *testing.T) {
+
+	op := func(op string, jout string) func(*configuration) {
+		return func(c *configuration) {
+			c.cmdArgs = []string{op}
+			c.Jout = jout
+		}
+	}
+	conf := fixtureConfig("")
+	conf.cliSymbols = []string{"a", "b"}
+	runCmdCases(t, sqliteFixtureConn(t), conf, []cmdCase{
+		{name: setUnion, setup: op(setUnion, "jsonOutputPlain"), run: cmdGraphSets, contains: []string{
+			`"nodes":[{"symbol":"a","reached_by":["a"]},{"symbol":"b","reached_by":["b"]},{"symbol":"c","reached_by":["a","b"]},` +
+				`{"symbol":"d","reached_by":["a","b"]}],"edges":[{"caller":"a","callee":"c"},{"caller":"b","callee":"c"},{"caller":"c","callee":"d"}]`}},
+		{name: setIntersection, setup: op(setIntersection, "jsonOutputPlain"), run: cmdGraphSets, contains: []string{
+			`"nodes":[{"symbol":"c","reached_by":["a","b"]},{"symbol":"d","reached_by":["a","b"]}],"edges":[{"caller":"c","callee":"d"}]`}},
+		{name: setDifference, setup: op(setDifference, "jsonOutputPlain"), run: cmdGraphSets, contains: []string{
+			`"nodes":[{"symbol":"a","reached_by":["a"]}],"edges":[]`}},
+		{name: "union graph", setup: op(setUnion, "graphOnly"), run: cmdGraphSets, contains: []string{
+			"\"a\" [style=filled fillcolor=\"#a6cee3\" tooltip=\"a\"]", "\"c\" [style=wedged fillcolor=\"#a6cee3:#b2df8a\" tooltip=\"a,b\"]"}},
+		{name: "single symbol", setup: func(c *configuration) {
+			c.cmdArgs = []string{setUnion}
+			c.cliSymbols = []string{"a"}
+		}, run: cmdGraphSets, fails: true},
+	})
+}
+
+// Tests the symbol visibility filters.
+func TestVisibility(t *testing.T) {
+
+	conf := fixtureConfig("start")
+	conf.Visibility = visibilityExported
+	runCmdCases(t, sqliteFixtureConn(t), conf, []cmdCase{
+		{name: "missing data", fails: true},
+	})
+
+	db := sqliteFixtureConn(t, "create table visibility (visibility_symbol_ref_id integer, visibility_static integer, visibility_export text, visibility_namespace text)",
+		"insert into visibility values (2, 0, 'EXPORT_SYMBOL', ''), (3, 0, 'EXPORT_SYMBOL_GPL', 'MM'), (4, 1, '', ''), (5, 0, 'EXPORT_SYMBOL_GPL', 'MM')")
+	runCmdCases(t, db, conf, []cmdCase{
+		// The static c is explored, its calls shown as made by its callers.
+		{name: "exported", contains: []string{"\"start\"->\"a\"", "\"start\"->\"b\"", "\"a\"->\"d\"", "\"b\"->\"d\""}, excludes: []string{"\"c\""}},
+		{name: "namespace", setup: func(c *configuration) {
+			c.Visibility = visibilityGPL
+			c.Namespace = "MM"
+		}, contains: []string{"\"start\"->\"b\"", "\"start\"->\"d\""}, excludes: []string{"\"a\""}},
+		{name: "static", setup: func(c *configuration) { c.Visibility = visibilityStatic }, contains: []string{"\"start\"->\"c\""},
+			check: func(out string) bool { return strings.Count(out, "->") == 1 }},
+	})
+}
+
+// Tests the module restriction and the inter-module calls listing.
+func TestModules(t *testing.T) {
+
+	module := func(m string) func(*configuration) {
+		return func(c *configuration) {
+			c.Symbol = "b"
+			c.Module = m
+		}
+	}
+	// A static c in a driver module, never called.
+	db := sqliteFixtureConn(t, "create table modules (module_file_ref_id integer, module_name text)", "insert into modules values (2, 'mm'), (3, 'drv')",
+		"insert into files values (3, 'drivers/x.c')", "insert into symbols values (10, 'c', '0x7000', 'direct', 3, 1)")
+	runCmdCases(t, db, fixtureConfig("start"), []cmdCase{
+		{name: "edges", run: cmdModuleEdges,
+			want: "caller\tcaller_module\tcallee\tcallee_module\na\tvmlinux\tc\tmm\nc\tmm\td\tvmlinux\nstart\tvmlinux\tb\tmm"},
+		{name: "module", setup: module("mm"), contains: []string{"\"b\"->\"c\""}, excludes: []string{"\"d\""}},
+		{name: "built in", setup: module(moduleBuiltin), excludes: []string{"->"}},
+	})
+	runCmdCases(t, sqliteFixtureConn(t), fixtureConfig("start"), []cmdCase{
+		{name: "missing data", run: cmdModuleEdges, fails: true},
+	})
+}
+
+// Tests the subsystem contents listing and the MAINTAINERS mapping.
+func TestSubsysContents(t *testing.T) {
+
+	fn := filepath.Join(t.TempDir(), "MAINTAINERS")
+	maintainers := "List of maintainers\n====================\n\nMM\nM:\tAndrew Morton <akpm@linux-foundation.org>\nL:\tlinux-mm@kvack.org\n" +
+		"S:\tMaintained\nF:\tmm/\n\nCORE\nM:\tSomeone Else <else@example.org>\nS:\tOdd Fixes\n"
+	if err := os.WriteFile(fn, []byte(maintainers), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := fixtureConfig("")
+	conf.cmdArgs = []string{"MM"}
+	runCmdCases(t, sqliteFixtureConn(t), conf, []cmdCase{
+		{name: "symbols", run: cmdSubsysContents, want: "subsystem: MM\ninstance: 1\nsymbol: b\nsymbol: c"},
+		{name: "maintainers", setup: func(c *configuration) { c.Maintainers = fn }, run: cmdSubsysContents,
+			want: "subsystem: MM\ninstance: 1\nmaintainer: Andrew Morton <akpm@linux-foundation.org>\nlist: linux-mm@kvack.org\n" +
+				"status: Maintained\nfiles: mm/\nsymbol: b\nsymbol: c"},
+		{name: "empty", setup: func(c *configuration) { c.cmdArgs = []string{"NONE"} }, run: cmdSubsysContents, fails: true},
+	})
+}
+
+// Tests the call chains listing.
+func TestCallPaths(t *testing.T) {
+
+	conf := fixtureConfig("start")
+	conf.Paths = 3
+	conf.cmdArgs = []string{"d"}
+	runCmdCases(t, sqliteFixtureConn(t), conf, []cmdCase{
+		{name: "all", run: cmdCallPaths, want: "start -> a -> c -> d\nstart -> b -> c -> d"},
+		{name: "exclusions", setup: func(c *configuration) { c.ExcludedBefore = []string{"^a$"} }, run: cmdCallPaths, want: "start -> b -> c -> d"},
+		{name: "sequence diagram", setup: func(c *configuration) {
+			c.ExcludedBefore = []string{"^a$"}
+			c.Jout = "plantuml"
+		}, run: cmdCallPaths, contains: []string{"n0 -> n1\nactivate n1\nn1 -> n2\n"}, excludes: []string{"\"a\""},
+			check: func(out string) bool { return strings.HasPrefix(out, "@startuml\n") }},
+		{name: "unreachable", setup: func(c *configuration) {
+			c.ExcludedBefore = []string{"^a$"}
+			c.cmdArgs = []string{"a"}
+		}, run: cmdCallPaths, fails: true},
+	})
+}
+
+// Tests the call chains ranking by weight.
+func TestWeightedPaths(t *testing.T) {
+
+	dir := t.TempDir()
+	for fn, data := range map[string]string{"weights.txt": "# scores\nb 2\na 1\nstart a 3\n\nd 1\n", "bad.txt": "a b c d\n"} {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := fixtureConfig("start")
+	conf.Paths = 1
+	conf.Weights = filepath.Join(dir, "weights.txt")
+	conf.cmdArgs = []string{"d"}
+	runCmdCases(t, sqliteFixtureConn(t), conf, []cmdCase{
+		{name: "heaviest", run: cmdCallPaths, want: "5\tstart -> a -> c -> d"},
+		{name: "json", setup: func(c *configuration) {
+			c.Jout = "jsonOutputPlain"
+			c.Paths = 2
+		}, run: cmdCallPaths, contains: []string{`"result":[{"weight":5,"chain":["start","a","c","d"]},{"weight":3,"chain":["start","b","c","d"]}]`}},
+		{name: "invalid weights", setup: func(c *configuration) { c.Weights = filepath.Join(dir, "bad.txt") }, run: cmdCallPaths, fails: true},
+	})
+}
+
+// Tests the exploration on caches filled by the recursive query.
+func TestRecursiveQuery(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	for _, depth := range []int{0, 2} {
+		conf.MaxDepth = depth
+		conf.RecursiveQuery = false
+		expected, err := generateOutput(context.Background(), db, &conf)
+		if err != nil {
+			t.Fatal("Unexpected error while exploring", err)
+		}
+		conf.RecursiveQuery = true
+		out, err := generateOutput(context.Background(), db, &conf)
+		if err != nil || out != expected {
+			t.Error("Unexpected output with recursive query at depth", depth, out, err)
+		}
+	}
+
+	nc := navConf{db: db, cache: newCache(), instance: 1, maxdepth: 2}
+	if err := prefetchRecursive(&nc, []int{1}); err != nil {
+		t.Fatal("Unexpected error prefetching", err)
+	}
+	if _, ok := nc.cache.successors[4]; ok || len(nc.cache.successors) != 3 || len(nc.cache.successors[1]) != 2 || nc.cache.entries[4].symbol != "c" {
+		t.Error("Unexpected prefetched caches", nc.cache.successors, nc.cache.entries)
+	}
+}
+
+// Tests the exit codes of the failures and of the truncated outputs.
+func TestExitCodes(t *testing.T) {
+
+	db := sqliteFixtureConn(t)
+	if _, err := sym2num(db, "missing", 1); exitCode(err) != exitSymbolNotFound || err.Error() != "symbol missing not found in instance 1" {
+		t.Error("Unexpected missing symbol error", err)
+	}
+	if _, err := sym2num(db, "start", 9); exitCode(err) != exitInstanceNotFound {
+		t.Error("Unexpected missing instance error", err)
+	}
+	if _, err := getSymbolInfo(db, "missing", 1); exitCode(err) != exitSymbolNotFound {
+		t.Error("Unexpected missing symbol info error", err)
+	}
+	conf := defaultConfig
+	conf.DBDriver = navdb.Sqlite
+	conf.DBFile = filepath.Join(t.TempDir(), "missing", "nav.db")
+	conf.DBRetries = 0
+	if _, err := connectConf(context.Background(), &conf); exitCode(err) != exitDBUnreachable {
+		t.Error("Unexpected unreachable database error", err)
+	}
+	if exitCode(errors.New("failure")) != exitInternal || exitCode(fmt.Errorf("wrapped: %w", exitError{exitBadArgs, errors.New("x")})) != exitBadArgs {
+		t.Error("Unexpected exit codes of plain and wrapped errors")
+	}
+
+	conf = fixtureConfig("start")
+	conf.Errors = errorsJSON
+	conf.MaxNodes = 2
+	conf.CacheDir = t.TempDir()
+	generate := func() (string, error) { return generateOutput(context.Background(), db, &conf) }
+	if _, err := cachedOutput(context.Background(), db, &conf, generate); err != nil || exitCode(conf.truncated) != exitTruncated {
+		t.Error("Truncated output not detected", conf.truncated, err)
+	}
+	msg := conf.truncated.Error()
+	conf.truncated = nil
+	if _, err := cachedOutput(context.Background(), db, &conf, generate); err != nil || conf.truncated == nil || conf.truncated.Error() != msg {
+		t.Error("Truncated output not detected from the cache", conf.truncated, err)
+	}
+
+	if args, _ := splitLongArgs([]string{"-s", "a", "--errors=json", "-x"}); errorsFormat(args) != errorsJSON || errorsFormat([]string{"-s", "a"}) != errorsText {
+		t.Error("Unexpected errors format")
+	}
+}
+
+// Tests the completion of the command line, from the database and cached.
+func TestCompletion(t *testing.T) {
+
+	fn := sqliteFixtureDB(t)
+	prefix := []string{"nav", "-b", "sqlite", "--sqlite", fn, "-i", "1", "--cache-dir", t.TempDir()}
+	var tests = []struct {
+		words []string
+		exp   string
+	}{
+		{[]string{"-s", "s"}, "start"},
+		{[]string{"-s", "a,b,"}, "a,b,a\na,b,b\na,b,c\na,b,d\na,b,start"},
+		{[]string{"-x", "2", "-i", ""}, "1\n2"},
+		{[]string{"--prof"}, "--profile"},
+		{[]string{"--strategy", "=", "b"}, "bfs"},
+		{[]string{"--errors=j"}, "--errors=json"},
+		{[]string{"-s", "a", "se"}, "search\nsets"},
+		{[]string{"--no-cache", "sets", "u"}, "union"},
+		{[]string{"info", "st"}, "start"},
+		{[]string{"diff", "1", ""}, "1\n2"},
+		{[]string{"-o", "out"}, ""},
+	}
+	for _, test := range tests {
+		words := append(append([]string{}, prefix...), test.words...)
+		t.Setenv(compWordsEnv, strings.Join(words, "\n")+"\n")
+		t.Setenv(compCwordEnv, fmt.Sprint(len(words)-1))
+		if out := completeEnv(); out != test.exp {
+			t.Errorf("Unexpected completion of %v: %q", test.words, out)
+		}
+	}
+
+	os.Remove(fn)
+	words := append(append([]string{}, prefix...), "-s", "")
+	t.Setenv(compWordsEnv, strings.Join(words, "\n"))
+	t.Setenv(compCwordEnv, fmt.Sprint(len(words)-1))
+	if out := completeEnv(); out != "a\nb\nc\nd\nstart" {
+		t.Errorf("Cached symbols not used: %q", out)
+	}
+
+	conf := defaultConfig
+	conf.cmdArgs = []string{"bash"}
+	if out, err := cmdShellCompletion(nil, &conf); err != nil || !strings.Contains(out, "complete -o default -F _nav nav") {
+		t.Error("Unexpected bash completion script", out, err)
+	}
+	conf.cmdArgs = []string{"tcsh"}
+	if _, err := cmdShellCompletion(nil, &conf); err == nil {
+		t.Error("Unsupported shell not reported")
+	}
+}
+
+// Tests the terminal interface model, driven by keys, and its screen.
+func TestTui(t *testing.T) {
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("")
+
+	ui, err := newTui(db, &conf, []string{"start"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := func() string {
+		var names []string
+		for _, n := range ui.rows {
+			names = append(names, strings.Repeat(" ", n.level)+n.symbol)
+		}
+		return strings.Join(names, ",")
+	}
+	keys := func(keys ...string) {
+		for _, k := range keys {
+			if ui.handleKey(k) {
+				t.Fatal("unexpected quit on", k)
+			}
+		}
+	}
+	if got := rows(); got != "start, a, b" {
+		t.Fatal("wrong initial tree", got)
+	}
+	keys("j", "l")
+	if got := rows(); got != "start, a,  c, b" {
+		t.Error("wrong tree after expanding a", got)
+	}
+	keys("+", "+")
+	if got := rows(); got != "start, a,  c,   d, b,  c,   d" {
+		t.Error("wrong tree at depth 3", got)
+	}
+	keys("-", "G", "h")
+	if ui.selected().symbol != "b" {
+		t.Error("h did not select the caller", ui.selected().symbol)
+	}
+
+	keys("/", "c", "enter")
+	if n := ui.selected(); n.symbol != "c" || n.parent.symbol != "b" {
+		t.Error("search did not select the first c from b", n.symbol)
+	}
+	keys("n")
+	if n := ui.selected(); n.symbol != "c" || n.parent.symbol != "a" {
+		t.Error("n did not wrap around to the next c")
+	}
+	keys("/", "x", "esc")
+	if n := ui.selected(); n.symbol != "c" || n.parent.symbol != "a" || ui.searching {
+		t.Error("escape did not restore the selection")
+	}
+
+	keys("c")
+	if got := rows(); got != "c, a,  start, b,  start" || !ui.view.callers {
+		t.Error("wrong callers tree", got)
+	}
+	lines, sel := ui.render(80, 16)
+	if len(lines) != 16 || !strings.Contains(lines[0], "callers of c") || !strings.HasPrefix(lines[sel], ">- c") {
+		t.Errorf("wrong screen %q", lines)
+	}
+	if !strings.Contains(strings.Join(lines, "\n"), "callers: 2") {
+		t.Errorf("missing details %q", lines)
+	}
+	keys("b")
+	if n := ui.selected(); ui.view.callers || n.symbol != "c" || n.parent.symbol != "a" {
+		t.Error("b did not go back to the callees tree")
+	}
+	if !ui.handleKey("q") {
+		t.Error("q did not quit")
+	}
+
+	if got := parseKeys([]byte("j\x1b[A\x1b[1;5B\x1b[3~\r\x7f\x1b")); strings.Join(got, ",") != "j,up,down,enter,backspace,esc" {
+		t.Error("wrong keys", got)
+	}
+}
+
+// Tests the functions are linked to their definition in the sources.
+func TestSources(t *testing.T) {
+	db := sqliteFixtureConn(t)
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "kernel"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	start := "#include <a.h>\n\nint a(void);\n\nint start(void)\n{\n\treturn a();\n}\n\nstatic int\nd(void) { return 0; }\n"
+	if err := os.WriteFile(filepath.Join(src, "kernel/start.c"), []byte(start), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := fixtureConfig("start")
+	conf.Jout = "tree"
+	conf.Quiet = true
+	conf.SrcTree = src
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []string{"start [CORE] " + filepath.Join(src, "kernel/start.c") + ":5", "a [CORE] " + filepath.Join(src, "kernel/start.c") + "\n", "b [MM] " + filepath.Join(src, "mm/alloc.c") + "\n"} {
+		if !strings.Contains(out, l) {
+			t.Errorf("missing %q in %s", l, out)
+		}
+	}
+
+	conf.SrcURL = "https://elixir.bootlin.com/linux/v6.6/source/"
+	conf.Jout = "graphOnly"
+	out, err = generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"start" [URL="https://elixir.bootlin.com/linux/v6.6/source/kernel/start.c#L5"`) {
+		t.Error("missing link of start", out)
+	}
+
+	conf.cmdArgs = []string{"d"}
+	conf.Snippet = true
+	out, err = cmdSymbolInfo(db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out, "source: https://elixir.bootlin.com/linux/v6.6/source/kernel/start.c#L10\n    static int\n    d(void) { return 0; }") {
+		t.Error("wrong source of d", out)
+	}
+}
+
+// Tests the comparison with a baseline guarding the subsystem boundaries.
+func TestCompare(t *testing.T) {
+	db := sqliteFixtureConn(t)
+	conf := fixtureConfig("start")
+	conf.Jout = "csv"
+	conf.ExcludedBefore = []string{"^c$"}
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline := filepath.Join(t.TempDir(), "baseline.csv")
+	if err := os.WriteFile(baseline, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.ExcludedBefore = []string{}
+	conf.Jout = "graphOnly"
+	conf.cmdArgs = []string{baseline}
+	out, err = cmdCompareBaseline(db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--- " + baseline + "\n+++ start\n" +
+		"+ edge a -> c (CORE -> MM)\n+ edge b -> c (MM -> MM)\n+ edge c -> d (MM -> CORE)\n" +
+		"! edge a -> c (CORE -> MM)\n! edge c -> d (MM -> CORE)"
+	if out != expected {
+		t.Error("wrong comparison", out)
+	}
+	if exitCode(conf.violation) != exitBoundaryCrossed {
+		t.Error("wrong violation", conf.violation)
+	}
+
+	conf.violation = nil
+	conf.Boundaries = []string{"CORE->M.*"}
+	conf.Jout = "jsonOutputPlain"
+	out, err = cmdCompareBaseline(db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"violations":[{"caller":"a","caller_subsystem":"CORE","callee":"c","callee_subsystem":"MM"}]`) || conf.violation == nil {
+		t.Error("wrong boundary violations", out)
+	}
+
+	conf.violation = nil
+	conf.Boundaries = []string{"MM->CORE", "->MM"}
+	conf.cmdArgs = []string{baseline}
+	conf.ExcludedBefore = []string{"^c$"}
+	if _, err = cmdCompareBaseline(db, &conf); err != nil || conf.violation != nil {
+		t.Error("unexpected violation", conf.violation, err)
+	}
+
+	conf.Boundaries = []string{"CORE"}
+	if err := conf.validate(); err == nil {
+		t.Error("invalid boundary accepted")
+	}
+}
+
+// Tests the exploration cut by the depth limit or the budget is resumed from
+// its frontier, without exploring again the functions already explored.
+func TestResume(t *testing.T) {
+	db := sqliteFixtureConn(t, cyclesFixture)
+	conf := fixtureConfig("start")
+	conf.MaxDepth = 1
+	conf.Resumable = true
+	out, err := generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.Index(out, "// resume: ")
+	if i < 0 || !strings.Contains(out, "// frontier: c\n") {
+		t.Fatal("missing resume token", out)
+	}
+	token := out[i+len("// resume: "):]
+
+	resumed := fixtureConfig("")
+	if err := funcResume(&resumed, []string{token}); err != nil {
+		t.Fatal(err)
+	}
+	if got := resumed.symbolList(); len(got) != 1 || got[0] != "c" {
+		t.Error("wrong resumed symbols", got)
+	}
+	fn := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(fn, []byte(token+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fromFile := defaultConfig
+	if err := funcResume(&fromFile, []string{"@" + fn}); err != nil || fromFile.resumeArg != resumed.resumeArg {
+		t.Error("resume token not read from file", err)
+	}
+	if err := funcResume(&fromFile, []string{"@" + fn + ".missing"}); err == nil {
+		t.Error("missing token file not detected")
+	}
+	out, err = generateOutput(context.Background(), db, &resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{"\"c\"->\"d\"", "\"d\"->\"a\""} {
+		if !strings.Contains(out, e) {
+			t.Error("missing edge", e, "in", out)
+		}
+	}
+	if strings.Contains(out, "\"a\"->") || strings.Contains(out, "\"start\"") {
+		t.Error("explored functions explored again", out)
+	}
+
+	resumed.cliSymbols = []string{"b"}
+	if _, err = generateOutput(context.Background(), db, &resumed); exitCode(err) != exitSymbolNotFound {
+		t.Error("function not on the frontier resumed", err)
+	}
+	resumed.Instance = 2
+	if err := resumed.validate(); err == nil {
+		t.Error("token resumed on another instance")
+	}
+
+	conf.MaxDepth = 0
+	conf.MaxEdges = 2
+	conf.Jout = "jsonOutputPlain"
+	out, err = generateOutput(context.Background(), db, &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc graphDoc
+	if err := json.Unmarshal([]byte(out), &doc); err != nil || doc.Resume == nil {
+		t.Fatal("missing resume section", out, err)
+	}
+	if strings.Join(doc.Resume.Frontier, ",") != strings.Join(doc.Truncated, ",") {
+		t.Error("truncated functions not on the frontier", doc.Resume, doc.Truncated)
+	}
+	if _, err := parseResumeToken(doc.Resume.Token + "x"); err == nil {
+		t.Error("corrupted token accepted")
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdStats = "stats"
+
+// Call graph metrics of a symbol. FanIn and FanOut are the distinct direct
+// callers and callees in the database, the others describe the call tree
+// explored from the symbol, honoring depth and exclusions.
+type symbolStats struct {
+	Symbol      string `json:"symbol"`
+	FanIn       int    `json:"fan_in"`
+	FanOut      int    `json:"fan_out"`
+	Reachable   int    `json:"reachable"`
+	MaxDepth    int    `json:"max_depth"`
+	SubsysCount int    `json:"subsystems"`
+}
+
+// Computes the metrics of the symbol with the given id, sharing the cache
+// among calls.
+func getSymbolStats(db navdb.Conn, conf *configuration, cache Cache, id int, symbol string) (symbolStats, error) {
+	var err error
+
+	st := symbolStats{Symbol: symbol}
+	st.FanIn, err = queryCount(db, "select count(distinct caller) from xrefs where callee=$1 and xref_instance_id_ref=$2", id, conf.Instance)
+	if err != nil {
+		return st, err
+	}
+	st.FanOut, err = queryCount(db, "select count(distinct callee) from xrefs where caller=$1 and xref_instance_id_ref=$2", id, conf.Instance)
+	if err != nil {
+		return st, err
+	}
+
+	c := *conf
+	c.Mode = printAll
+	c.Quiet = true
+	c.startIds = map[string]int{symbol: id}
+	e, err := explore(navdb.Context(db), db, &c, cache, []string{symbol}, nil)
+	if err != nil {
+		return st, err
+	}
+	g := newOutGraph(e, printAll)
+	subsystems := map[string]bool{}
+	st.Reachable = len(g.Nodes) - 1
+	for _, n := range g.Nodes {
+		if n.Depth > st.MaxDepth {
+			st.MaxDepth = n.Depth
+		}
+		subsystems[n.Subsys] = true
+	}
+	st.SubsysCount = len(subsystems)
+	return st, nil
+}
+
+// Returns the symbols of an instance defined in files of the subsystem.
+func getSubsysSymbols(db navdb.Conn, subsys string, instance int) ([]string, error) {
+	return queryColumn(db, "select distinct symbol_name from symbols, tags where symbols.symbol_file_ref_id=tags.tag_file_ref_id "+
+		"and tags.subsys_name=$1 and symbols.symbol_instance_id_ref=$2 order by symbol_name", subsys, instance)
+}
+
+// Returns the ids and names of the symbols of an instance defined in files of
+// the subsystem, same named statics included once each.
+func getSubsysDefinitions(db navdb.Conn, subsys string, instance int) ([]int, []string, error) {
+	var ids []int
+	var names []string
+
+	_, lines, err := queryTable(db, "select symbol_id, symbol_name from symbols, tags where symbols.symbol_file_ref_id=tags.tag_file_ref_id "+
+		"and tags.subsys_name=$1 and symbols.symbol_instance_id_ref=$2 order by symbol_name, symbol_id", subsys, instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, line := range lines {
+		id, err := strconv.Atoi(line[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		names = append(names, line[1])
+	}
+	return ids, names, nil
+}
+
+// Formats the metrics as a table with header.
+func statsTable(stats []symbolStats) string {
+	lines := []string{"symbol\tfan_in\tfan_out\treachable\tmax_depth\tsubsystems"}
+	for _, s := range stats {
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%d\t%d\t%d\t%d", s.Symbol, s.FanIn, s.FanOut, s.Reachable, s.MaxDepth, s.SubsysCount))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Implements the stats command. With no args the metrics of the symbols are
+// reported, with a subsystem name the top symbols of the subsystem ranked by
+// reachable set size.
+func cmdSymbolStats(db navdb.Conn, conf *configuration) (string, error) {
+	var stats []symbolStats
+	var ids []int
+	var err error
+
+	symbols := conf.symbolList()
+	switch len(conf.cmdArgs) {
+	case 0:
+		if symbols[0] == "" {
+			return "", errors.New("stats needs a symbol or a subsystem")
+		}
+		for _, symbol := range symbols {
+			id, err := sym2num(db, symbol, conf.Instance)
+			if err != nil {
+				return "", fmt.Errorf("symbol %s: %w", symbol, err)
+			}
+			ids = append(ids, id)
+		}
+	case 1:
+		ids, symbols, err = getSubsysDefinitions(db, conf.cmdArgs[0], conf.Instance)
+		if err != nil {
+			return "", err
+		}
+		if len(symbols) == 0 {
+			return "", fmt.Errorf("no symbols in subsystem %s", conf.cmdArgs[0])
+		}
+	default:
+		return "", fmt.Errorf("command %s needs at most 1 arg", cmdStats)
+	}
+
+	cache := newCache()
+	for i, symbol := range symbols {
+		st, err := getSymbolStats(db, conf, cache, ids[i], symbol)
+		if err != nil {
+			return "", err
+		}
+		stats = append(stats, st)
+	}
+	if len(conf.cmdArgs) == 1 {
+		sort.SliceStable(stats, func(i, j int) bool { return stats[i].Reachable > stats[j].Reachable })
+		if conf.Top > 0 && len(stats) > conf.Top {
+			stats = stats[:conf.Top]
+		}
+	}
+
+	if opt2num(conf.Jout) == graphOnly {
+		return statsTable(stats), nil
+	}
+	return jsonResult(cmdStats, stats)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+)
+
+// Traversal strategies: they give different shapes to the graphs cut by the
+// depth or the budget limits.
+const (
+	strategyDFS   = "dfs"
+	strategyBFS   = "bfs"
+	strategyIDDFS = "iddfs"
+)
+
+// Function waiting in the breadth first queue, with the path that led to it.
+type visit struct {
+	symbolId  int
+	parent    node
+	depth     int
+	path      []int
+	pathNames []string
+}
+
+// Checks the strategy is one of the supported ones.
+func validStrategy(s string) error {
+	switch s {
+	case strategyDFS, strategyBFS, strategyIDDFS:
+		return nil
+	}
+	return fmt.Errorf("unsupported strategy %s", s)
+}
+
+// Schedules the exploration of a callee: depth first strategies explore it
+// right away, breadth first queues it after the functions already found.
+func (nc *navConf) next(res *navResult, symbolId int, parent node, depth int) {
+	if nc.strategy != strategyBFS {
+		navigate(nc, res, symbolId, parent, depth)
+		return
+	}
+	if res.queued[symbolId] {
+		return
+	}
+	res.queued[symbolId] = true
+	res.queue = append(res.queue, visit{symbolId, parent, depth, append([]int{}, res.path...), append([]string{}, res.pathNames...)})
+}
+
+// Explores the call trees of the start functions with the configured strategy.
+func walk(nc *navConf, res *navResult, starts []int, nodes []node) {
+	switch nc.strategy {
+	case strategyBFS:
+		walkBFS(nc, res, starts, nodes)
+	case strategyIDDFS:
+		walkIDDFS(nc, res, starts, nodes)
+	default:
+		walkDFS(nc, res, starts, nodes)
+	}
+}
+
+// Depth first: each call path is followed to its end before the next call.
+func walkDFS(nc *navConf, res *navResult, starts []int, nodes []node) {
+	for i, start := range starts {
+		if !res.seen[start] {
+			navigate(nc, res, start, nodes[i], 0)
+		}
+	}
+}
+
+// Breadth first: functions are explored in order of distance from the start
+// ones, each one reached through the shortest path.
+func walkBFS(nc *navConf, res *navResult, starts []int, nodes []node) {
+	for i, start := range starts {
+		if !res.queued[start] {
+			res.queued[start] = true
+			res.queue = append(res.queue, visit{symbolId: start, parent: nodes[i]})
+		}
+	}
+	for len(res.queue) > 0 && nc.ctx.Err() == nil {
+		v := res.queue[0]
+		res.queue = res.queue[1:]
+		if res.seen[v.symbolId] {
+			continue
+		}
+		res.path, res.pathNames = v.path, v.pathNames
+		navigate(nc, res, v.symbolId, v.parent, v.depth)
+	}
+	res.path, res.pathNames = nil, nil
+}
+
+// Iterative deepening: depth first passes with a growing depth limit, up to
+// the configured one, until the graph is complete. If a pass exceeds the
+// budget, the previous pass, complete up to its depth, is kept and the
+// functions at the depth limit are marked as truncated.
+func walkIDDFS(nc *navConf, res *navResult, starts []int, nodes []node) {
+	var prev *navResult
+
+	maxdepth := nc.maxdepth
+	defer func() { nc.maxdepth = maxdepth }()
+	for limit := 1; ; limit++ {
+		r := nc.newResult()
+		nc.maxdepth = limit
+		if nc.progress != nil {
+			nc.progress.restart()
+		}
+		logger.info("iddfs pass", "depth", limit)
+		walkDFS(nc, &r, starts, nodes)
+		if len(r.truncated) > 0 && prev != nil {
+			for _, id := range prev.depthCut {
+				if !prev.seen[id] {
+					prev.truncate(id, nc.cache.entries[id].symbol)
+				}
+			}
+			*res = *prev
+			return
+		}
+		if len(r.truncated) > 0 || len(r.depthCut) == 0 || limit == maxdepth || nc.ctx.Err() != nil {
+			*res = r
+			return
+		}
+		prev = &r
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdSubsys = "subsys"
+
+// MAINTAINERS entry field line, e.g. "M:	Name <address>".
+var maintainersField = regexp.MustCompile(`^([A-Z]):\s*(.*)$`)
+
+// MAINTAINERS entry of a subsystem.
+type maintainersEntry struct {
+	Title       string   `json:"title"`
+	Maintainers []string `json:"maintainers"`
+	Reviewers   []string `json:"reviewers"`
+	Lists       []string `json:"lists"`
+	Status      string   `json:"status"`
+	Files       []string `json:"files"`
+}
+
+// Symbols of a subsystem, with its MAINTAINERS entry if any.
+type subsysContents struct {
+	Subsystem   string            `json:"subsystem"`
+	Instance    int               `json:"instance"`
+	Maintainers *maintainersEntry `json:"maintainers,omitempty"`
+	Symbols     []string          `json:"symbols"`
+}
+
+// Parses a MAINTAINERS file into its entries, by title. Entries are blocks of
+// lines separated by empty lines, the title followed by the fields; blocks
+// without fields, as the file preamble, are skipped.
+func parseMaintainers(r io.Reader) (map[string]*maintainersEntry, error) {
+	res := map[string]*maintainersEntry{}
+	var curr *maintainersEntry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" {
+			curr = nil
+			continue
+		}
+		if curr == nil {
+			curr = &maintainersEntry{Title: line}
+			continue
+		}
+		m := maintainersField.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		switch m[1] {
+		case "M":
+			curr.Maintainers = append(curr.Maintainers, m[2])
+		case "R":
+			curr.Reviewers = append(curr.Reviewers, m[2])
+		case "L":
+			curr.Lists = append(curr.Lists, m[2])
+		case "S":
+			curr.Status = m[2]
+		case "F":
+			curr.Files = append(curr.Files, m[2])
+		}
+		res[curr.Title] = curr
+	}
+	return res, scanner.Err()
+}
+
+// Loads the MAINTAINERS entry of a subsystem, nil if there is none.
+func loadMaintainersEntry(fn string, subsys string) (*maintainersEntry, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := parseMaintainers(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return entries[subsys], nil
+}
+
+// Formats the subsystem contents as a list of key value lines.
+func (s subsysContents) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "subsystem: %s\n", s.Subsystem)
+	fmt.Fprintf(&b, "instance: %d\n", s.Instance)
+	if m := s.Maintainers; m != nil {
+		for _, v := range m.Maintainers {
+			fmt.Fprintf(&b, "maintainer: %s\n", v)
+		}
+		for _, v := range m.Reviewers {
+			fmt.Fprintf(&b, "reviewer: %s\n", v)
+		}
+		for _, v := range m.Lists {
+			fmt.Fprintf(&b, "list: %s\n", v)
+		}
+		fmt.Fprintf(&b, "status: %s\n", m.Status)
+		for _, v := range m.Files {
+			fmt.Fprintf(&b, "files: %s\n", v)
+		}
+	}
+	for _, v := range s.Symbols {
+		fmt.Fprintf(&b, "symbol: %s\n", v)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Implements the subsys command: lists the symbols of the instance defined in
+// files of the subsystem, with its MAINTAINERS entry if a file is given.
+func cmdSubsysContents(db navdb.Conn, conf *configuration) (string, error) {
+	var err error
+
+	s := subsysContents{Subsystem: conf.cmdArgs[0], Instance: conf.Instance}
+	s.Symbols, err = getSubsysSymbols(db, s.Subsystem, conf.Instance)
+	if err != nil {
+		return "", err
+	}
+	if len(s.Symbols) == 0 {
+		return "", fmt.Errorf("no symbols in subsystem %s", s.Subsystem)
+	}
+	if conf.Maintainers != "" {
+		s.Maintainers, err = loadMaintainersEntry(conf.Maintainers, s.Subsystem)
+		if err != nil {
+			return "", err
+		}
+		if s.Maintainers == nil {
+			logger.info("no MAINTAINERS entry", "subsystem", s.Subsystem)
+		}
+	}
+
+	if opt2num(conf.Jout) == graphOnly {
+		return s.String(), nil
+	}
+	return jsonResult(cmdSubsys, s)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Data passed to the user templates. In the subsystems modes the nodes are
+// subsystems, and Symbol holds the subsystem name. Cycles and Uncovered are
+// filled with --report-cycles and --coverage, Truncated lists the functions
+// whose calls were cut by the budget.
+type templateData struct {
+	Symbols   []string
+	Partial   bool
+	Nodes     []templateNode
+	Edges     []templateEdge
+	Cycles    [][]string
+	Uncovered []string
+	Truncated []string
+}
+
+// Node of the template data model: Depth is the distance from the nearest
+// start symbol, Children the callees names, Source the link to the function
+// definition given --src.
+type templateNode struct {
+	Symbol    string
+	Subsystem string
+	Depth     int
+	Source    string
+	Children  []string
+}
+
+// Edge of the template data model, Kind is either direct or indirect.
+type templateEdge struct {
+	Caller     string
+	Callee     string
+	Kind       string
+	Confidence float64
+	SourceRef  string
+	AddressRef string
+}
+
+// Functions available to the templates besides the text/template builtins.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// Builds the template data model from the graph.
+func newTemplateData(e *exploration, g *graph.Graph) templateData {
+	d := templateData{Symbols: e.symbols, Partial: e.partial, Cycles: e.res.cycles, Truncated: e.res.truncated}
+
+	for _, n := range g.Nodes {
+		d.Nodes = append(d.Nodes, templateNode{Symbol: n.Name, Subsystem: n.Subsys, Depth: n.Depth, Source: n.Source, Children: []string{}})
+	}
+	for _, edge := range g.Edges {
+		caller, callee := g.Nodes[edge.From].Name, g.Nodes[edge.To].Name
+		d.Nodes[edge.From].Children = append(d.Nodes[edge.From].Children, callee)
+		d.Edges = append(d.Edges, templateEdge{caller, callee, edge.Kind(), edge.Confidence, edge.SourceRef, edge.AddressRef})
+	}
+	if e.coverage != nil {
+		d.Uncovered = e.coverage.uncovered(e.functions())
+	}
+	return d
+}
+
+// Formats the exploration with the Go text/template in the given file.
+func templateOutput(fn string, e *exploration, mode outMode) (string, error) {
+	var b strings.Builder
+
+	t, err := template.New(filepath.Base(fn)).Funcs(templateFuncs).ParseFiles(fn)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(&b, newTemplateData(e, newOutGraph(e, mode))); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
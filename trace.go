@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdTrace = "trace"
+
+// Matches a stack frame as printed by the kernel, e.g.
+// " ? vfs_read+0x9d/0x1a0 [ext4]" or "RIP: 0010:vfs_read+0x9d/0x1a0".
+var frameRe = regexp.MustCompile(`(\?\s+)?([A-Za-z_][\w.]*)\+(0x[0-9a-fA-F]+)/(0x[0-9a-fA-F]+)`)
+
+// Stack frame annotated with the database content.
+// CalledBy is the following frame, and DirectCall tells if the database has
+// a call edge from it to this frame.
+type traceFrame struct {
+	Symbol     string   `json:"symbol"`
+	Offset     string   `json:"offset"`
+	Reliable   bool     `json:"reliable"`
+	Found      bool     `json:"found"`
+	File       string   `json:"file,omitempty"`
+	Subsystems []string `json:"subsystems,omitempty"`
+	CalledBy   string   `json:"called_by,omitempty"`
+	DirectCall bool     `json:"direct_call"`
+}
+
+// Extracts the frames of an oops or warning stack trace, innermost first.
+// The faulting function appears both in the header and in the RIP line,
+// consecutive repetitions are reported once.
+func parseTrace(in io.Reader) ([]traceFrame, error) {
+	var res []traceFrame
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		m := frameRe.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		f := traceFrame{Symbol: m[2], Offset: m[3] + "/" + m[4], Reliable: m[1] == ""}
+		if n := len(res); n > 0 && res[n-1].Symbol == f.Symbol && res[n-1].Offset == f.Offset {
+			continue
+		}
+		res = append(res, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.New("no stack frames found")
+	}
+	return res, nil
+}
+
+// Returns the name the symbol has in the database. Compiler generated
+// clones, e.g. foo.isra.0 or foo.cold, are looked up by their base name.
+func traceSymbol(db navdb.Conn, symbol string, instance int) (string, bool, error) {
+	for _, name := range []string{symbol, strings.SplitN(symbol, ".", 2)[0]} {
+		ids, err := queryColumn(db, "select symbol_id from symbols where symbol_name=$1 and symbol_instance_id_ref=$2", name, instance)
+		if err != nil {
+			return "", false, err
+		}
+		if len(ids) > 0 {
+			return name, true, nil
+		}
+	}
+	return symbol, false, nil
+}
+
+// Resolves the frames in the instance and checks the call edges between adjacent frames.
+func annotateTrace(db navdb.Conn, frames []traceFrame, instance int) error {
+	names := make([]string, len(frames))
+
+	for i := range frames {
+		name, found, err := traceSymbol(db, frames[i].Symbol, instance)
+		if err != nil {
+			return err
+		}
+		names[i] = name
+		frames[i].Found = found
+		if !found {
+			continue
+		}
+		infos, err := getSymbolInfo(db, name, instance)
+		if err != nil {
+			return err
+		}
+		frames[i].File = infos[0].File
+		frames[i].Subsystems = infos[0].Subsystems
+	}
+
+	for i := 0; i+1 < len(frames); i++ {
+		frames[i].CalledBy = frames[i+1].Symbol
+		if !frames[i].Found || !frames[i+1].Found {
+			continue
+		}
+		n, err := queryCount(db, "select count(*) from xrefs, symbols caller, symbols callee where "+
+			"xrefs.caller=caller.symbol_id and xrefs.callee=callee.symbol_id and caller.symbol_name=$1 and "+
+			"callee.symbol_name=$2 and xref_instance_id_ref=$3", names[i+1], names[i], instance)
+		if err != nil {
+			return err
+		}
+		frames[i].DirectCall = n > 0
+	}
+	return nil
+}
+
+// Formats the annotated trace, one frame per line.
+func traceString(frames []traceFrame) string {
+	var lines []string
+
+	for i, f := range frames {
+		mark := ""
+		if !f.Reliable {
+			mark = "? "
+		}
+		line := fmt.Sprintf("#%d %s%s+%s", i, mark, f.Symbol, f.Offset)
+		if !f.Found {
+			lines = append(lines, line+"\tnot found")
+			continue
+		}
+		line += "\t" + f.File + "\t" + strings.Join(f.Subsystems, ",")
+		switch {
+		case f.CalledBy == "":
+		case f.DirectCall:
+			line += "\tdirect call from " + f.CalledBy
+		default:
+			line += "\tno direct call from " + f.CalledBy
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Implements the trace command, reading the trace from the given file or stdin.
+func cmdTraceAnnotate(db navdb.Conn, conf *configuration) (string, error) {
+	var in io.Reader = os.Stdin
+
+	if len(conf.cmdArgs) > 1 {
+		return "", fmt.Errorf("command %s needs at most 1 arg", cmdTrace)
+	}
+	if len(conf.cmdArgs) == 1 && conf.cmdArgs[0] != "-" {
+		f, err := os.Open(conf.cmdArgs[0])
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	frames, err := parseTrace(in)
+	if err != nil {
+		return "", err
+	}
+	if err = annotateTrace(db, frames, conf.Instance); err != nil {
+		return "", err
+	}
+	if opt2num(conf.Jout) == graphOnly {
+		return traceString(frames), nil
+	}
+	return jsonResult(cmdTrace, frames)
+}
@@ -0,0 +1,527 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+const cmdTui = "tui"
+
+// Help shown in the status line of the terminal interface.
+const tuiHelp = "q quit  j/k move  l/h expand/collapse  +/- depth  c callers  b back  / search  n next"
+
+// Node of the call tree shown by the terminal interface. Children are
+// fetched from the database the first time the node is expanded.
+type tuiNode struct {
+	symbol    string
+	id        int
+	level     int
+	expanded  bool
+	loaded    bool
+	recursive bool
+	excluded  bool
+	parent    *tuiNode
+	children  []*tuiNode
+}
+
+// Tree shown by the terminal interface, the callees or the callers of its
+// roots, with the selected row.
+type tuiView struct {
+	roots   []*tuiNode
+	callers bool
+	depth   int
+	sel     int
+	top     int
+}
+
+// State of the terminal interface.
+type tui struct {
+	db        navdb.Conn
+	conf      *configuration
+	cache     Cache
+	view      tuiView
+	history   []tuiView
+	rows      []*tuiNode
+	details   map[int][]string
+	sources   *sourceTree
+	searching bool
+	query     string
+	from      int
+	status    string
+}
+
+// Returns the terminal interface exploring the callees of the symbols.
+func newTui(db navdb.Conn, conf *configuration, symbols []string) (*tui, error) {
+	t := &tui{db: db, conf: conf, cache: newCache(), details: map[int][]string{}, sources: newSourceTree(db, conf)}
+	depth := conf.MaxDepth
+	if depth <= 0 {
+		depth = 1
+	}
+	view := tuiView{depth: depth}
+	for _, s := range symbols {
+		id, err := sym2num(db, s, conf.Instance)
+		if err != nil {
+			return nil, err
+		}
+		view.roots = append(view.roots, &tuiNode{symbol: s, id: id})
+	}
+	if err := t.show(view); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Returns the callers of a symbol.
+func getCallersById(db navdb.Conn, symbolId int, instance int, cache Cache) ([]entry, error) {
+	var res []entry
+
+	ids, err := queryColumn(db, "select distinct caller from xrefs where callee=$1 and xref_instance_id_ref=$2 order by caller", symbolId, instance)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		e, err := getEntryById(db, n, instance, cache.entries)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// Fetches the children of a node, the callees or the callers depending on
+// the view. Functions excluded before exploring are left out, those excluded
+// after exploring and those already on the path from the root are shown but
+// not expandable.
+func (t *tui) load(n *tuiNode) error {
+	var list []entry
+	var err error
+
+	if n.loaded {
+		return nil
+	}
+	if t.view.callers {
+		list, err = getCallersById(t.db, n.id, t.conf.Instance, t.cache)
+	} else {
+		list, err = getSuccessorsById(t.db, n.id, t.conf.Instance, t.cache)
+	}
+	if err != nil {
+		return err
+	}
+	seen := map[int]bool{}
+	for _, e := range list {
+		if seen[e.symId] || !notExcluded(e.symbol, t.conf.ExcludedBefore) {
+			continue
+		}
+		seen[e.symId] = true
+		c := &tuiNode{symbol: e.symbol, id: e.symId, level: n.level + 1, parent: n, excluded: !notExcluded(e.symbol, t.conf.ExcludedAfter)}
+		for p := n; p != nil; p = p.parent {
+			if p.id == c.id {
+				c.recursive = true
+				break
+			}
+		}
+		n.children = append(n.children, c)
+	}
+	n.loaded = true
+	return nil
+}
+
+// Expands a node, unless it is not expandable or has no children.
+func (t *tui) expand(n *tuiNode) error {
+	if n.recursive || n.excluded {
+		return nil
+	}
+	if err := t.load(n); err != nil {
+		return err
+	}
+	n.expanded = len(n.children) > 0
+	return nil
+}
+
+// Expands the nodes above the depth of the view and collapses the others.
+func (t *tui) expandTo(n *tuiNode, depth int) error {
+	n.expanded = false
+	if n.level >= depth {
+		return nil
+	}
+	if err := t.expand(n); err != nil {
+		return err
+	}
+	if !n.expanded {
+		return nil
+	}
+	for _, c := range n.children {
+		if err := t.expandTo(c, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Switches to a view, expanding its trees to its depth.
+func (t *tui) show(view tuiView) error {
+	t.view = view
+	defer t.flatten()
+	for _, r := range view.roots {
+		if err := t.expandTo(r, view.depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lists the visible nodes, in the order they are shown.
+func (t *tui) flatten() {
+	var walk func(n *tuiNode)
+
+	t.rows = t.rows[:0]
+	walk = func(n *tuiNode) {
+		t.rows = append(t.rows, n)
+		if n.expanded {
+			for _, c := range n.children {
+				walk(c)
+			}
+		}
+	}
+	for _, r := range t.view.roots {
+		walk(r)
+	}
+	if t.view.sel >= len(t.rows) {
+		t.view.sel = len(t.rows) - 1
+	}
+	if t.view.sel < 0 {
+		t.view.sel = 0
+	}
+}
+
+// Returns the selected node.
+func (t *tui) selected() *tuiNode {
+	return t.rows[t.view.sel]
+}
+
+// Selects the first row from the nth after the selected one, wrapping
+// around, whose symbol contains the search query.
+func (t *tui) find(from int) bool {
+	if t.query == "" {
+		return false
+	}
+	for i := 0; i < len(t.rows); i++ {
+		r := (t.view.sel + from + i) % len(t.rows)
+		if strings.Contains(t.rows[r].symbol, t.query) {
+			t.view.sel = r
+			return true
+		}
+	}
+	return false
+}
+
+// Handles a key while the search query is typed: the selection follows
+// the query, enter keeps it and escape goes back to the starting row.
+func (t *tui) searchKey(key string) {
+	switch key {
+	case "enter":
+		t.searching = false
+		return
+	case "esc":
+		t.searching = false
+		t.query = ""
+		t.view.sel = t.from
+		return
+	case "backspace":
+		if t.query != "" {
+			t.query = t.query[:len(t.query)-1]
+		}
+	default:
+		if len(key) == 1 {
+			t.query += key
+		}
+	}
+	t.view.sel = t.from
+	if !t.find(0) && t.query != "" {
+		t.status = "no match for " + t.query
+	}
+}
+
+// Handles a key, returning true when the interface is to be closed. Errors
+// fetching the tree are shown in the status line.
+func (t *tui) handleKey(key string) bool {
+	var err error
+
+	t.status = ""
+	if t.searching {
+		t.searchKey(key)
+		return false
+	}
+	n := t.selected()
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "j", "down":
+		if t.view.sel < len(t.rows)-1 {
+			t.view.sel++
+		}
+	case "k", "up":
+		if t.view.sel > 0 {
+			t.view.sel--
+		}
+	case "g", "home":
+		t.view.sel = 0
+	case "G", "end":
+		t.view.sel = len(t.rows) - 1
+	case "l", "right", "enter":
+		err = t.expand(n)
+	case "h", "left":
+		if n.expanded {
+			n.expanded = false
+		} else if n.parent != nil {
+			for t.rows[t.view.sel] != n.parent {
+				t.view.sel--
+			}
+		}
+	case "+", "-":
+		depth := t.view.depth + 1
+		if key == "-" {
+			depth = t.view.depth - 1
+		}
+		if depth < 1 {
+			return false
+		}
+		view := t.view
+		view.depth = depth
+		err = t.show(view)
+		t.status = fmt.Sprintf("depth %d", depth)
+	case "c":
+		t.history = append(t.history, t.view)
+		err = t.show(tuiView{roots: []*tuiNode{{symbol: n.symbol, id: n.id}}, callers: true, depth: t.view.depth})
+	case "b", "backspace":
+		if len(t.history) == 0 {
+			t.status = "no previous view"
+			return false
+		}
+		t.view = t.history[len(t.history)-1]
+		t.history = t.history[:len(t.history)-1]
+	case "/":
+		t.from = t.view.sel
+		t.searching = true
+		t.query = ""
+	case "n":
+		if !t.find(1) {
+			t.status = "no match for " + t.query
+		}
+	}
+	if err != nil {
+		t.status = err.Error()
+	}
+	t.flatten()
+	return false
+}
+
+// Returns the lines of the details pane, the metadata of the symbol and its
+// source.
+func (t *tui) symbolDetails(n *tuiNode) []string {
+	if lines, ok := t.details[n.id]; ok {
+		return lines
+	}
+	var lines []string
+	infos, err := getSymbolInfo(t.db, n.symbol, t.conf.Instance)
+	if err != nil {
+		lines = []string{err.Error()}
+	}
+	for i, info := range infos {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		if t.sources != nil {
+			t.sources.describe(&info, t.conf.Snippet)
+		}
+		lines = append(lines, strings.Split(info.String(), "\n")...)
+	}
+	t.details[n.id] = lines
+	return lines
+}
+
+// Pads or cuts a string to a width.
+func fitWidth(s string, w int) string {
+	r := []rune(s)
+	if len(r) > w {
+		return string(r[:w])
+	}
+	return s + strings.Repeat(" ", w-len(r))
+}
+
+// Returns the screen as lines of the given size: the tree pane, the details
+// pane at its right and the status line. The selected row is marked by a
+// leading '>' and its index returned, -1 if not shown.
+func (t *tui) render(width, height int) ([]string, int) {
+	var res []string
+
+	rows := height - 2
+	if rows < 1 {
+		rows = 1
+	}
+	if t.view.sel < t.view.top {
+		t.view.top = t.view.sel
+	}
+	if t.view.sel >= t.view.top+rows {
+		t.view.top = t.view.sel - rows + 1
+	}
+	treeW := width * 3 / 5
+	detW := width - treeW - 3
+	if detW < 0 {
+		detW = 0
+	}
+
+	dir := "callees"
+	if t.view.callers {
+		dir = "callers"
+	}
+	var names []string
+	for _, r := range t.view.roots {
+		names = append(names, r.symbol)
+	}
+	res = append(res, fitWidth(fmt.Sprintf("nav: %s of %s, instance %d, depth %d", dir, strings.Join(names, ", "), t.conf.Instance, t.view.depth), width))
+	details := t.symbolDetails(t.selected())
+	sel := -1
+	for i := 0; i < rows; i++ {
+		var left, right string
+		if r := t.view.top + i; r < len(t.rows) {
+			n := t.rows[r]
+			mark := "  "
+			switch {
+			case n.recursive:
+				mark = "@ "
+			case n.expanded:
+				mark = "- "
+			case n.excluded:
+			case !n.loaded || len(n.children) > 0:
+				mark = "+ "
+			}
+			cursor := " "
+			if r == t.view.sel {
+				cursor = ">"
+				sel = len(res)
+			}
+			left = cursor + strings.Repeat("  ", n.level) + mark + n.symbol
+		}
+		if i < len(details) {
+			right = details[i]
+		}
+		res = append(res, fitWidth(left, treeW)+" | "+fitWidth(right, detW))
+	}
+	status := t.status
+	switch {
+	case t.searching:
+		status = "/" + t.query
+	case status == "":
+		status = tuiHelp
+	}
+	res = append(res, fitWidth(status, width))
+	return res[:height], sel
+}
+
+// Draws the screen, the selected row in reverse video.
+func (t *tui) draw(width, height int) {
+	var b strings.Builder
+
+	lines, sel := t.render(width, height)
+	b.WriteString("\x1b[H")
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		if i == sel || i == len(lines)-1 {
+			l = "\x1b[7m" + l + "\x1b[0m"
+		}
+		b.WriteString(l)
+	}
+	os.Stdout.WriteString(b.String())
+}
+
+// Keys sent as escape sequences, by their final byte.
+var escapeKeys = map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left", 'H': "home", 'F': "end"}
+
+// Splits the bytes read from the terminal in keys, naming the special ones.
+func parseKeys(b []byte) []string {
+	var res []string
+
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == 0x1b && i+2 < len(b) && (b[i+1] == '[' || b[i+1] == 'O'):
+			// Parameters, e.g. of ESC [ 1 ; 5 A, are skipped.
+			j := i + 2
+			for j < len(b)-1 && (b[j] >= '0' && b[j] <= '9' || b[j] == ';') {
+				j++
+			}
+			if name, ok := escapeKeys[b[j]]; ok {
+				res = append(res, name)
+			}
+			i = j
+		case c == 0x1b:
+			res = append(res, "esc")
+		case c == '\r' || c == '\n':
+			res = append(res, "enter")
+		case c == 0x7f || c == 0x08:
+			res = append(res, "backspace")
+		case c == 0x03:
+			res = append(res, "ctrl-c")
+		case c >= 0x20 && c < 0x7f:
+			res = append(res, string(c))
+		}
+	}
+	return res
+}
+
+// Implements the tui command: a full screen explorer of the call tree of
+// the symbol, on the terminal of stdin and stdout.
+func cmdExploreTui(db navdb.Conn, conf *configuration) (string, error) {
+	t, err := newTui(db, conf, conf.symbolList())
+	if err != nil {
+		return "", err
+	}
+	restore, err := rawTerminal(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("tui needs a terminal: %w", err)
+	}
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+
+	var width, height int
+	buf := make([]byte, 64)
+	for {
+		w, h, err := terminalSize(os.Stdout)
+		if err != nil {
+			return "", err
+		}
+		if w != width || h != height {
+			width, height = w, h
+			os.Stdout.WriteString("\x1b[2J")
+		}
+		t.draw(width, height)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			if t.handleKey(key) {
+				return "", nil
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// The terminal is driven with the linux ioctls.
+var errNoTerminal = errors.New("terminal interface only supported on linux")
+
+func rawTerminal(f *os.File) (func(), error) {
+	return nil, errNoTerminal
+}
+
+func terminalSize(f *os.File) (int, int, error) {
+	return 0, 0, errNoTerminal
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	navdb "github.com/alessandrocarminati/nav/db"
+)
+
+// Symbol visibility filters.
+const (
+	visibilityExported = "exported"
+	visibilityGPL      = "gpl"
+	visibilityStatic   = "static"
+)
+
+// Checks a visibility filter value, empty means no filter.
+func validVisibility(v string) error {
+	switch v {
+	case "", visibilityExported, visibilityGPL, visibilityStatic:
+		return nil
+	}
+	return fmt.Errorf("unsupported visibility %s", v)
+}
+
+// Set of functions allowed by a filter or, if deny, hidden by it, by id. A
+// nil set allows everything.
+type symbolSet struct {
+	ids  map[int]bool
+	deny bool
+}
+
+// Returns the set of the ids.
+func newSymbolSet(ids []string, deny bool) (*symbolSet, error) {
+	res := symbolSet{map[int]bool{}, deny}
+	for _, id := range ids {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, errors.New("invalid symbol id " + id)
+		}
+		res.ids[n] = true
+	}
+	return &res, nil
+}
+
+// Checks if the filter hides a function.
+func (s *symbolSet) hides(id int) bool {
+	return s != nil && s.ids[id] == s.deny
+}
+
+// Returns the functions of the instance allowed by the visibility filters:
+// the ones exported, static or in the module namespace requested, nil if
+// there are no filters. The extractor stores in the visibility table the
+// linkage, the EXPORT_SYMBOL flavour and the namespace of every function; a
+// database without it can not be filtered.
+func visibilityAllowed(db navdb.Conn, conf *configuration, instance int) (*symbolSet, error) {
+	var cond string
+	var args []interface{}
+
+	switch conf.Visibility {
+	case visibilityExported:
+		cond = "visibility_export in ('EXPORT_SYMBOL', 'EXPORT_SYMBOL_GPL')"
+	case visibilityGPL:
+		cond = "visibility_export='EXPORT_SYMBOL_GPL'"
+	case visibilityStatic:
+		cond = "visibility_static=1"
+	}
+	if conf.Namespace != "" {
+		if cond != "" {
+			cond += " and "
+		}
+		args = append(args, conf.Namespace)
+		cond += "visibility_namespace=$1"
+	}
+	if cond == "" {
+		return nil, nil
+	}
+	args = append(args, instance)
+
+	ids, err := queryColumn(db, fmt.Sprintf("select visibility_symbol_ref_id from visibility, symbols where visibility_symbol_ref_id=symbol_id "+
+		"and symbol_instance_id_ref=$%d and %s", len(args), cond), args...)
+	if err != nil {
+		return nil, fmt.Errorf("the database has no symbol visibility data: %w", err)
+	}
+	logger.info("visibility filter", "visibility", conf.Visibility, "namespace", conf.Namespace, "allowed", len(ids))
+	return newSymbolSet(ids, false)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2022 Red Hat, Inc.
+ * SPDX-License-Identifier: GPL-2.0-or-later
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alessandrocarminati/nav/graph"
+)
+
+// Max number of partial call chains expanded searching the heaviest ones.
+const weightedPathsLimit = 100000
+
+// Weights of functions and calls, e.g. scores of sleeping, locking or
+// complexity. Missing ones weigh 0.
+type weights struct {
+	funcs map[string]float64
+	calls map[callEdge]float64
+}
+
+// Call chain with its cumulative weight.
+type weightedPath struct {
+	Weight float64  `json:"weight"`
+	Chain  []string `json:"chain"`
+}
+
+// Reads a weights file: one "function weight" or "caller callee weight" per
+// line. Empty lines and lines starting with # are ignored, weights of the
+// same function or call add up.
+func loadWeights(fn string) (*weights, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	w := &weights{funcs: map[string]float64{}, calls: map[callEdge]float64{}}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected function or caller and callee followed by weight", fn, n)
+		}
+		v, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid weight: %w", fn, n, err)
+		}
+		if len(fields) == 2 {
+			w.funcs[fields[0]] += v
+		} else {
+			w.calls[callEdge{fields[0], fields[1]}] += v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Returns the cumulative weight of the functions and calls of a chain.
+func (w *weights) chainWeight(chain []string) float64 {
+	var res float64
+
+	for i, f := range chain {
+		res += w.funcs[f]
+		if i > 0 {
+			res += w.calls[callEdge{chain[i-1], f}]
+		}
+	}
+	return res
+}
+
+// Returns the weight of the calls between the nodes of a graph, the callee
+// and the call weights, the function weight alone for the start, u being -1.
+func (w *weights) stepWeight(g *graph.Graph) func(u int, v int) float64 {
+	return func(u int, v int) float64 {
+		res := w.funcs[g.Nodes[v].Name]
+		if u >= 0 {
+			res += w.calls[callEdge{g.Nodes[u].Name, g.Nodes[v].Name}]
+		}
+		return res
+	}
+}
+
+// Ranks the chains by cumulative weight, heaviest first and then shortest,
+// keeping the first k.
+func (w *weights) rank(chains [][]string, k int) []weightedPath {
+	res := []weightedPath{}
+	for _, c := range chains {
+		res = append(res, weightedPath{w.chainWeight(c), c})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Weight != res[j].Weight {
+			return res[i].Weight > res[j].Weight
+		}
+		return len(res[i].Chain) < len(res[j].Chain)
+	})
+	if len(res) > k {
+		res = res[:k]
+	}
+	return res
+}